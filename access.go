@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// previewed is the IDs of the entries previewed in the prompt
+// which are recorded as accessed when the prompt finishes
+var previewed = struct {
+	sync.Mutex
+	ids map[string]bool
+}{ids: map[string]bool{}}
+
+// markPreviewed remembers the entry was previewed
+func markPreviewed(id string) {
+	previewed.Lock()
+	defer previewed.Unlock()
+	previewed.ids[id] = true
+}
+
+// recordPreviewed records the access time of the entries previewed so far
+func (c CLI) recordPreviewed() {
+	previewed.Lock()
+	var ids []string
+	for id := range previewed.ids {
+		ids = append(ids, id)
+	}
+	previewed.ids = map[string]bool{}
+	previewed.Unlock()
+	c.touch(ids...)
+}
+
+// touch records the entries were accessed (previewed or opened) now
+// so that prune can keep the recently inspected ones (retention.keep_accessed)
+// and stats can tell the ones never looked at
+// Failing to record it doesn't fail the operation.
+func (c CLI) touch(ids ...string) {
+	if len(ids) == 0 {
+		return
+	}
+	now := c.Clock.Now()
+	touched := map[string]bool{}
+	for _, id := range ids {
+		touched[id] = true
+	}
+	err := c.Inventory.modify(func(files []File) []File {
+		for i, file := range files {
+			if touched[file.ID] {
+				files[i].Accessed = &now
+			}
+		}
+		return files
+	})
+	if err != nil {
+		log.Printf("[WARN] failed to record access: %v", err)
+	}
+}
+
+// accessedWithin returns true if the file was accessed within the duration
+func accessedWithin(file File, now time.Time, d time.Duration) bool {
+	return file.Accessed != nil && now.Sub(*file.Accessed) < d
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	flags "github.com/jessevdk/go-flags"
+)
+
+// expandAlias replaces the alias at the beginning of args with its definition
+// in config like git aliases (e.g. rs = "restore --latest")
+// The aliases cannot override the builtin commands and can refer to other aliases
+// The alias is not expanded if the file of the name exists, so that
+// "gomi rs" trashes ./rs instead of restoring the latest one.
+func expandAlias(fs FS, parser *flags.Parser, aliases map[string]string, args []string) ([]string, error) {
+	seen := map[string]bool{}
+	for len(args) > 0 {
+		name := args[0]
+		def, ok := aliases[name]
+		if !ok || parser.Find(name) != nil {
+			break
+		}
+		if _, err := fs.Lstat(name); err == nil && len(seen) == 0 {
+			log.Printf("[DEBUG] %s: not expanding the alias since the file exists", name)
+			break
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("alias %s: recursive alias", name)
+		}
+		seen[name] = true
+		words, err := splitArgs(def)
+		if err != nil {
+			return nil, fmt.Errorf("alias %s: %v", name, err)
+		}
+		log.Printf("[DEBUG] expanding alias %q to %q", name, words)
+		args = append(words, args[1:]...)
+	}
+	return args, nil
+}
+
+// splitArgs splits the string into words like shell
+// Only the quotes by ' and " and the escape by \ are supported
+func splitArgs(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	var quote rune
+	inWord, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ExportOption represents the options of export command
+type ExportOption struct {
+	QueryOption
+	Archive string `long:"archive" value-name:"FILE" description:"Archive file to write (.tar, .tar.gz or .tar.zst)"`
+	ToXDG   bool   `long:"to-xdg" description:"Move the given entries into the trash of the desktop instead (export --to-xdg <id>...)"`
+}
+
+// ImportOption represents the options of import command
+type ImportOption struct {
+	Archive string `long:"archive" value-name:"FILE" required:"true" description:"Archive file created by export command"`
+}
+
+const (
+	archiveInventory = "inventory.json"
+	archivePayload   = "payload"
+)
+
+// Export bundles the selected files and their metadata into an archive
+// The paths in the archive are relative to gomi dir so that it can be
+// imported on another machine
+// With --to-xdg, the given entries are moved into the XDG trash instead.
+func (c CLI) Export(ctx context.Context, args []string) error {
+	opt := c.Option.Export
+	switch {
+	case opt.ToXDG && opt.Archive != "":
+		return errors.New("export: --archive and --to-xdg cannot be given together")
+	case opt.ToXDG:
+		return c.exportXDG(ctx, args)
+	case opt.Archive == "":
+		return errors.New("export: --archive or --to-xdg is required")
+	case len(args) > 0:
+		return errors.New("export: ids can be given only with --to-xdg (use the filters to select files)")
+	}
+	files := c.Query(opt.QueryOption, c.Clock.Now())
+	if len(files) == 0 {
+		return errors.New("no deleted files found")
+	}
+
+	f, err := c.FS.OpenFile(opt.Archive, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := compressWriter(f, opt.Archive)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+
+	entries := make([]File, len(files))
+	for i, file := range files {
+		rel, err := filepath.Rel(c.Dir, file.To)
+		if err != nil {
+			return err
+		}
+		file.To = filepath.ToSlash(rel)
+		entries[i] = file
+	}
+	meta, err := json.Marshal(Inventory{Files: entries})
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:     archiveInventory,
+		Mode:     0600,
+		Size:     int64(len(meta)),
+		Typeflag: tar.TypeReg,
+		ModTime:  c.Clock.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tw.Write(meta); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsNode() || file.Archived {
+			continue
+		}
+		if c.packed(file) {
+			// export has no packs
+			if err := c.tarPackedPayload(tw, file); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.tarPayload(tw, file); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	c.info("exported %d file(s) to %s", len(files), opt.Archive)
+	return nil
+}
+
+func (c CLI) tarPayload(tw *tar.Writer, file File) error {
+	return c.tarTree(tw, file.To, c.Dir, archivePayload)
+}
+
+// tarPackedPayload writes the payload of the packed file into the archive
+// with the same names as tarPayload, reading it from the pack as it is
+// instead of extracting it into gomi dir
+func (c CLI) tarPackedPayload(tw *tar.Writer, file File) error {
+	rel, err := filepath.Rel(c.Dir, filepath.Dir(file.To))
+	if err != nil {
+		return err
+	}
+	var found bool
+	err = c.readPack(file.Pack, func(id string, hdr *tar.Header, tr *tar.Reader) error {
+		if id != file.ID {
+			return nil
+		}
+		found = true
+		member := *hdr
+		name := filepath.FromSlash(strings.TrimPrefix(hdr.Name, id+"/"))
+		member.Name = archivePayload + "/" + filepath.ToSlash(filepath.Join(rel, name))
+		if err := tw.WriteHeader(&member); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, tr)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %v", file.Pack, err)
+	}
+	if !found {
+		return fmt.Errorf("%s: payload of %s not found", file.Pack, file.ID)
+	}
+	return nil
+}
+
+// tarTree writes the file or directory at root into the archive
+// The names in the archive are the paths relative to base under prefix.
+func (c CLI) tarTree(tw *tar.Writer, root, base, prefix string) error {
+	return c.FS.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			link, err = c.FS.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			// e.g. socket in the trashed directory
+			log.Printf("[WARN] %s: skipped: %v", path, err)
+			return nil
+		}
+		hdr.Name = prefix + "/" + filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := c.FS.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// Import unpacks the archive created by export command into gomi dir
+// and adds the entries to the inventory
+// The entries which already exist in the inventory are skipped
+func (c CLI) Import() error {
+	opt := c.Option.Import
+	f, err := c.FS.Open(opt.Archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := decompressReader(f, opt.Archive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var meta Inventory
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if name == archiveInventory {
+			if err := json.NewDecoder(tr).Decode(&meta); err != nil {
+				return fmt.Errorf("%s: broken inventory: %v", opt.Archive, err)
+			}
+			// it's written first, so nothing is extracted from a crafted one
+			for i, file := range meta.Files {
+				to := filepath.Join(c.Dir, filepath.FromSlash(file.To))
+				if file.To == "" || to == c.Dir || !isUnder(to, c.Dir) {
+					return fmt.Errorf("%s: invalid payload path in inventory", file.To)
+				}
+				meta.Files[i].To = to
+			}
+			continue
+		}
+		rel := strings.TrimPrefix(name, archivePayload+string(filepath.Separator))
+		if rel == name || !isUnder(filepath.Join(c.Dir, rel), c.Dir) {
+			return fmt.Errorf("%s: invalid path in archive", hdr.Name)
+		}
+		if err := c.untarPayload(tr, hdr, c.Dir, filepath.Join(c.Dir, rel)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.FS.MkdirAll(c.Dir, c.Config.Trash.DirMode.Perm()); err != nil {
+		return err
+	}
+	var files []File
+	for _, file := range meta.Files {
+		if _, ok := c.Inventory.Find(file.ID); ok {
+			log.Printf("[DEBUG] %s: already exists in inventory", file.ID)
+			continue
+		}
+		files = append(files, file)
+	}
+	if err := c.Inventory.Save(files); err != nil {
+		return err
+	}
+	for _, file := range files {
+		c.writeSidecar(file)
+	}
+	c.audit(opImport, files...)
+	c.info("imported %d file(s) from %s", len(files), opt.Archive)
+	return nil
+}
+
+// untarPayload extracts the tar member to path under root
+func (c CLI) untarPayload(tr *tar.Reader, hdr *tar.Header, root, path string) error {
+	if err := c.noSymlinkIn(root, filepath.Dir(path)); err != nil {
+		return fmt.Errorf("%s: invalid path in archive (%v)", hdr.Name, err)
+	}
+	if _, err := c.FS.Lstat(path); err == nil {
+		log.Printf("[DEBUG] %s: already exists", path)
+		return nil
+	}
+	if err := c.FS.MkdirAll(filepath.Dir(path), c.Config.Trash.DirMode.Perm()); err != nil {
+		return err
+	}
+	mode := os.FileMode(hdr.Mode).Perm()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return c.FS.MkdirAll(path, mode)
+	case tar.TypeSymlink:
+		return c.FS.Symlink(hdr.Linkname, path)
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := c.FS.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(f, tr)
+		return err
+	default:
+		log.Printf("[WARN] %s: skipped unsupported file type", hdr.Name)
+		return nil
+	}
+}
+
+// noSymlinkIn returns an error if any of the directories from root (e.g. gomi
+// dir) down to dir is a symlink, not to follow the one extracted from the
+// archive (e.g. "x -> ~/.ssh" and then "x/authorized_keys") out of root
+func (c CLI) noSymlinkIn(root, dir string) error {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+	path := root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		if name == "." {
+			continue
+		}
+		path = filepath.Join(path, name)
+		fi, err := c.FS.Lstat(path)
+		if os.IsNotExist(err) {
+			// made by MkdirAll below
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symlink", path)
+		}
+	}
+	return nil
+}
+
+// compressWriter wraps w with the compression based on the extension
+func compressWriter(w io.Writer, path string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(path, ".tar.zst"):
+		return zstd.NewWriter(w)
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return gzip.NewWriter(w), nil
+	case strings.HasSuffix(path, ".tar"):
+		return nopWriteCloser{w}, nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported archive format (.tar, .tar.gz or .tar.zst)", path)
+	}
+}
+
+// decompressReader wraps r with the decompression based on the extension
+func decompressReader(r io.Reader, path string) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(path, ".tar.zst"):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReadCloser{zr}, nil
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return gzip.NewReader(r)
+	case strings.HasSuffix(path, ".tar"):
+		return nopReadCloser{r}, nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported archive format (.tar, .tar.gz or .tar.zst)", path)
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+type nopReadCloser struct{ io.Reader }
+
+func (nopReadCloser) Close() error { return nil }
+
+type zstdReadCloser struct{ *zstd.Decoder }
+
+func (r zstdReadCloser) Close() error {
+	r.Decoder.Close()
+	return nil
+}
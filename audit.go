@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// These are the operations recorded only in the audit log
+const (
+	opImport  = "import"
+	opFixPath = "fix-path"
+	opExport  = "export" // moved into the XDG trash
+)
+
+// AuditEntry represents one record in the audit log
+// Unlike the journal, the audit log is never cleared so that it can be
+// used to investigate what happened to the trash later
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	ID   string    `json:"id"`
+	From string    `json:"from"`
+	To   string    `json:"to,omitempty"`
+	Size int64     `json:"size,omitempty"`
+}
+
+// LogOption represents the options of log command
+type LogOption struct {
+	DiffInventory bool `long:"diff-inventory" description:"Reconcile the audit log with the inventory and show the differences"`
+}
+
+var auditMu sync.Mutex
+
+// audit appends the operation to the audit log
+// It's only logged on failure since the operation itself has succeeded
+func (c CLI) audit(op string, files ...File) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := c.FS.OpenFile(filepath.Join(c.Dir, auditFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, c.Config.Trash.FileMode.Perm())
+	if err != nil {
+		log.Printf("[ERROR] failed to open audit log: %v", err)
+		return
+	}
+	defer f.Close()
+	for _, file := range files {
+		if file.ID == "" {
+			continue
+		}
+		entry := AuditEntry{
+			Time: c.Clock.Now(),
+			Op:   op,
+			ID:   file.ID,
+			From: file.From,
+			To:   file.To,
+			Size: file.Size,
+		}
+		data, err := json.Marshal(&entry)
+		if err == nil && c.Inventory.Encrypt {
+			// the paths are encrypted like inventory.json
+			data, err = sealLine(c.Inventory.Key, data)
+		}
+		if err == nil {
+			_, err = f.Write(append(data, '\n'))
+		}
+		if err != nil {
+			log.Printf("[ERROR] failed to write audit log: %v", err)
+			return
+		}
+	}
+}
+
+// readAudit returns all the entries in the audit log
+func (c CLI) readAudit() ([]AuditEntry, error) {
+	f, err := c.FS.Open(filepath.Join(c.Dir, auditFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []AuditEntry
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 4096), 1024*1024)
+	for s.Scan() {
+		var entry AuditEntry
+		line, err := unsealLine(c.Inventory.Key, s.Bytes())
+		if err == nil {
+			err = json.Unmarshal(line, &entry)
+		}
+		if err != nil {
+			log.Printf("[WARN] broken audit log entry: %v", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, s.Err()
+}
+
+// Log prints the audit log
+func (c CLI) Log() error {
+	if c.Option.Log.DiffInventory {
+		return c.diffInventory()
+	}
+	entries, err := c.readAudit()
+	if err != nil {
+		return err
+	}
+	rows := [][]string{{"TIME", "OP", "ID", "SIZE", "PATH"}}
+	for _, entry := range entries {
+		rows = append(rows, []string{
+			entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Op, entry.ID,
+			humanize.Bytes(uint64(entry.Size)), entry.From,
+		})
+	}
+	return printTable(c.Stdout, rows)
+}
+
+// These are the differences between the audit log and the inventory
+const (
+	diffPurgedOutside    = "purged outside gomi"    // payload is gone but the original path doesn't exist
+	diffRestoredManually = "restored manually"      // payload is gone and the original path exists
+	diffDroppedEntry     = "removed from inventory" // the entry is gone but the payload is still there
+	diffNotAudited       = "not in audit log"       // trashed before the audit log existed (info)
+)
+
+// diffInventory replays the audit log to know which files should be in the trash
+// and compares them with the inventory and the payloads
+func (c CLI) diffInventory() error {
+	entries, err := c.readAudit()
+	if err != nil {
+		return err
+	}
+	expected := map[string]AuditEntry{}
+	var order []string
+	for _, entry := range entries {
+		switch entry.Op {
+		case opTrash, opImport:
+			if _, ok := expected[entry.ID]; !ok {
+				order = append(order, entry.ID)
+			}
+			expected[entry.ID] = entry
+		case opFixPath:
+			if e, ok := expected[entry.ID]; ok {
+				e.From = entry.From
+				expected[entry.ID] = e
+			}
+		case opRestore, opPurge, opExport:
+			delete(expected, entry.ID)
+		}
+	}
+
+	rows := [][]string{{"ID", "STATUS", "PATH"}}
+	var problems int
+	report := func(id, status, path string) {
+		if status != diffNotAudited {
+			problems++
+		}
+		rows = append(rows, []string{id, status, path})
+	}
+	for _, id := range order {
+		entry, ok := expected[id]
+		if !ok {
+			continue
+		}
+		file, recorded := c.Inventory.Find(id)
+		if recorded && (file.Archived || file.IsNode()) {
+			continue
+		}
+		to := entry.To
+		if recorded {
+			to = file.To
+		}
+		payload := c.exists(to)
+		switch {
+		case payload && recorded:
+			continue
+		case payload:
+			report(id, diffDroppedEntry, entry.From)
+		case c.exists(entry.From):
+			report(id, diffRestoredManually, entry.From)
+		default:
+			report(id, diffPurgedOutside, entry.From)
+		}
+	}
+	audited := map[string]bool{}
+	for _, entry := range entries {
+		audited[entry.ID] = true
+	}
+	for _, file := range c.Inventory.Files {
+		if file.ID != "" && !audited[file.ID] {
+			report(file.ID, diffNotAudited, file.From)
+		}
+	}
+
+	if len(rows) > 1 {
+		if err := printTable(c.Stdout, rows); err != nil {
+			return err
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d difference(s) found", problems)
+	}
+	c.info("the inventory matches the audit log")
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/rs/xid"
+)
+
+// BenchOption represents the options of bench command
+type BenchOption struct {
+	Files int    `short:"n" long:"files" value-name:"N" default:"1000" description:"Number of files to trash and restore"`
+	Size  Size   `short:"s" long:"size" value-name:"SIZE" default:"4KB" description:"Size of each file"`
+	Dir   string `short:"C" long:"dir" value-name:"DIR" default:"." description:"Directory to create the files in (on the filesystem to measure)"`
+}
+
+// Bench measures the throughput of trash and restore on the user's filesystem
+// The files are created in the given directory and trashed into a temporary
+// gomi dir under the real one, so that neither the inventory nor the audit log
+// is touched and the payloads move across the same filesystems as usual
+func (c CLI) Bench() error {
+	opt := c.Option.Bench
+	if opt.Files < 1 {
+		return fmt.Errorf("%d: number of files should be positive", opt.Files)
+	}
+	id := xid.New().String()
+	dir := filepath.Join(opt.Dir, ".gomi-bench-"+id)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if err := c.FS.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	defer c.FS.RemoveAll(dir)
+
+	root := filepath.Join(c.Dir, "bench-"+id)
+	if err := c.FS.MkdirAll(root, c.Config.Trash.DirMode.Perm()); err != nil {
+		return err
+	}
+	defer c.FS.RemoveAll(root)
+
+	b := c
+	b.Dir = root
+	b.Option = Option{}
+	b.Config.Guard = GuardConfig{}
+	b.Config.Trash.Quota = 0
+	b.Config.Profile = profileQuiet
+	b.Stdout = ioutil.Discard
+	lock := &Lock{Dir: root, Strategy: c.Config.Lock.Strategy, Mode: c.Config.Trash.FileMode.Perm(), FS: c.FS}
+	b.Inventory = &Inventory{
+		Path: filepath.Join(root, inventoryFile),
+		Mode: c.Inventory.Mode,
+		Sync: c.Inventory.Sync,
+		Lock: lock,
+		FS:   c.FS,
+	}
+	b.Journal = &Journal{Path: filepath.Join(root, journalFile), Mode: c.Journal.Mode, Lock: lock, FS: c.FS, Encrypt: c.Journal.Encrypt, Key: c.Journal.Key}
+
+	paths := make([]string, opt.Files)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("file-%06d", i))
+		f, err := c.FS.OpenFile(paths[i], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(f, rand.Reader, int64(opt.Size))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	total := int64(opt.Size) * int64(opt.Files)
+	fmt.Fprintf(c.Stdout, "%d file(s) x %s in %s (GOMAXPROCS=%d)\n",
+		opt.Files, humanize.Bytes(uint64(opt.Size)), dir, runtime.GOMAXPROCS(0))
+
+	ctx := context.Background()
+	// not c.Clock since it may be fixed by GOMI_NOW
+	start := time.Now()
+	if err := b.Remove(ctx, paths); err != nil {
+		return err
+	}
+	c.printBench("trash", opt.Files, total, time.Since(start))
+
+	start = time.Now()
+	if err := b.restoreAll(ctx, b.Inventory.Files); err != nil {
+		return err
+	}
+	c.printBench("restore", opt.Files, total, time.Since(start))
+	return nil
+}
+
+func (c CLI) printBench(op string, n int, size int64, elapsed time.Duration) {
+	sec := elapsed.Seconds()
+	if sec == 0 {
+		sec = 1e-9
+	}
+	fmt.Fprintf(c.Stdout, "%-8s %s (%.0f files/s, %s/s)\n", op+":",
+		elapsed.Round(time.Millisecond), float64(n)/sec, humanize.Bytes(uint64(float64(size)/sec)))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// benchFiles is the number of files trashed at once in the benchmarks
+const benchFiles = 100
+
+// writeBenchFiles creates the files to trash in a new directory for each run
+func writeBenchFiles(e *testEnv, run int) []string {
+	paths := make([]string, benchFiles)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/work/%d/file-%06d", run, i)
+		e.WriteFile(paths[i], "gomi")
+	}
+	return paths
+}
+
+func BenchmarkRemove(b *testing.B) {
+	e := newTestEnv(b)
+	defer e.Close()
+	ctx := context.Background()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		paths := writeBenchFiles(e, n)
+		b.StartTimer()
+		if err := e.CLI.Remove(ctx, paths); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRestore(b *testing.B) {
+	e := newTestEnv(b)
+	defer e.Close()
+	ctx := context.Background()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		if err := e.CLI.Remove(ctx, writeBenchFiles(e, n)); err != nil {
+			b.Fatal(err)
+		}
+		e.Reload()
+		files := e.CLI.Inventory.Files
+		b.StartTimer()
+		if err := e.CLI.restoreAll(ctx, files); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
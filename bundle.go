@@ -0,0 +1,189 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// DebugBundleOption represents the options of debug-bundle command
+type DebugBundleOption struct {
+	Output  string `short:"o" long:"output" value-name:"FILE" description:"Archive file to write (default: gomi-debug-<time>.tar.gz)"`
+	Entries int    `long:"entries" value-name:"N" default:"50" description:"Number of the latest inventory entries to include"`
+}
+
+// bundleLogLines is the number of the last lines of the logs included in the bundle
+const bundleLogLines = 1000
+
+// DebugBundle collects what maintainers need to triage bug reports into one
+// archive: platform info, config, the latest inventory entries, journal,
+// audit log and debug logs
+// All the paths and names are redacted by redactPath, so it can be attached
+// to a public issue as it is.
+func (c CLI) DebugBundle() error {
+	opt := c.Option.DebugBundle
+	output := opt.Output
+	if output == "" {
+		output = "gomi-debug-" + c.Clock.Now().Format("20060102-150405") + ".tar.gz"
+	}
+
+	f, err := c.FS.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := compressWriter(f, output)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	add := func(name string, b []byte) error {
+		log.Printf("[DEBUG] adding %s (%d bytes) to the bundle", name, len(b))
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0600,
+			Size:     int64(len(b)),
+			Typeflag: tar.TypeReg,
+			ModTime:  c.Clock.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(b)
+		return err
+	}
+
+	// the config and the debug log are read from the host like loadConfig
+	// does, the others from gomi dir through c.FS (see GOMI_ROOT)
+	contents := []struct {
+		name string
+		read func() ([]byte, error)
+	}{
+		{"platform.txt", c.bundlePlatform},
+		{"config.toml", func() ([]byte, error) { return readRedacted(osFS{}, configPath(), 0) }},
+		{"inventory.json", func() ([]byte, error) { return c.bundleInventory(opt.Entries) }},
+		{journalFile, func() ([]byte, error) { return readRedacted(c.FS, c.Journal.Path, 0) }},
+		{auditFile, func() ([]byte, error) { return readRedacted(c.FS, filepath.Join(c.Dir, auditFile), opt.Entries) }},
+		{"doctor.log", bundleDoctor},
+		{"gomi.log", func() ([]byte, error) { return readRedacted(osFS{}, os.Getenv("CLI_LOG_PATH"), bundleLogLines) }},
+	}
+	for _, content := range contents {
+		b, err := content.read()
+		if err != nil {
+			// still useful without it
+			b = []byte(fmt.Sprintf("(not available: %v)\n", redact(err.Error())))
+		}
+		if err := add(content.name, b); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	c.info("wrote %s (check the contents before attaching it to an issue)", output)
+	return nil
+}
+
+// bundlePlatform returns what gomi runs on
+func (c CLI) bundlePlatform() ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "version: %s (%s)\n", Version, Revision)
+	fmt.Fprintf(&buf, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&buf, "gomi dir: %s\n", redactPath(c.Dir))
+	if dir, err := c.FS.Open(c.Dir); err == nil {
+		if name, ok := networkFS(dir); ok {
+			fmt.Fprintf(&buf, "network filesystem: %s\n", name)
+		}
+		dir.Close()
+	}
+	fmt.Fprintf(&buf, "container: %t (ephemeral trash: %t)\n", inContainer(), ephemeralTrash(c.Dir))
+	fmt.Fprintf(&buf, "entries: %d (%d bytes)\n", len(c.Inventory.Files), c.Inventory.Size())
+	fmt.Fprintf(&buf, "encrypted inventory: %t\n", c.Config.Encryption.Inventory)
+	fmt.Fprintf(&buf, "lock strategy: %s\n", c.Config.Lock.Strategy)
+	fmt.Fprintf(&buf, "path template: %s\n", c.Config.Trash.PathTemplate)
+	return buf.Bytes(), nil
+}
+
+// bundleInventory returns the latest n entries with the paths and names redacted
+func (c CLI) bundleInventory(n int) ([]byte, error) {
+	files := make([]File, len(c.Inventory.Files))
+	copy(files, c.Inventory.Files)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Timestamp.After(files[j].Timestamp)
+	})
+	if n >= 0 && len(files) > n {
+		files = files[:n]
+	}
+	for i, file := range files {
+		file.Name = redactPath(file.Name)
+		file.From = redactPath(file.From)
+		file.To = redactPath(file.To)
+		if file.Link != "" {
+			file.Link = redactPath(file.Link)
+		}
+		if file.Note != "" {
+			file.Note = redactPath(file.Note)
+		}
+		var tags []string
+		for _, tag := range file.Tags {
+			tags = append(tags, redactPath(tag))
+		}
+		file.Tags = tags
+		files[i] = file
+	}
+	return json.MarshalIndent(Inventory{Files: files}, "", "  ")
+}
+
+// bundleDoctor runs gomi doctor with the debug log to see how gomi dir looks
+func bundleDoctor() ([]byte, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, "doctor")
+	cmd.Env = append(os.Environ(), "GOMI_LOG=debug", "GOMI_LOG_REDACT=1", "CLI_LOG_PATH=")
+	// doctor exits with 1 if it finds problems, which are what we want
+	out, _ := cmd.CombinedOutput()
+	return []byte(redact(string(out))), nil
+}
+
+// readRedacted reads the file with the paths redacted
+// If n is positive, only the last n lines are returned.
+func readRedacted(fs FS, path string, n int) ([]byte, error) {
+	if path == "" {
+		return nil, fmt.Errorf("not configured")
+	}
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if lines := strings.SplitAfter(string(b), "\n"); n > 0 && len(lines) > n {
+		b = []byte(strings.Join(lines[len(lines)-n:], ""))
+	}
+	return []byte(redact(string(b))), nil
+}
+
+// redact redacts the paths and names in the text like GOMI_LOG_REDACT
+func redact(s string) string {
+	var buf bytes.Buffer
+	redactWriter{w: &buf}.Write([]byte(s))
+	return buf.String()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Clock tells the current time
+// This is replaced to simulate the operations at another time
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// newClock returns the clock to use
+// If GOMI_NOW is set (e.g. in tests), the time is fixed to it
+func newClock() Clock {
+	if now := os.Getenv("GOMI_NOW"); now != "" {
+		var t Time
+		if err := t.UnmarshalFlag(now); err != nil {
+			log.Printf("[ERROR] GOMI_NOW: %v", err)
+			return realClock{}
+		}
+		return fixedClock(t.Time)
+	}
+	return realClock{}
+}
+
+// ago returns the relative time from now like "3 days ago"
+func (c CLI) ago(t time.Time) string {
+	return humanize.RelTime(t, c.Clock.Now(), "ago", "from now")
+}
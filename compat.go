@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are the commands of trash-cli which gomi can behave as
+// when invoked via symlinks named them
+var trashCLICommands = map[string]bool{
+	"trash-put":     true,
+	"trash-list":    true,
+	"trash-restore": true,
+	"trash-empty":   true,
+}
+
+// progName returns the name which gomi is invoked as
+func progName(arg0 string) string {
+	return strings.TrimSuffix(filepath.Base(arg0), ".exe")
+}
+
+// trashList prints the trashed files in the format of trash-list
+func (c CLI) trashList() error {
+	files := c.trashCLIFiles()
+	for _, file := range files {
+		fmt.Fprintf(c.Stdout, "%s %s\n", file.Timestamp.Local().Format("2006-01-02 15:04:05"), file.From)
+	}
+	return nil
+}
+
+// trashEmpty deletes the trashed files permanently like trash-empty
+// If days is given, only the files deleted more than the days ago are deleted
+func (c CLI) trashEmpty(ctx context.Context, args []string) error {
+	var maxAge time.Duration
+	switch len(args) {
+	case 0:
+	case 1:
+		days, err := strconv.Atoi(args[0])
+		if err != nil || days < 0 {
+			return fmt.Errorf("%s: invalid number of days", args[0])
+		}
+		maxAge = time.Duration(days) * 24 * time.Hour
+	default:
+		return errors.New("too many arguments")
+	}
+	now := c.Clock.Now()
+	var files []File
+	for _, file := range c.trashCLIFiles() {
+		if file.Pinned {
+			continue
+		}
+		if maxAge > 0 && now.Sub(file.Timestamp) <= maxAge {
+			continue
+		}
+		files = append(files, file)
+	}
+	// trash-empty prints nothing
+	c.Stdout = ioutil.Discard
+	return c.purge(ctx, files, false)
+}
+
+// trashRestore asks which file to restore by number like trash-restore
+// Only the files deleted from the given directory (default: current directory)
+// or its subdirectories are listed
+func (c CLI) trashRestore(ctx context.Context, args []string) error {
+	dir := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		dir = args[0]
+	default:
+		return errors.New("too many arguments")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	var files []File
+	for _, file := range c.trashCLIFiles() {
+		if file.From == dir || isUnder(file.From, dir) {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(c.Stdout, "No files trashed from current dir ('%s')\n", dir)
+		return nil
+	}
+	for i, file := range files {
+		fmt.Fprintf(c.Stdout, "%4d %s %s\n", i, file.Timestamp.Local().Format("2006-01-02 15:04:05"), file.From)
+	}
+	fmt.Fprintf(c.Stdout, "What file to restore [0..%d]: ", len(files)-1)
+	line, err := bufio.NewReader(c.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(c.Stdout)
+		return nil
+	}
+	indexes, err := parseRanges(strings.TrimSpace(line), len(files))
+	if err != nil {
+		return err
+	}
+	var targets []File
+	for _, i := range indexes {
+		if _, err := c.FS.Lstat(files[i].From); err == nil {
+			return &Error{Path: files[i].From, Kind: ErrConflict, Err: fmt.Errorf("refusing to overwrite existing file %q", filepath.Base(files[i].From))}
+		}
+		targets = append(targets, files[i])
+	}
+	return c.restoreAll(ctx, targets)
+}
+
+// trashCLIFiles returns the valid entries sorted by the time deleted (oldest first)
+func (c CLI) trashCLIFiles() []File {
+	var files []File
+	for _, file := range c.Inventory.Files {
+		if file.ID != "" {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Timestamp.Before(files[j].Timestamp)
+	})
+	return files
+}
+
+// parseRanges parses the selection like "0", "1-3" and "1,3,5-7"
+func parseRanges(s string, n int) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var indexes []int
+	seen := map[int]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to := part, part
+		if i := strings.Index(part, "-"); i > 0 {
+			from, to = part[:i], part[i+1:]
+		}
+		start, err1 := strconv.Atoi(from)
+		end, err2 := strconv.Atoi(to)
+		if err1 != nil || err2 != nil || start > end {
+			return nil, fmt.Errorf("invalid entry: not an index: %s", part)
+		}
+		if start < 0 || end >= n {
+			return nil, fmt.Errorf("invalid entry: out of range 0..%d: %s", n-1, part)
+		}
+		for i := start; i <= end; i++ {
+			if !seen[i] {
+				seen[i] = true
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return indexes, nil
+}
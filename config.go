@@ -0,0 +1,421 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dustin/go-humanize"
+)
+
+// Config represents the user configuration loaded from config.toml
+type Config struct {
+	Trash      TrashConfig      `toml:"trash"`
+	Retention  RetentionConfig  `toml:"retention"`
+	Fsync      FsyncConfig      `toml:"fsync"`
+	Ignore     IgnoreConfig     `toml:"ignore"`
+	Lock       LockConfig       `toml:"lock"`
+	Preview    PreviewConfig    `toml:"preview"`
+	Prompt     PromptConfig     `toml:"prompt"`
+	Guard      GuardConfig      `toml:"guard"`
+	Encryption EncryptionConfig `toml:"encryption"`
+	Metrics    MetricsConfig    `toml:"metrics"`
+
+	// "quiet" disables notices, notifications, progress and colors
+	Profile string `toml:"profile"`
+
+	// shortcuts of commands e.g. rs = "restore --latest"
+	Alias map[string]string `toml:"alias"`
+}
+
+// EncryptionConfig represents how to encrypt the metadata at rest
+type EncryptionConfig struct {
+	Inventory bool   `toml:"inventory"` // encrypt inventory.json with AES-256-GCM
+	KeyFile   string `toml:"key_file"`  // 32 bytes in hex, generated if it doesn't exist
+
+	// "file" (key_file) or "keychain" (macOS Keychain, Secret Service or Windows Credential Manager)
+	KeySource string `toml:"key_source"`
+}
+
+// MetricsConfig represents the usage metrics counted locally (see stats --usage)
+type MetricsConfig struct {
+	Enabled bool `toml:"enabled"` // opt-in, never sent anywhere
+}
+
+// GuardConfig represents the limits of files to trash at once without confirmation
+// Zero means no limit
+type GuardConfig struct {
+	MaxFiles int  `toml:"max_files"` // including the files in directories
+	MaxSize  Size `toml:"max_size"`
+
+	// what to do with the files open by running processes: "off", "warn" or "confirm"
+	OpenFiles string `toml:"open_files"`
+}
+
+// PromptConfig represents how to ask the user to choose files
+type PromptConfig struct {
+	Selector   string `toml:"selector"`    // "promptui", "fzf" or "plain"
+	FzfCommand string `toml:"fzf_command"` // e.g. "fzf --height 40%"
+}
+
+// PreviewConfig represents how to preview trashed files in the prompt
+type PreviewConfig struct {
+	// commands by MIME type which read the content from stdin
+	// e.g. "application/pdf" = "pdftotext - -", "image/*" = "chafa"
+	Commands map[string]string `toml:"commands"`
+}
+
+// LockConfig represents how to lock gomi dir while updating the inventory
+type LockConfig struct {
+	Strategy string `toml:"strategy"` // "auto", "flock" or "lockfile"
+}
+
+// IgnoreConfig represents how to handle the files matched with .gomiignore
+type IgnoreConfig struct {
+	Action string `toml:"action"` // "refuse" or "delete"
+}
+
+// FsyncConfig represents what gomi flushes to disk after writing
+// It makes them durable against sudden power loss at the cost of speed
+type FsyncConfig struct {
+	Inventory bool `toml:"inventory"` // inventory file and its directory
+	Payloads  bool `toml:"payloads"`  // directories which the files are moved into
+}
+
+// TrashConfig represents the configuration of gomi directory itself
+type TrashConfig struct {
+	Dir       string          `toml:"dir"`       // gomi dir instead of ~/.gomi (GOMI_HOME takes precedence)
+	DirMode   FileMode        `toml:"dir_mode"`  // mode of directories created under gomi dir
+	FileMode  FileMode        `toml:"file_mode"` // mode of files created by gomi e.g. inventory
+	Quota     Size            `toml:"quota"`     // e.g. "10GB"
+	Watermark WatermarkConfig `toml:"watermark"`
+	Checksum  bool            `toml:"checksum"` // record sha256 of files to verify them later
+	Debounce  Duration        `toml:"debounce"` // succeed for the path missing since trashed within this
+
+	// rewrite the absolute symlinks pointing inside the directory restored with another name
+	RewriteLinks bool `toml:"rewrite_links"`
+
+	// write the metadata next to each payload as .meta.json
+	// to rebuild the inventory from them (see rebuild-inventory)
+	Sidecar bool `toml:"sidecar"`
+
+	// make the files in gomi dir read-only while they are trashed
+	// and give the original modes back on restoring them
+	ReadOnly bool `toml:"read_only"`
+
+	// other gomi dirs (e.g. the ones used with GOMI_HOME in projects) whose
+	// files are listed and restored together with the ones in this gomi dir
+	Stores []string `toml:"stores"`
+
+	// layout of payloads under gomi dir
+	// e.g. "{{.Year}}/{{.Month}}/{{.OriginalDirHash}}/{{.Name}}.{{.ID}}"
+	PathTemplate PathTemplate `toml:"path_template"`
+
+	// preset of path_template: "daily" (default), "monthly" or "flat"
+	Granularity string `toml:"granularity"`
+}
+
+// RetentionConfig represents the policy of prune command
+type RetentionConfig struct {
+	MaxAge Duration `toml:"max_age"` // e.g. "30d"
+
+	// the files originally under these directories (or matching these globs)
+	// are never deleted by prune, e.g. ["~/Documents", "~/src/*/secrets"]
+	Keep []string `toml:"keep"`
+
+	// the files previewed or opened within this duration are never
+	// deleted by prune, e.g. "7d"
+	KeepAccessed Duration `toml:"keep_accessed"`
+}
+
+// WatermarkConfig represents the thresholds of trash size to warn
+type WatermarkConfig struct {
+	Thresholds []Threshold `toml:"thresholds"` // e.g. ["80%", "95%"] or ["5GB"]
+	Notify     bool        `toml:"notify"`     // send desktop notification too
+}
+
+// Size is bytes which can be written in human readable string in config
+// e.g. quota = "10GB"
+type Size int64
+
+// UnmarshalText parses human readable string as bytes
+func (s *Size) UnmarshalText(text []byte) error {
+	n, err := humanize.ParseBytes(string(text))
+	if err != nil {
+		return fmt.Errorf("%q: invalid size, should be like \"10GB\"", string(text))
+	}
+	*s = Size(n)
+	return nil
+}
+
+// UnmarshalFlag parses the flag value as Size
+func (s *Size) UnmarshalFlag(value string) error {
+	return s.UnmarshalText([]byte(value))
+}
+
+func (s Size) String() string {
+	return humanize.Bytes(uint64(s))
+}
+
+// Duration is time.Duration which also accepts days and weeks
+// e.g. "30d", "2w", "12h"
+type Duration time.Duration
+
+// UnmarshalText parses duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := parseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalFlag parses the flag value as Duration
+func (d *Duration) UnmarshalFlag(value string) error {
+	return d.UnmarshalText([]byte(value))
+}
+
+func (d Duration) String() string {
+	day := 24 * time.Hour
+	if v := time.Duration(d); v >= day && v%day == 0 {
+		return fmt.Sprintf("%dd", v/day)
+	}
+	return time.Duration(d).String()
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+		if err != nil {
+			break
+		}
+		return time.Duration(n * float64(unit)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q: invalid duration, should be like \"30d\" or \"12h\"", s)
+	}
+	return d, nil
+}
+
+// Time is time.Time which can be given as a date ("2024-05-01"),
+// a datetime (RFC3339) or a duration from now ("30d", "-12h")
+// The duration is from the wall clock until resolved with the clock of CLI.
+type Time struct {
+	time.Time
+	rel      time.Duration
+	relative bool
+}
+
+// resolve makes the duration from now relative to the given now instead
+// (e.g. of GOMI_NOW)
+func (t *Time) resolve(now time.Time) {
+	if t.relative {
+		t.Time = now.Add(t.rel)
+	}
+}
+
+// UnmarshalFlag parses the flag value as Time
+func (t *Time) UnmarshalFlag(value string) error {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		v, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			t.Time = v
+			return nil
+		}
+	}
+	d, err := parseDuration(strings.TrimPrefix(value, "+"))
+	if err != nil {
+		return fmt.Errorf("%q: invalid time, should be like \"2024-05-01\" or \"30d\" (from now)", value)
+	}
+	t.Time, t.rel, t.relative = time.Now().Add(d), d, true
+	return nil
+}
+
+// Threshold is the size to warn, which is written in bytes ("5GB")
+// or in percentage of quota ("80%")
+type Threshold struct {
+	Size    Size
+	Percent float64
+}
+
+// UnmarshalText parses threshold string
+func (t *Threshold) UnmarshalText(text []byte) error {
+	s := string(text)
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || p <= 0 {
+			return fmt.Errorf("%q: invalid percentage", s)
+		}
+		t.Percent = p
+		return nil
+	}
+	return t.Size.UnmarshalText(text)
+}
+
+// Bytes returns the threshold in bytes
+// It returns 0 if it's percentage and quota is not set
+func (t Threshold) Bytes(quota Size) int64 {
+	if t.Percent > 0 {
+		return int64(float64(quota) * t.Percent / 100)
+	}
+	return int64(t.Size)
+}
+
+func (t Threshold) String() string {
+	if t.Percent > 0 {
+		return fmt.Sprintf("%g%% of quota", t.Percent)
+	}
+	return t.Size.String()
+}
+
+// FileMode is os.FileMode which can be written in octal string in config
+// e.g. dir_mode = "0700"
+type FileMode os.FileMode
+
+// UnmarshalText parses octal string as file permission
+func (m *FileMode) UnmarshalText(text []byte) error {
+	mode, err := strconv.ParseUint(string(text), 8, 32)
+	if err != nil {
+		return fmt.Errorf("%q: invalid file mode, should be octal like \"0700\"", string(text))
+	}
+	*m = FileMode(os.FileMode(mode).Perm())
+	return nil
+}
+
+// Perm returns FileMode as os.FileMode
+func (m FileMode) Perm() os.FileMode {
+	return os.FileMode(m).Perm()
+}
+
+func (m FileMode) String() string {
+	return fmt.Sprintf("%04o", uint32(m))
+}
+
+// defaultConfig returns the config used when no config file is given
+// The trash can contains everything deleted by the user so it should not be
+// visible from other users by default
+func defaultConfig() Config {
+	layout, _ := newPathTemplate(defaultPathTemplate)
+	return Config{
+		Trash: TrashConfig{
+			DirMode:      0700,
+			FileMode:     0600,
+			PathTemplate: layout,
+		},
+		Fsync: FsyncConfig{
+			Inventory: true,
+			Payloads:  false,
+		},
+		Ignore: IgnoreConfig{
+			Action: ignoreRefuse,
+		},
+		Lock: LockConfig{
+			Strategy: lockAuto,
+		},
+		Encryption: EncryptionConfig{
+			KeyFile:   filepath.Join(filepath.Dir(configPath()), "inventory.key"),
+			KeySource: keySourceFile,
+		},
+		Guard: GuardConfig{
+			OpenFiles: openFilesOff,
+		},
+		Prompt: PromptConfig{
+			Selector:   selectorPromptui,
+			FzfCommand: "fzf",
+		},
+		Profile: profileDefault,
+	}
+}
+
+func configPath() string {
+	if path := os.Getenv("GOMI_CONFIG"); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "gomi", "config.toml")
+}
+
+// loadConfig loads config file and fills in default values
+// It's not an error that the config file does not exist
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		log.Printf("[DEBUG] config file not found: %s", path)
+		return cfg, nil
+	}
+	log.Printf("[DEBUG] loading config: %s", path)
+	md, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %v", path, err)
+	}
+	if g := cfg.Trash.Granularity; g != "" {
+		text, ok := granularities[g]
+		if !ok {
+			return cfg, fmt.Errorf("%s: trash.granularity: %q should be daily, monthly or flat", path, g)
+		}
+		if md.IsDefined("trash", "path_template") {
+			return cfg, fmt.Errorf("%s: trash.granularity and trash.path_template cannot be used together", path)
+		}
+		cfg.Trash.PathTemplate, _ = newPathTemplate(text)
+	}
+	switch cfg.Profile {
+	case profileDefault, profileQuiet:
+	default:
+		return cfg, fmt.Errorf("%s: profile: %q should be %q or %q",
+			path, cfg.Profile, profileDefault, profileQuiet)
+	}
+	switch cfg.Lock.Strategy {
+	case lockAuto, lockFlock, lockLockfile:
+	default:
+		return cfg, fmt.Errorf("%s: lock.strategy: %q should be %q, %q or %q",
+			path, cfg.Lock.Strategy, lockAuto, lockFlock, lockLockfile)
+	}
+	for _, pattern := range cfg.Retention.Keep {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return cfg, fmt.Errorf("%s: retention.keep: %q: %v", path, pattern, err)
+		}
+	}
+	switch cfg.Guard.OpenFiles {
+	case openFilesOff, openFilesWarn, openFilesConfirm:
+	default:
+		return cfg, fmt.Errorf("%s: guard.open_files: %q should be %q, %q or %q",
+			path, cfg.Guard.OpenFiles, openFilesOff, openFilesWarn, openFilesConfirm)
+	}
+	switch cfg.Prompt.Selector {
+	case selectorPromptui, selectorFzf, selectorPlain:
+	default:
+		return cfg, fmt.Errorf("%s: prompt.selector: %q should be %q, %q or %q",
+			path, cfg.Prompt.Selector, selectorPromptui, selectorFzf, selectorPlain)
+	}
+	switch cfg.Encryption.KeySource {
+	case keySourceFile, keySourceKeychain:
+	default:
+		return cfg, fmt.Errorf("%s: encryption.key_source: %q should be %q or %q",
+			path, cfg.Encryption.KeySource, keySourceFile, keySourceKeychain)
+	}
+	switch cfg.Ignore.Action {
+	case ignoreRefuse, ignoreDelete:
+	default:
+		return cfg, fmt.Errorf("%s: ignore.action: %q should be %q or %q",
+			path, cfg.Ignore.Action, ignoreRefuse, ignoreDelete)
+	}
+	return cfg, nil
+}
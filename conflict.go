@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// These are the ways to restore a file whose original path already exists
+const (
+	conflictOverwrite = "Overwrite"
+	conflictRename    = "Rename"
+	conflictSkip      = "Skip"
+	conflictDiff      = "Diff"
+	allSuffix         = " all"
+)
+
+// resolveConflicts decides how to restore the files whose original path
+// already exists, asking the user if possible, and returns the files to restore
+// Skipped files are not included in the returned files
+// The files to restore to the same path are also treated as conflicted.
+// On case-insensitive filesystems, the paths different only in case are the same.
+func (c CLI) resolveConflicts(ctx context.Context, files []File) ([]File, error) {
+	files, conflicts, err := c.planConflicts(files, c.askConflict)
+	if err != nil {
+		return nil, err
+	}
+	for _, conflict := range conflicts {
+		if conflict.Resolution == conflictOverwrite && conflict.With == "" {
+			// move the existing one to the trash instead of deleting it
+			// so that it can be restored if overwritten by mistake
+			if err := c.Remove(ctx, []string{conflict.Existing}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// planConflicts decides how to restore the conflicted files with ask
+// without changing anything, and returns the files to restore and the conflicts
+// The existing files to overwrite should be trashed by the caller.
+func (c CLI) planConflicts(files []File, ask func(File, conflictTarget, bool) (string, error)) ([]File, []PlanConflict, error) {
+	insensitive := map[string]bool{}
+	key := func(path string) string {
+		dir := filepath.Dir(path)
+		ci, ok := insensitive[dir]
+		if !ok {
+			ci = caseInsensitive(c.FS, dir)
+			log.Printf("[DEBUG] %s: case-insensitive: %t", dir, ci)
+			insensitive[dir] = ci
+		}
+		if ci {
+			return strings.ToLower(path)
+		}
+		return path
+	}
+
+	var all string
+	var result []File
+	var conflicts []PlanConflict
+	taken := map[string]int{} // the index of result to restore to the path
+	dropped := map[int]bool{}
+	add := func(file File) {
+		taken[key(file.From)] = len(result)
+		result = append(result, file)
+	}
+	for _, file := range files {
+		var target conflictTarget
+		if i, ok := taken[key(file.From)]; ok {
+			target = conflictTarget{path: result[i].From, trashed: result[i].To, index: i}
+		} else if _, err := c.FS.Lstat(file.From); err == nil {
+			target = conflictTarget{path: actualPath(c.FS, file.From), index: -1}
+		} else {
+			add(file)
+			continue
+		}
+
+		action := all
+		if action == "" {
+			var err error
+			action, err = ask(file, target, len(files) > 1)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if strings.HasSuffix(action, allSuffix) {
+			// apply to the rest of the conflicted files too
+			action = strings.TrimSuffix(action, allSuffix)
+			all = action
+		}
+
+		log.Printf("[DEBUG] %s: %s (conflicted with %s)", file.From, action, target.path)
+		conflict := PlanConflict{ID: file.ID, Path: file.From, Resolution: action}
+		if target.index >= 0 {
+			conflict.With = result[target.index].ID
+		} else {
+			conflict.Existing = target.path
+		}
+		switch action {
+		case conflictOverwrite:
+			if target.index >= 0 {
+				// the other one to restore is left in the trash
+				dropped[target.index] = true
+			}
+		case conflictRename:
+			// add id to the filename not to overwrite
+			file.From = filepath.Join(filepath.Dir(file.From), restoredName(filepath.Base(file.From), file.ID))
+			conflict.Path = file.From
+		}
+		conflicts = append(conflicts, conflict)
+		if action == conflictSkip {
+			continue
+		}
+		add(file)
+	}
+
+	var restore []File
+	for i, file := range result {
+		if !dropped[i] {
+			restore = append(restore, file)
+		}
+	}
+	return restore, conflicts, nil
+}
+
+// restoredName returns the name to restore the conflicted file as
+// The id is put before the extension so that the file is still opened
+// with the same application, e.g. "report.restored-<id>.pdf" and ".env.restored-<id>"
+func restoredName(name, id string) string {
+	base, ext := splitExt(name)
+	return base + ".restored-" + id + ext
+}
+
+// conflictTarget represents what the file to restore is conflicted with
+type conflictTarget struct {
+	path    string // the existing path (may differ in case from the original path)
+	trashed string // the trashed path if it's also to be restored
+	index   int    // the index of the file to restore, or -1 if it exists on disk
+}
+
+// askConflict asks the user what to do with the conflicted file
+// If it's not interactive, the file is always renamed
+func (c CLI) askConflict(file File, target conflictTarget, multiple bool) (string, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return conflictRename, nil
+	}
+	label := fmt.Sprintf("%s already exists", file.From)
+	switch {
+	case target.index >= 0:
+		label = fmt.Sprintf("%s is also to be restored", target.path)
+	case target.path != file.From:
+		label = fmt.Sprintf("%s already exists as %s (case-insensitive filesystem)", file.From, filepath.Base(target.path))
+	}
+	items := []string{conflictRename, conflictOverwrite, conflictSkip, conflictDiff}
+	if multiple {
+		items = append(items,
+			conflictRename+allSuffix, conflictOverwrite+allSuffix, conflictSkip+allSuffix)
+	}
+	for {
+		action, err := c.choose(label, items)
+		if err != nil {
+			return "", err
+		}
+		if action != conflictDiff {
+			return action, nil
+		}
+		if target.index >= 0 {
+			c.diff(target.trashed, file.To)
+		} else {
+			c.diff(target.path, file.To)
+		}
+	}
+}
+
+// diff shows the difference between the existing file and the trashed one
+func (c CLI) diff(existing, trashed string) {
+	cmd := exec.Command("diff", "-u", "-r", existing, trashed)
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			fmt.Fprintf(c.Stderr, "diff: %v\n", err)
+		}
+	}
+}
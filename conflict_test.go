@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRestoredName(t *testing.T) {
+	const id = "c1ab2cd3ef4gh5ij6kl7"
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.restored-" + id + ".pdf"},
+		{"README", "README.restored-" + id},
+		{"archive.tar.gz", "archive.restored-" + id + ".tar.gz"},
+		{"app.min.js", "app.min.restored-" + id + ".js"},
+		{".env", ".env.restored-" + id},
+		{".bashrc.bak", ".bashrc.restored-" + id + ".bak"},
+		{"..hidden", "..hidden.restored-" + id},
+		{".tar.gz", ".tar.restored-" + id + ".gz"},
+	}
+	for _, test := range tests {
+		if got := restoredName(test.name, id); got != test.want {
+			t.Errorf("restoredName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRestoreDotfileConflict(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	ctx := context.Background()
+
+	e.WriteFile("/work/.env", "old")
+	if err := e.CLI.Remove(ctx, []string{"/work/.env"}); err != nil {
+		t.Fatal(err)
+	}
+	e.WriteFile("/work/.env", "new")
+	e.Reload()
+	id := e.CLI.Inventory.Files[0].ID
+	if err := e.CLI.RestoreByPath(ctx, []string{id}); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.ReadFile("/work/.env.restored-" + id); got != "old" {
+		t.Errorf(".env.restored-%s = %q, want %q", id, got, "old")
+	}
+}
+
+// foldFS is the filesystem ignoring the case of the paths like APFS on macOS
+// The names are stored in lower case.
+type foldFS struct {
+	FS
+}
+
+func (f foldFS) Lstat(name string) (os.FileInfo, error) { return f.FS.Lstat(strings.ToLower(name)) }
+func (f foldFS) Stat(name string) (os.FileInfo, error)  { return f.FS.Stat(strings.ToLower(name)) }
+func (f foldFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return f.FS.OpenFile(strings.ToLower(name), flag, perm)
+}
+func (f foldFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return f.FS.ReadDir(strings.ToLower(name))
+}
+func (f foldFS) Remove(name string) error { return f.FS.Remove(strings.ToLower(name)) }
+func (f foldFS) MkdirAll(path string, perm os.FileMode) error {
+	return f.FS.MkdirAll(strings.ToLower(path), perm)
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	e.WriteFile("/work/a.txt", "a")
+	if caseInsensitive(osFS{}, e.root) {
+		t.Skip("the temp dir is on a case-insensitive filesystem")
+	}
+
+	if caseInsensitive(e.CLI.FS, "/work") {
+		t.Error("/work: detected as case-insensitive")
+	}
+	fold := foldFS{e.CLI.FS}
+	if !caseInsensitive(fold, "/work") {
+		t.Error("/work: not detected as case-insensitive")
+	}
+	// from the nearest existing directory
+	if !caseInsensitive(fold, "/work/not/yet") {
+		t.Error("/work/not/yet: not detected as case-insensitive")
+	}
+	entries, err := e.CLI.FS.ReadDir("/work")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("the probe file is left in /work: %v (%v)", entries, err)
+	}
+}
+
+func TestPlanConflictsIgnoringCase(t *testing.T) {
+	rename := func(File, conflictTarget, bool) (string, error) {
+		return conflictRename, nil
+	}
+	files := []File{
+		{ID: "c1ab2cd3ef4gh5ij6kl0", Name: "README.md", From: "/work/README.md"},
+		{ID: "c1ab2cd3ef4gh5ij6kl1", Name: "Notes.txt", From: "/work/Notes.txt"},
+		{ID: "c1ab2cd3ef4gh5ij6kl2", Name: "NOTES.txt", From: "/work/NOTES.txt"},
+	}
+	tests := []struct {
+		name      string
+		fold      bool
+		conflicts []PlanConflict
+	}{
+		{"case-sensitive", false, nil},
+		{"case-insensitive", true, []PlanConflict{
+			{ID: files[0].ID, Path: "/work/README.restored-" + files[0].ID + ".md", Existing: "/work/readme.md", Resolution: conflictRename},
+			{ID: files[2].ID, Path: "/work/NOTES.restored-" + files[2].ID + ".txt", With: files[1].ID, Resolution: conflictRename},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			defer e.Close()
+			e.WriteFile("/work/readme.md", "existing")
+			if !test.fold && caseInsensitive(osFS{}, e.root) {
+				t.Skip("the temp dir is on a case-insensitive filesystem")
+			}
+			if test.fold {
+				e.CLI.FS = foldFS{e.CLI.FS}
+			}
+			restore, conflicts, err := e.CLI.planConflicts(files, rename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(restore) != len(files) {
+				t.Errorf("%d file(s) to restore, want %d", len(restore), len(files))
+			}
+			if !reflect.DeepEqual(conflicts, test.conflicts) {
+				t.Errorf("conflicts = %+v, want %+v", conflicts, test.conflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// errInterrupted is returned by the operations cancelled halfway
+// The files done before that are still saved in the inventory.
+var errInterrupted = errors.New("interrupted")
+
+// interrupted returns errInterrupted if ctx is cancelled
+// The operations check it before each file so that a file is never left
+// half moved, and then save what they have done so far.
+func interrupted(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	return nil
+}
+
+// withInterrupt returns the context cancelled on Ctrl-C or SIGTERM
+// (e.g. stopping the service running gomi serve)
+// Only the first signal is caught to finish the operation cleanly, so the
+// second one kills gomi as usual.
+func withInterrupt(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-ch:
+			log.Printf("[INFO] %v: cancelling", sig)
+			signal.Stop(ch)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(ch)
+		cancel()
+	}
+}
+
+// interruptible returns true if the command stops cleanly when ctx is
+// cancelled. The signals are not caught for the others (e.g. list --watch)
+// so that Ctrl-C still quits them at once.
+func (c CLI) interruptible() bool {
+	switch c.Command {
+	case "":
+		return !c.Option.Version && !c.Option.ListFiles && c.Option.StdinName == ""
+	case "restore", "purge", "empty", "prune", "slim", "serve", "rm", "trash-put", "trash-restore", "trash-empty":
+		return true
+	case "export":
+		return c.Option.Export.ToXDG
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// encryptedHeader is put at the beginning of the encrypted inventory file
+// so that both plain and encrypted ones can be read
+const encryptedHeader = "gomi-encrypted-v1\n"
+
+// keySize is the size of the key for AES-256-GCM
+const keySize = 32
+
+// These are where the inventory key is stored
+const (
+	keySourceFile     = "file"
+	keySourceKeychain = "keychain"
+)
+
+// keychainAccount is the account name of the inventory key in the keychain
+const keychainAccount = "inventory-key"
+
+// inventoryKey returns the key to read and write the inventory file
+// The key is generated if encryption is enabled and it doesn't exist yet.
+// If encryption is disabled, the existing key is still returned so that
+// the inventory encrypted before can be read (and written back in plain).
+func inventoryKey(fs FS, cfg EncryptionConfig, inventory string) ([]byte, error) {
+	if cfg.KeySource == keySourceKeychain {
+		return keychainKey(fs, cfg, inventory)
+	}
+	path := expandHome(cfg.KeyFile)
+	key, err := readKey(fs, path)
+	switch {
+	case err == nil:
+		return key, nil
+	case !os.IsNotExist(err):
+		return nil, err
+	case !cfg.Inventory:
+		return nil, nil
+	case encrypted(fs, inventory):
+		// a new key can never decrypt it
+		return nil, fmt.Errorf("%s: not found but the inventory is already encrypted", path)
+	}
+	log.Printf("[INFO] generating inventory key: %s", path)
+	key, err = generateKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintln(f, hex.EncodeToString(key)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return key, f.Close()
+}
+
+// keychainKey returns the inventory key stored in the OS keychain
+// If the key file exists but the keychain doesn't have the key yet,
+// the key file is imported into the keychain so that it can be deleted
+func keychainKey(fs FS, cfg EncryptionConfig, inventory string) ([]byte, error) {
+	if !cfg.Inventory && !encrypted(fs, inventory) {
+		// not to access the keychain (which may ask to unlock it) in vain
+		return nil, nil
+	}
+	secret, err := keychainGet(keychainAccount)
+	if err == nil {
+		key, err := hex.DecodeString(secret)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("keychain: %s should be %d bytes in hex", keychainAccount, keySize)
+		}
+		return key, nil
+	}
+	if err != errSecretNotFound {
+		return nil, err
+	}
+
+	path := expandHome(cfg.KeyFile)
+	key, err := readKey(fs, path)
+	switch {
+	case err == nil:
+		log.Printf("[INFO] importing %s into the keychain", path)
+		if err := keychainSet(keychainAccount, hex.EncodeToString(key)); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "gomi: imported %s into the keychain (it can be deleted now)\n", path)
+		return key, nil
+	case !os.IsNotExist(err):
+		return nil, err
+	case encrypted(fs, inventory):
+		return nil, fmt.Errorf("keychain: %s not found but the inventory is already encrypted", keychainAccount)
+	}
+	log.Printf("[INFO] generating inventory key in the keychain")
+	key, err = generateKey()
+	if err != nil {
+		return nil, err
+	}
+	return key, keychainSet(keychainAccount, hex.EncodeToString(key))
+}
+
+func generateKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// encrypted returns true if the file is encrypted by seal
+func encrypted(fs FS, path string) bool {
+	f, err := fs.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, len(encryptedHeader))
+	_, err = io.ReadFull(f, header)
+	return err == nil && string(header) == encryptedHeader
+}
+
+// readKey reads the key written in hex from the file
+func readKey(fs FS, path string) ([]byte, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("%s: key should be %d bytes in hex", path, keySize)
+	}
+	return key, nil
+}
+
+// seal encrypts the data with AES-256-GCM and prepends the header and nonce
+func seal(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(encryptedHeader), nonce...)
+	return gcm.Seal(out, nonce, data, []byte(encryptedHeader)), nil
+}
+
+// unseal decrypts the data encrypted by seal
+func unseal(key, data []byte) ([]byte, error) {
+	if key == nil {
+		return nil, errors.New("encrypted but no key found (see encryption.key_file)")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(encryptedHeader):]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	nonce, data := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, data, []byte(encryptedHeader))
+	if err != nil {
+		return nil, errors.New("failed to decrypt (wrong key?)")
+	}
+	return plain, nil
+}
+
+// sealLine encrypts one line of the JSON lines files (the inventory log,
+// journal.jsonl and audit.jsonl) into base64, so that each line can still
+// be appended and read one by one
+func sealLine(key, data []byte) ([]byte, error) {
+	sealed, err := seal(key, data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// unsealLine decrypts the line sealed by sealLine
+// The plain lines (written before encrypting them) are returned as they are.
+func unsealLine(key, line []byte) ([]byte, error) {
+	if bytes.HasPrefix(line, []byte("{")) {
+		return line, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(sealed, []byte(encryptedHeader)) {
+		return nil, errors.New("invalid record")
+	}
+	return unseal(key, sealed)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decode reads the inventory file which may be encrypted into v
+func (i *Inventory) decode(r io.Reader, v *Inventory) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte(encryptedHeader)) {
+		log.Printf("[DEBUG] decrypting inventory")
+		data, err = unseal(i.Key, data)
+		if err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// encode writes the inventory into w, encrypting it if enabled
+func (i *Inventory) encode(w io.Writer) error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	if i.Encrypt {
+		data, err = seal(i.Key, data)
+		if err != nil {
+			return err
+		}
+	} else {
+		data = append(data, '\n')
+	}
+	_, err = w.Write(data)
+	return err
+}
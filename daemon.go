@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// controlDir is where the control sockets of running gomi serve are
+// One socket is created for each process as serve-<pid>.sock.
+const controlDir = "run"
+
+// controlTimeout is how long daemon waits for each serve to reply
+const controlTimeout = 5 * time.Second
+
+// controlRequest is a command received on the control socket
+// The error of handling it is sent back to reply.
+type controlRequest struct {
+	command string
+	reply   chan error
+}
+
+// listenControl creates the control socket of this process in gomi dir (dir)
+// and sends the commands received on it to requests until the returned func
+// is called
+func listenControl(fs FS, dir string, requests chan<- controlRequest) (func(), error) {
+	dir = filepath.Join(dir, controlDir)
+	if err := fs.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("serve-%d.sock", os.Getpid()))
+	fs.Remove(path)
+	l, err := net.Listen("unix", fs.RealPath(path))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[DEBUG] listening on %s", path)
+	// not to block the connections forever once nobody receives the requests
+	stopped := make(chan struct{})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(controlTimeout))
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				req := controlRequest{command: strings.TrimSpace(line), reply: make(chan error, 1)}
+				select {
+				case requests <- req:
+				case <-stopped:
+					fmt.Fprintln(conn, "error: gomi serve is stopping")
+					return
+				}
+				if err := <-req.reply; err != nil {
+					fmt.Fprintf(conn, "error: %v\n", err)
+					return
+				}
+				fmt.Fprintln(conn, "ok")
+			}()
+		}
+	}()
+	return func() {
+		close(stopped)
+		l.Close()
+		fs.Remove(path)
+	}, nil
+}
+
+// Daemon sends the command to all the running gomi serve processes
+// over their control sockets (daemon reload)
+func (c CLI) Daemon(args []string) error {
+	if len(args) != 1 || args[0] != "reload" {
+		return errors.New("daemon reload: reload is the only command")
+	}
+	var paths []string
+	entries, _ := c.FS.ReadDir(filepath.Join(c.Dir, controlDir))
+	for _, entry := range entries {
+		if ok, _ := filepath.Match("serve-*.sock", entry.Name()); ok {
+			paths = append(paths, filepath.Join(c.Dir, controlDir, entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return errors.New("no gomi serve is running")
+	}
+	var failed bool
+	for _, path := range paths {
+		conn, err := net.DialTimeout("unix", c.FS.RealPath(path), controlTimeout)
+		if err != nil {
+			// left by the process killed
+			log.Printf("[DEBUG] removing stale socket %s: %v", path, err)
+			c.FS.Remove(path)
+			continue
+		}
+		conn.SetDeadline(time.Now().Add(controlTimeout))
+		fmt.Fprintln(conn, args[0])
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		reply = strings.TrimSpace(reply)
+		if err != nil && reply == "" {
+			reply = err.Error()
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".sock")
+		if reply != "ok" {
+			fmt.Fprintf(c.Stderr, "%s: %s\n", name, strings.TrimPrefix(reply, "error: "))
+			failed = true
+			continue
+		}
+		c.info("%s: reloaded", name)
+	}
+	if failed {
+		return errors.New("failed to reload some of gomi serve")
+	}
+	return nil
+}
+
+// reloadConfig reads the config file again for the long running process
+// Only the settings which can change without restarting are applied:
+// the trash location and the encryption key stay the same.
+func (c CLI) reloadConfig() (Config, error) {
+	cfg, err := loadConfig(configPath())
+	if err != nil {
+		return c.Config, err
+	}
+	if gomiHome(cfg) != gomiHome(c.Config) {
+		return c.Config, errors.New("trash.dir cannot be changed without restarting")
+	}
+	if cfg.Encryption != c.Config.Encryption {
+		return c.Config, errors.New("encryption cannot be changed without restarting")
+	}
+	c.Inventory.Mode = cfg.Trash.FileMode.Perm()
+	c.Inventory.Sync = cfg.Fsync.Inventory
+	c.Journal.Mode = cfg.Trash.FileMode.Perm()
+	log.Printf("[INFO] reloaded config: %s", configPath())
+	return cfg, nil
+}
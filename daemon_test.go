@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDaemonReload(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	requests := make(chan controlRequest)
+	stop, err := listenControl(e.CLI.FS, e.CLI.Dir, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(e.CLI.Dir, controlDir, fmt.Sprintf("serve-%d.sock", os.Getpid()))
+	if !e.Exists(socket) {
+		t.Fatalf("%s: not created under the root", socket)
+	}
+
+	go func() {
+		req := <-requests
+		if req.command != "reload" {
+			req.reply <- fmt.Errorf("%q: unknown command", req.command)
+			return
+		}
+		req.reply <- nil
+	}()
+	err = e.CLI.Daemon([]string{"reload"})
+	stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Exists(socket) {
+		t.Errorf("%s: left after stopping", socket)
+	}
+}
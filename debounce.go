@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// debounced returns the entry if the missing path was trashed within
+// trash.debounce, e.g. when an editor calls gomi twice for the same path
+// The inventory is read again and the journal is checked as well since
+// the first call may have finished or still be running in another process
+func (c CLI) debounced(arg string) (File, bool) {
+	window := time.Duration(c.Config.Trash.Debounce)
+	if window == 0 {
+		return File{}, false
+	}
+	abs, err := filepath.Abs(arg)
+	if err != nil {
+		return File{}, false
+	}
+	now := c.Clock.Now()
+	recent := func(file File, t time.Time) bool {
+		return file.From == abs && now.Sub(t) <= window
+	}
+
+	if entries, err := c.Journal.Pending(); err == nil {
+		for _, entry := range entries {
+			if entry.Op == opTrash && recent(entry.File, entry.Time) {
+				return entry.File, true
+			}
+		}
+	}
+	latest := Inventory{Path: c.Inventory.Path, FS: c.Inventory.FS, Key: c.Inventory.Key}
+	if err := latest.Open(); err != nil {
+		log.Printf("[DEBUG] %s", err)
+		latest.Files = c.Inventory.Files
+	}
+	for i := len(latest.Files) - 1; i >= 0; i-- {
+		if file := latest.Files[i]; file.ID != "" && recent(file, file.Timestamp) {
+			return file, true
+		}
+	}
+	return File{}, false
+}
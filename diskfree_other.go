@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import "errors"
+
+// diskFree returns the free space and inodes of the filesystem where the path is
+// It's not supported on this platform
+func diskFree(path string) (diskUsage, error) {
+	return diskUsage{}, errors.New("not supported on this platform")
+}
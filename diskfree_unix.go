@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package main
+
+import "syscall"
+
+// diskFree returns the free space and inodes of the filesystem where the path is
+// Only the space available for unprivileged users is counted
+func diskFree(path string) (diskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return diskUsage{}, err
+	}
+	return diskUsage{
+		Free:       uint64(st.Bavail) * uint64(st.Bsize),
+		Total:      uint64(st.Blocks) * uint64(st.Bsize),
+		FreeInodes: uint64(st.Ffree),
+		Inodes:     uint64(st.Files),
+	}, nil
+}
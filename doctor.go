@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// These are the limits of the health checks of gomi dir
+const (
+	diskFreeMinPercent = 5     // of the space and inodes of the filesystem
+	maxTrashDepth      = 16    // of the directories under gomi dir
+	maxTrashWidth      = 10000 // entries in one directory
+)
+
+// diskUsage represents the free space and inodes of the filesystem
+type diskUsage struct {
+	Free, Total        uint64 // bytes
+	FreeInodes, Inodes uint64
+}
+
+// DoctorOption represents the options of doctor command
+type DoctorOption struct {
+	Fix bool `long:"fix" description:"Fix the problems found if possible"`
+}
+
+// Doctor checks the health of gomi dir and reports problems found
+func (c CLI) Doctor() error {
+	var problems int
+	report := func(format string, args ...interface{}) {
+		problems++
+		fmt.Fprintf(c.Stdout, "[WARN] "+format+"\n", args...)
+	}
+	fixed := func(format string, args ...interface{}) {
+		fmt.Fprintf(c.Stdout, "[FIXED] "+format+"\n", args...)
+	}
+
+	// check permissions
+	check := func(path string, want os.FileMode) {
+		fi, err := c.FS.Lstat(path)
+		if err != nil {
+			return
+		}
+		got := fi.Mode().Perm()
+		if got&^want == 0 {
+			return
+		}
+		report("%s: permission %04o is too permissive (want %04o)", path, got, want)
+		if !c.Option.Doctor.Fix {
+			return
+		}
+		if err := c.FS.Chmod(path, got&want); err != nil {
+			fmt.Fprintf(c.Stderr, "%s: %v\n", path, err)
+			return
+		}
+		problems--
+		fixed("%s: permission changed to %04o", path, got&want)
+	}
+	dirs := trashDirs(c.Dir, c.Inventory.Files)
+	for _, dir := range dirs {
+		check(dir, c.Config.Trash.DirMode.Perm())
+	}
+	check(c.Inventory.Path, c.Config.Trash.FileMode.Perm())
+	check(c.Inventory.logPath(), c.Config.Trash.FileMode.Perm())
+	for _, path := range append(dirs, c.Inventory.Path, c.Inventory.logPath()) {
+		fi, err := c.FS.Lstat(path)
+		if err != nil || writable(fi) {
+			continue
+		}
+		report("%s: not writable by the current user (fix: chown it to you or chmod u+w)", path)
+	}
+
+	// check the filesystem of gomi dir
+	if usage, err := diskFree(c.Dir); err != nil {
+		log.Printf("[DEBUG] cannot get free space of %s: %v", c.Dir, err)
+	} else {
+		if usage.Total > 0 && usage.Free*100/usage.Total < diskFreeMinPercent {
+			report("%s: only %s (%d%%) of the filesystem is free (fix: gomi prune, or set trash.quota)",
+				c.Dir, humanize.Bytes(usage.Free), usage.Free*100/usage.Total)
+		}
+		if usage.Inodes > 0 && usage.FreeInodes*100/usage.Inodes < diskFreeMinPercent {
+			report("%s: only %d (%d%%) inodes of the filesystem are free (fix: gomi prune to purge the directories with many small files)",
+				c.Dir, usage.FreeInodes, usage.FreeInodes*100/usage.Inodes)
+		}
+	}
+
+	if ephemeralTrash(c.Dir) {
+		report("%s: on the writable layer of the container, deleted files are lost with it (fix: set GOMI_HOME or trash.dir to a mounted volume)", c.Dir)
+	}
+
+	// check the shape of trash dirs
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(c.Dir, dir)
+		if err == nil && dir != c.Dir && len(strings.Split(rel, string(filepath.Separator))) > maxTrashDepth {
+			report("%s: nested too deep under gomi dir (fix: path_template without {{.OriginalDir}})", dir)
+		}
+		entries, err := c.FS.ReadDir(dir)
+		if err == nil && len(entries) > maxTrashWidth {
+			report("%s: %d entries in one directory may slow down the filesystem (fix: granularity = \"daily\" or gomi prune)", dir, len(entries))
+		}
+	}
+
+	// check the lock left by crashed gomi
+	lock := &Lock{Dir: c.Dir, FS: c.FS}
+	lockPath := filepath.Join(c.Dir, "lock")
+	host, _ := os.Hostname()
+	if holder, ok := lock.stale(lockPath, host); ok {
+		report("%s: stale lock held by %q (fix: gomi doctor --fix to remove it)", lockPath, holder)
+		if c.Option.Doctor.Fix {
+			lock.takeOver(lockPath, holder, host)
+			if _, err := c.FS.Lstat(lockPath); err == nil {
+				fmt.Fprintf(c.Stderr, "%s: held by another gomi now\n", lockPath)
+			} else {
+				problems--
+				fixed("%s: removed", lockPath)
+			}
+		}
+	}
+
+	// check layout
+	var legacy int
+	for _, file := range c.Inventory.Files {
+		if file.ID == "" || file.To == "" {
+			continue
+		}
+		path, err := c.Config.Trash.PathTemplate.Path(file)
+		if err == nil && filepath.Join(c.Dir, path) != file.To {
+			legacy++
+		}
+	}
+	if legacy > 0 {
+		// not a problem since each entry knows where its payload is
+		fmt.Fprintf(c.Stdout, "[INFO] %d file(s) are stored in the layout other than path_template %q (still restorable)\n",
+			legacy, c.Config.Trash.PathTemplate)
+	}
+
+	// check the filesystems of the original paths
+	var moved int
+	for _, file := range c.Inventory.Files {
+		if file.ID != "" && c.originChanged(file) {
+			log.Printf("[DEBUG] %s: the filesystem of %s has changed", file.ID, file.From)
+			moved++
+		}
+	}
+	if moved > 0 {
+		fmt.Fprintf(c.Stdout, "[INFO] %d file(s) were deleted from the filesystem which is not mounted at the original path anymore\n", moved)
+	}
+	for _, group := range hardLinks(c.Inventory.Files) {
+		var paths []string
+		for _, file := range group {
+			paths = append(paths, file.From)
+		}
+		fmt.Fprintf(c.Stdout, "[INFO] %d file(s) were hard links of the same file: %s\n", len(group), strings.Join(paths, ", "))
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+	c.info("no problems found")
+	return nil
+}
+
+// trashDirs returns the directories which are created by gomi
+// (from gomi dir to the parent dir of each payload)
+// The payloads themselves are not included since they are the user's data
+func trashDirs(root string, files []File) []string {
+	unique := map[string]bool{root: true}
+	for _, file := range files {
+		if file.To == "" {
+			continue
+		}
+		dir := filepath.Dir(file.To)
+		for strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			unique[dir] = true
+			dir = filepath.Dir(dir)
+		}
+	}
+	dirs := make([]string, 0, len(unique))
+	for dir := range unique {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	log.Printf("[DEBUG] trash dirs: %d", len(dirs))
+	return dirs
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// EmptyOption represents the options of empty command
+type EmptyOption struct {
+	Grace  Duration `long:"grace" value-name:"DURATION" description:"Only mark the files now and purge them after this duration (e.g. 24h)"`
+	Cancel bool     `long:"cancel" description:"Cancel the empty scheduled with --grace"`
+	Force  bool     `short:"f" long:"force" description:"Purge them without confirmation"`
+}
+
+// emptyScheduleFile is where the empty scheduled with --grace is kept in gomi dir
+const emptyScheduleFile = "empty.json"
+
+// EmptySchedule represents the files to be purged by empty --grace
+// Only the files in the trash at the time are purged, not the ones trashed
+// during the grace period.
+type EmptySchedule struct {
+	Scheduled time.Time `json:"scheduled"`
+	Due       time.Time `json:"due"`
+	IDs       []string  `json:"ids"`
+}
+
+// Empty purges all the trashed files except the pinned ones, together with
+// the payloads left in gomi dir without entries, after the confirmation
+// With --grace, they are purged by the first gomi run after the grace
+// period instead (or by gomi serve), which can be cancelled until then.
+func (c CLI) Empty(ctx context.Context) error {
+	opt := c.Option.Empty
+	if opt.Cancel {
+		if opt.Grace > 0 {
+			return errors.New("empty: --grace and --cancel cannot be given together")
+		}
+		return c.cancelEmpty()
+	}
+	var files []File
+	pinned := 0
+	for _, file := range c.Inventory.Files {
+		switch {
+		case file.ID == "":
+		case file.Pinned:
+			pinned++
+		default:
+			files = append(files, file)
+		}
+	}
+	if opt.Grace > 0 {
+		return c.scheduleEmpty(files, time.Duration(opt.Grace))
+	}
+
+	// e.g. the ones left by removing inventory.json by hand
+	orphans, err := c.unsavedOrphans()
+	if err != nil {
+		return err
+	}
+	files = append(files, orphans...)
+	if len(files) == 0 {
+		return errors.New("no deleted files found")
+	}
+	if !opt.Force {
+		if err := c.confirmEmpty(files, pinned); err != nil {
+			return err
+		}
+	}
+	if err := c.purge(ctx, files, false); err != nil {
+		return err
+	}
+	// the scheduled one has nothing left to purge
+	if err := c.FS.Remove(filepath.Join(c.Dir, emptyScheduleFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// unsavedOrphans returns the payloads without entries except the ones
+// which other gomi running meanwhile has moved but not saved yet
+// Those are begun in the journal until saved, and the ones trashed after
+// reading the journal have the ids newer than it.
+func (c CLI) unsavedOrphans() ([]File, error) {
+	// xid has the time in seconds
+	since := time.Now().Truncate(time.Second)
+	pending, err := c.Journal.Pending()
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, entry := range pending {
+		known[entry.File.ID] = true
+	}
+	if err := c.Inventory.Open(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	orphans, err := c.orphanPayloads(known)
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	for _, file := range orphans {
+		if file.Timestamp.Before(since) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// confirmEmpty asks whether to purge the files, which is refused if stdin
+// is not a terminal unless -f is given
+func (c CLI) confirmEmpty(files []File, pinned int) error {
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	what := fmt.Sprintf("%d file(s), %s in %s", len(files), humanize.Bytes(uint64(size)), c.Dir)
+	if pinned > 0 {
+		what += fmt.Sprintf(" (%d pinned kept)", pinned)
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("refusing to purge %s without confirmation (use -f to force)", what)
+	}
+	fmt.Fprintf(c.Stderr, "gomi: permanently delete %s? [y/N] ", what)
+	answer, _ := bufio.NewReader(c.Stdin).ReadString('\n')
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+		return errors.New("aborted")
+	}
+	return nil
+}
+
+func (c CLI) scheduleEmpty(files []File, grace time.Duration) error {
+	if schedule, err := c.emptySchedule(); err != nil {
+		return err
+	} else if schedule != nil {
+		return fmt.Errorf("empty is already scheduled %s (cancel it with --cancel first)", c.ago(schedule.Due))
+	}
+	if len(files) == 0 {
+		return errors.New("no deleted files found")
+	}
+	now := c.Clock.Now()
+	schedule := EmptySchedule{Scheduled: now, Due: now.Add(grace)}
+	var size int64
+	for _, file := range files {
+		schedule.IDs = append(schedule.IDs, file.ID)
+		size += file.Size
+	}
+	b, err := json.Marshal(&schedule)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(c.Dir, emptyScheduleFile)
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	defer c.FS.Remove(tmp)
+	if err := writeFile(c.FS, tmp, b, c.Config.Trash.FileMode.Perm()); err != nil {
+		return err
+	}
+	if err := c.FS.Rename(tmp, path); err != nil {
+		return err
+	}
+	c.info("%d file(s), %s will be purged %s (at %s), cancel it with gomi empty --cancel",
+		len(files), humanize.Bytes(uint64(size)), c.ago(schedule.Due), schedule.Due.Local().Format("2006-01-02 15:04"))
+	return nil
+}
+
+func (c CLI) cancelEmpty() error {
+	schedule, err := c.emptySchedule()
+	if err != nil {
+		return err
+	}
+	if schedule == nil {
+		return errors.New("no empty is scheduled")
+	}
+	if err := c.FS.Remove(filepath.Join(c.Dir, emptyScheduleFile)); err != nil {
+		return err
+	}
+	c.info("cancelled the empty of %d file(s) scheduled %s", len(schedule.IDs), c.ago(schedule.Due))
+	return nil
+}
+
+// emptySchedule returns the empty scheduled with --grace, or nil if none
+func (c CLI) emptySchedule() (*EmptySchedule, error) {
+	f, err := c.FS.Open(filepath.Join(c.Dir, emptyScheduleFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var schedule EmptySchedule
+	if err := json.NewDecoder(f).Decode(&schedule); err != nil {
+		return nil, fmt.Errorf("%s: %v", emptyScheduleFile, err)
+	}
+	return &schedule, nil
+}
+
+// emptyDue purges the files scheduled by empty --grace once it's due
+// The files restored or pinned since then are kept. The schedule is left
+// if it's interrupted, so that the next run finishes it.
+func (c CLI) emptyDue(ctx context.Context) error {
+	schedule, err := c.emptySchedule()
+	if err != nil || schedule == nil || c.Clock.Now().Before(schedule.Due) {
+		return err
+	}
+	// other gomi may have restored or pinned some of them since loaded
+	if err := c.Inventory.Open(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var files []File
+	for _, id := range schedule.IDs {
+		if file, ok := c.Inventory.Find(id); ok && !file.Pinned {
+			files = append(files, file)
+		}
+	}
+	log.Printf("[INFO] purging %d file(s) scheduled by empty --grace", len(files))
+	// not to mix the list of purged files into the output of the command
+	p := c
+	p.Stdout = ioutil.Discard
+	if err := p.purge(ctx, files, false); err != nil {
+		return err
+	}
+	if err := c.FS.Remove(filepath.Join(c.Dir, emptyScheduleFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.notice("purged %d file(s) scheduled by gomi empty --grace", len(files))
+	return nil
+}
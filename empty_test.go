@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+func TestEmptyKeepsUnsavedPayloads(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	ctx := context.Background()
+	e.CLI.Option.Empty.Force = true
+
+	payload := func(name string, id xid.ID) string {
+		path := filepath.Join(e.CLI.Dir, "2024", "03", "01", id.String(), name+"."+id.String())
+		e.WriteFile(path, name)
+		return path
+	}
+	// left by removing the inventory by hand
+	orphan := payload("orphan.txt", xid.NewWithTime(time.Now().Add(-time.Hour)))
+	// moved by another gomi which hasn't saved it yet
+	id := xid.NewWithTime(time.Now().Add(-time.Hour))
+	moving := payload("moving.txt", id)
+	if err := e.CLI.Journal.Begin(opTrash, File{ID: id.String(), To: moving}); err != nil {
+		t.Fatal(err)
+	}
+	// trashed after empty started
+	recent := payload("recent.txt", xid.NewWithTime(time.Now().Add(time.Minute)))
+
+	if err := e.CLI.Empty(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if e.Exists(orphan) {
+		t.Errorf("%s: orphan not purged", orphan)
+	}
+	if !e.Exists(moving) {
+		t.Errorf("%s: purged while it's being trashed", moving)
+	}
+	if !e.Exists(recent) {
+		t.Errorf("%s: purged though trashed after empty started", recent)
+	}
+}
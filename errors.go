@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+)
+
+// These are the kinds of errors which the callers (and the programs using
+// gomi serve) can branch on with errorKind instead of matching the messages
+var (
+	ErrNotFound      = errors.New("no such file in inventory")
+	ErrConflict      = errors.New("already exists")
+	ErrCrossDevice   = errors.New("cannot move across filesystems")
+	ErrProtectedPath = errors.New("refusing to trash it")
+)
+
+// errorKinds are the names of the kinds in the responses of gomi serve
+var errorKinds = map[error]string{
+	ErrNotFound:      "not_found",
+	ErrConflict:      "conflict",
+	ErrCrossDevice:   "cross_device",
+	ErrProtectedPath: "protected_path",
+}
+
+// Error represents the error of an operation on the path with its kind
+type Error struct {
+	Path string
+	Kind error  // ErrNotFound, ErrConflict, ErrCrossDevice or ErrProtectedPath
+	Err  error  // the cause if any
+	Hint string // how to resolve it, e.g. "unmount it first"
+}
+
+func (e *Error) Error() string {
+	msg := e.Reason()
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	return msg
+}
+
+// Reason returns the message without the path
+func (e *Error) Reason() string {
+	msg := e.Kind.Error()
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.Hint != "" {
+		msg += " (" + e.Hint + ")"
+	}
+	return msg
+}
+
+// Is lets errors.Is match the error with its kind
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// errorKind returns the kind of the error, or nil if it's not typed
+func errorKind(err error) error {
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	return nil
+}
+
+// notFound returns ErrNotFound for the id (or name)
+func notFound(id string) error {
+	return &Error{Path: id, Kind: ErrNotFound}
+}
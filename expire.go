@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// ExpireOption represents the options of expire command
+type ExpireOption struct {
+	In    Duration `long:"in" value-name:"DURATION" description:"Let prune delete the files after the duration from now (e.g. 7d)"`
+	Never bool     `long:"never" description:"Never let prune delete the files"`
+	Reset bool     `long:"reset" description:"Follow the retention policy in config again"`
+}
+
+// Expire sets the expiry of each file which overrides the retention policy
+func (c CLI) Expire(ids []string) error {
+	opt := c.Option.Expire
+	var n int
+	for _, given := range []bool{opt.In > 0, opt.Never, opt.Reset} {
+		if given {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("specify one of --in, --never or --reset")
+	}
+	if len(ids) == 0 {
+		return errors.New("too few arguments")
+	}
+
+	var files []File
+	for _, id := range ids {
+		file, ok := c.Inventory.Find(id)
+		if !ok {
+			return notFound(id)
+		}
+		file.Expires, file.NoExpire = nil, false
+		switch {
+		case opt.In > 0:
+			expires := c.Clock.Now().Add(time.Duration(opt.In))
+			file.Expires = &expires
+		case opt.Never:
+			file.NoExpire = true
+		}
+		files = append(files, file)
+	}
+	if err := c.Inventory.Replace(files...); err != nil {
+		return err
+	}
+	for _, file := range files {
+		switch {
+		case file.Expires != nil:
+			c.info("%s: expires at %s", file.ID, file.Expires.Local().Format("2006-01-02 15:04"))
+		case file.NoExpire:
+			c.info("%s: never expires", file.ID)
+		default:
+			c.info("%s: follows the retention policy", file.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// faultFS injects failures into the filesystem operations for development
+// It's enabled by GOMI_FAULT which is a comma-separated list of rules:
+//
+//	op[:glob][#n][=exit]
+//
+// op is one of rename, write, remove, mkdir, chmod, chtimes, symlink and mknod.
+// glob is matched with the base name of the path (the destination for rename).
+// With #n, only the n-th matching operation fails instead of all of them.
+// With =exit, gomi exits immediately as if it crashed instead of returning an error.
+// e.g. GOMI_FAULT="rename:inventory.json#1,write:*.tmp=exit"
+type faultFS struct {
+	FS
+	rules []*faultRule
+	mu    sync.Mutex
+}
+
+type faultRule struct {
+	op    string
+	glob  string
+	nth   int
+	exit  bool
+	count int
+}
+
+// faultOps are the operations which failures can be injected into
+var faultOps = map[string]bool{
+	"rename": true, "write": true, "remove": true, "mkdir": true,
+	"chmod": true, "chtimes": true, "symlink": true, "mknod": true,
+}
+
+// withFaults wraps the filesystem with faultFS if GOMI_FAULT is set
+func withFaults(fs FS) FS {
+	spec := os.Getenv("GOMI_FAULT")
+	if spec == "" {
+		return fs
+	}
+	f := &faultFS{FS: fs}
+	for _, s := range strings.Split(spec, ",") {
+		rule, err := parseFaultRule(strings.TrimSpace(s))
+		if err != nil {
+			log.Printf("[WARN] GOMI_FAULT: %v", err)
+			continue
+		}
+		f.rules = append(f.rules, rule)
+	}
+	log.Printf("[INFO] GOMI_FAULT: %d rule(s) enabled", len(f.rules))
+	return f
+}
+
+func parseFaultRule(s string) (*faultRule, error) {
+	rule := &faultRule{glob: "*"}
+	if strings.HasSuffix(s, "=exit") {
+		rule.exit = true
+		s = strings.TrimSuffix(s, "=exit")
+	}
+	if i := strings.LastIndex(s, "#"); i >= 0 {
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%q: #n should be a positive number", s)
+		}
+		rule.nth = n
+		s = s[:i]
+	}
+	if i := strings.Index(s, ":"); i >= 0 {
+		rule.glob = s[i+1:]
+		s = s[:i]
+	}
+	if !faultOps[s] {
+		return nil, fmt.Errorf("%q: unknown operation", s)
+	}
+	if _, err := filepath.Match(rule.glob, ""); err != nil {
+		return nil, fmt.Errorf("%q: %v", rule.glob, err)
+	}
+	rule.op = s
+	return rule, nil
+}
+
+// inject returns the error to inject into the operation if any
+func (f *faultFS) inject(op, path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, rule := range f.rules {
+		if rule.op != op {
+			continue
+		}
+		if ok, _ := filepath.Match(rule.glob, filepath.Base(path)); !ok {
+			continue
+		}
+		rule.count++
+		if rule.nth > 0 && rule.count != rule.nth {
+			continue
+		}
+		log.Printf("[DEBUG] GOMI_FAULT: injecting a failure into %s %s", op, path)
+		if rule.exit {
+			os.Exit(137)
+		}
+		return &os.PathError{Op: op, Path: path, Err: fmt.Errorf("injected fault")}
+	}
+	return nil
+}
+
+func (f *faultFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_APPEND|os.O_TRUNC) != 0 {
+		if err := f.inject("write", name); err != nil {
+			return nil, err
+		}
+	}
+	return f.FS.OpenFile(name, flag, perm)
+}
+
+func (f *faultFS) Rename(oldpath, newpath string) error {
+	if err := f.inject("rename", newpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err.(*os.PathError).Err}
+	}
+	return f.FS.Rename(oldpath, newpath)
+}
+
+func (f *faultFS) Remove(name string) error {
+	if err := f.inject("remove", name); err != nil {
+		return err
+	}
+	return f.FS.Remove(name)
+}
+
+func (f *faultFS) RemoveAll(path string) error {
+	if err := f.inject("remove", path); err != nil {
+		return err
+	}
+	return f.FS.RemoveAll(path)
+}
+
+func (f *faultFS) MkdirAll(path string, perm os.FileMode) error {
+	if err := f.inject("mkdir", path); err != nil {
+		return err
+	}
+	return f.FS.MkdirAll(path, perm)
+}
+
+func (f *faultFS) Chmod(name string, mode os.FileMode) error {
+	if err := f.inject("chmod", name); err != nil {
+		return err
+	}
+	return f.FS.Chmod(name, mode)
+}
+
+func (f *faultFS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := f.inject("chtimes", name); err != nil {
+		return err
+	}
+	return f.FS.Chtimes(name, atime, mtime)
+}
+
+func (f *faultFS) Symlink(oldname, newname string) error {
+	if err := f.inject("symlink", newname); err != nil {
+		return err
+	}
+	return f.FS.Symlink(oldname, newname)
+}
+
+func (f *faultFS) Mknod(name string, mode os.FileMode, dev uint64) error {
+	if err := f.inject("mknod", name); err != nil {
+		return err
+	}
+	return f.FS.Mknod(name, mode, dev)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestMain runs gomi instead of the tests in the processes started by Gomi
+func TestMain(m *testing.M) {
+	if os.Getenv("GOMI_TEST_MAIN") == "1" {
+		os.Exit(run("gomi", os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// Gomi runs gomi in another process on the root with GOMI_FAULT, so that
+// it can crash (=exit) without the tests, and returns the exit status
+func (e *testEnv) Gomi(fault string, args ...string) int {
+	e.t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "GOMI_") && !strings.HasPrefix(env, "XDG_") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Env = append(cmd.Env,
+		"GOMI_TEST_MAIN=1",
+		"GOMI_ROOT="+e.root,
+		"GOMI_CONFIG="+e.root+"/no-config.toml",
+		"GOMI_FAULT="+fault,
+		"HOME=/home",
+	)
+	cmd.Dir = e.root
+	err := cmd.Run()
+	if err == nil {
+		return 0
+	}
+	if ee, ok := err.(*exec.ExitError); ok {
+		return ee.ExitCode()
+	}
+	e.t.Fatal(err)
+	return -1
+}
+
+// pending returns the operations left in the journal
+func (e *testEnv) pending() []JournalEntry {
+	e.t.Helper()
+	entries, err := e.CLI.Journal.Pending()
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return entries
+}
+
+func TestRecoverFromCrash(t *testing.T) {
+	tests := []struct {
+		name    string
+		restore bool   // restore the file trashed without faults
+		fault   string // to crash with
+		trashed bool   // the file is in the trash after the recovery
+	}{
+		{"trash: moving the payload", false, "rename:a.txt.*=exit", false},
+		{"trash: saving the inventory", false, "rename:inventory.json=exit", true},
+		{"restore: moving the payload back", true, "rename:a.txt=exit", true},
+		{"restore: saving the inventory", true, "write:inventory.log.jsonl=exit", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			defer e.Close()
+			e.WriteFile("/work/a.txt", "a")
+			args := []string{"/work/a.txt"}
+			if test.restore {
+				if code := e.Gomi("", args...); code != 0 {
+					t.Fatalf("gomi %s: exit status %d", args[0], code)
+				}
+				args = []string{"--restore", "/work/a.txt"}
+			}
+			if code := e.Gomi(test.fault, args...); code != 137 {
+				t.Fatalf("gomi did not crash with GOMI_FAULT=%s (exit status %d)", test.fault, code)
+			}
+			if len(e.pending()) != 1 {
+				t.Fatalf("%d operation(s) in the journal after the crash, want 1", len(e.pending()))
+			}
+
+			// recovered without asking since it's not a terminal
+			if err := e.CLI.Recover(); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(e.pending()); n != 0 {
+				t.Errorf("%d operation(s) left in the journal", n)
+			}
+			e.Reload()
+			switch {
+			case test.trashed && len(e.CLI.Inventory.Files) != 1:
+				t.Fatalf("inventory has %d entries, want 1", len(e.CLI.Inventory.Files))
+			case test.trashed:
+				file := e.CLI.Inventory.Files[0]
+				if e.Exists(file.From) || !e.Exists(file.To) {
+					t.Errorf("%s: not in the trash as %s", file.From, file.To)
+				}
+			default:
+				if n := len(e.CLI.Inventory.Files); n != 0 {
+					t.Errorf("inventory has %d entries, want 0", n)
+				}
+				if got := e.ReadFile("/work/a.txt"); got != "a" {
+					t.Errorf("/work/a.txt = %q, want %q", got, "a")
+				}
+			}
+		})
+	}
+}
+
+// withFault injects the failures into the filesystem of the CLI (see faultFS)
+func (e *testEnv) withFault(spec string) {
+	e.t.Helper()
+	rule, err := parseFaultRule(spec)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	e.CLI.FS = &faultFS{FS: e.CLI.FS, rules: []*faultRule{rule}}
+}
+
+func TestTrashFailure(t *testing.T) {
+	for _, fault := range []string{"rename:a.txt.*", "mkdir"} {
+		t.Run(fault, func(t *testing.T) {
+			e := newTestEnv(t)
+			defer e.Close()
+			e.WriteFile("/work/a.txt", "a")
+			e.withFault(fault)
+			if err := e.CLI.Remove(context.Background(), []string{"/work/a.txt"}); err == nil {
+				t.Fatal("trashed without error")
+			}
+			if got := e.ReadFile("/work/a.txt"); got != "a" {
+				t.Errorf("/work/a.txt = %q, want %q", got, "a")
+			}
+			e.Reload()
+			if n := len(e.CLI.Inventory.Files); n != 0 {
+				t.Errorf("inventory has %d entries, want 0", n)
+			}
+			if n := len(e.pending()); n != 0 {
+				t.Errorf("%d operation(s) left in the journal", n)
+			}
+		})
+	}
+}
+
+func TestRestoreFailure(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	ctx := context.Background()
+	e.WriteFile("/work/a.txt", "a")
+	if err := e.CLI.Remove(ctx, []string{"/work/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	e.Reload()
+	file := e.CLI.Inventory.Files[0]
+
+	e.withFault("rename:a.txt")
+	if err := e.CLI.RestoreByPath(ctx, []string{file.ID}); err == nil {
+		t.Fatal("restored without error")
+	}
+	if e.Exists(file.From) || !e.Exists(file.To) {
+		t.Errorf("%s: not left in the trash as %s", file.From, file.To)
+	}
+	e.Reload()
+	if _, ok := e.CLI.Inventory.Find(file.ID); !ok {
+		t.Errorf("%s: deleted from the inventory", file.ID)
+	}
+	if n := len(e.pending()); n != 0 {
+		t.Errorf("%d operation(s) left in the journal", n)
+	}
+}
+
+func TestPurgeFailure(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	ctx := context.Background()
+	e.WriteFile("/work/a.txt", "a")
+	if err := e.CLI.Remove(ctx, []string{"/work/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	e.Reload()
+	file := e.CLI.Inventory.Files[0]
+
+	e.withFault("remove:a.txt.*")
+	e.CLI.purge(ctx, []File{file}, false)
+	e.Reload()
+	if _, ok := e.CLI.Inventory.Find(file.ID); !ok {
+		t.Errorf("%s: deleted from the inventory though the payload is left", file.ID)
+	}
+	if !e.Exists(file.To) {
+		t.Errorf("%s: payload is removed", file.To)
+	}
+}
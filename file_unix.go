@@ -0,0 +1,90 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// rdev returns the device number of the file if it's a device file
+func rdev(fi os.FileInfo) uint64 {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return uint64(st.Rdev)
+}
+
+// mknod creates the special file (fifo or device)
+func mknod(path string, mode os.FileMode, dev uint64) error {
+	perm := uint32(mode.Perm())
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return syscall.Mkfifo(path, perm)
+	case mode&os.ModeCharDevice != 0:
+		return sysMknod(path, perm|syscall.S_IFCHR, dev)
+	default:
+		return sysMknod(path, perm|syscall.S_IFBLK, dev)
+	}
+}
+
+// flock locks the file exclusively, waiting until it gets the lock
+func flock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// funlock releases the lock by flock
+func funlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// processAlive returns true if the process exists on this host
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// inode returns the device, inode number and the number of hard links of the file
+func inode(fi os.FileInfo) (dev, ino, nlink uint64) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, 0
+	}
+	return uint64(st.Dev), uint64(st.Ino), uint64(st.Nlink)
+}
+
+// writable returns true if the current user can write the file
+// like access(2) with W_OK, judged from the mode and the owner
+func writable(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+	perm := fi.Mode().Perm()
+	uid := os.Geteuid()
+	switch {
+	case uid == 0:
+		return true
+	case int(st.Uid) == uid:
+		return perm&0200 != 0
+	case inGroup(int(st.Gid)):
+		return perm&0020 != 0
+	default:
+		return perm&0002 != 0
+	}
+}
+
+func inGroup(gid int) bool {
+	if gid == os.Getegid() {
+		return true
+	}
+	groups, _ := os.Getgroups()
+	for _, g := range groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// rdev returns the device number of the file if it's a device file
+func rdev(fi os.FileInfo) uint64 {
+	return 0
+}
+
+// mknod creates the special file (fifo or device)
+func mknod(path string, mode os.FileMode, dev uint64) error {
+	return errors.New("special files cannot be created on windows")
+}
+
+// flock locks the file exclusively, waiting until it gets the lock
+func flock(f *os.File) error {
+	return errors.New("flock is not supported on windows")
+}
+
+// funlock releases the lock by flock
+func funlock(f *os.File) error {
+	return nil
+}
+
+// processAlive returns true if the process exists on this host
+// It cannot be checked on windows, so the lock is considered stale only by its age
+func processAlive(pid int) bool {
+	return true
+}
+
+// inode returns the device, inode number and the number of hard links of the file
+// They are not available on windows
+func inode(fi os.FileInfo) (dev, ino, nlink uint64) {
+	return 0, 0, 0
+}
+
+// writable returns true if the file doesn't have the read-only attribute
+func writable(fi os.FileInfo) bool {
+	return fi.Mode().Perm()&0200 != 0
+}
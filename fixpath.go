@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// FixPath corrects the original path of the trashed file recorded in the inventory
+// e.g. when it was deleted via a symlinked directory and the recorded path
+// is not where it should be restored to
+func (c CLI) FixPath(args []string) error {
+	if len(args) != 2 {
+		return errors.New("fix-path <id> <original-path>: two arguments are required")
+	}
+	file, ok := c.Inventory.Find(args[0])
+	if !ok {
+		return notFound(args[0])
+	}
+	from, err := filepath.Abs(expandHome(args[1]))
+	if err != nil {
+		return err
+	}
+	if from == string(filepath.Separator) {
+		return fmt.Errorf("%s: cannot restore to the root", args[1])
+	}
+	log.Printf("[DEBUG] %s: fixing original path %q -> %q", file.ID, file.From, from)
+	old := file.From
+	file.From = from
+	file.Name = filepath.Base(from)
+	if err := c.Inventory.Replace(file); err != nil {
+		return err
+	}
+	c.audit(opFixPath, file)
+	c.info("%s: %s -> %s", file.ID, old, from)
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// forecastWindow is how far back the audit log is read to get the rates
+const forecastWindow = 30 * 24 * time.Hour
+
+// forecastHorizon is the days beyond which the limit is taken as never reached
+const forecastHorizon = 100 * 365
+
+// StatsForecast represents when the trash will reach the limits if the
+// files keep being trashed and purged at the rates in the audit log
+type StatsForecast struct {
+	Since   time.Time  `json:"since"`
+	Size    int64      `json:"size"`
+	Trashed int64      `json:"trashed_per_day"` // bytes
+	Removed int64      `json:"removed_per_day"` // bytes purged, restored or exported
+	Quota   *Milestone `json:"quota,omitempty"`
+	Disk    *Milestone `json:"disk,omitempty"`
+}
+
+// Milestone represents when the trash reaches the limit
+// At is nil if it's never reached at the rates.
+type Milestone struct {
+	Limit    int64      `json:"limit"`
+	Exceeded bool       `json:"exceeded,omitempty"`
+	At       *time.Time `json:"at,omitempty"`
+}
+
+// forecast projects the growth of the trash from the audit log
+func (c CLI) forecast(now time.Time) (StatsForecast, error) {
+	entries, err := c.readAudit()
+	if err != nil {
+		return StatsForecast{}, err
+	}
+	forecast := StatsForecast{Since: now.Add(-forecastWindow), Size: c.stats(now).Size}
+	oldest := now
+	var trashed, removed int64
+	for _, entry := range entries {
+		if entry.Time.Before(forecast.Since) || entry.Time.After(now) {
+			continue
+		}
+		if entry.Time.Before(oldest) {
+			oldest = entry.Time
+		}
+		switch entry.Op {
+		case opTrash, opImport:
+			trashed += entry.Size
+		case opRestore, opPurge, opExport:
+			removed += entry.Size
+		}
+	}
+	// the audit log may be younger than the window
+	if oldest.After(forecast.Since) {
+		forecast.Since = oldest
+	}
+	days := now.Sub(forecast.Since).Hours() / 24
+	if days < 1 {
+		days = 1
+	}
+	forecast.Trashed = int64(float64(trashed) / days)
+	forecast.Removed = int64(float64(removed) / days)
+
+	reach := func(room int64) *Milestone {
+		m := &Milestone{Limit: forecast.Size + room}
+		growth := forecast.Trashed - forecast.Removed
+		switch {
+		case room <= 0:
+			m.Exceeded = true
+		case growth > 0 && room/growth < forecastHorizon:
+			at := now.Add(time.Duration(float64(room) / float64(growth) * float64(24*time.Hour)))
+			m.At = &at
+		}
+		return m
+	}
+	if quota := int64(c.Config.Trash.Quota); quota > 0 {
+		forecast.Quota = reach(quota - forecast.Size)
+		forecast.Quota.Limit = quota
+	}
+	if usage, err := diskFree(c.Dir); err == nil {
+		forecast.Disk = reach(int64(usage.Free))
+	}
+	return forecast, nil
+}
+
+// printForecast prints the forecast for stats --forecast
+func (c CLI) printForecast() error {
+	forecast, err := c.forecast(c.Clock.Now())
+	if err != nil {
+		return err
+	}
+	if c.Option.Stats.JSON {
+		enc := json.NewEncoder(c.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(forecast)
+	}
+	fmt.Fprintf(c.Stdout, "Trash: %s, trashed %s/day, purged or restored %s/day (since %s)\n",
+		humanize.Bytes(uint64(forecast.Size)), humanize.Bytes(uint64(forecast.Trashed)),
+		humanize.Bytes(uint64(forecast.Removed)), forecast.Since.Local().Format("2006-01-02"))
+	for _, limit := range []struct {
+		name string
+		m    *Milestone
+	}{
+		{"Quota", forecast.Quota},
+		{"Disk full", forecast.Disk},
+	} {
+		if limit.m == nil {
+			continue
+		}
+		when := "never at this rate"
+		switch {
+		case limit.m.Exceeded:
+			when = "already"
+		case limit.m.At != nil:
+			when = fmt.Sprintf("%s (%s)", c.ago(*limit.m.At), limit.m.At.Local().Format("2006-01-02"))
+		}
+		fmt.Fprintf(c.Stdout, "%s (%s): %s\n", limit.name, humanize.Bytes(uint64(limit.m.Limit)), when)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FS represents the filesystem operations gomi needs
+// All the operations against the user's files and gomi dir should go through
+// this so that the logic can be exercised against an isolated root
+type FS interface {
+	Lstat(name string) (os.FileInfo, error)
+	Stat(name string) (os.FileInfo, error)
+	Open(name string) (*os.File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (*os.File, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Readlink(name string) (string, error)
+	Symlink(oldname, newname string) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	MkdirAll(path string, perm os.FileMode) error
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Mknod(name string, mode os.FileMode, dev uint64) error
+	Walk(root string, fn filepath.WalkFunc) error
+	// RealPath returns the path on the real filesystem for what cannot be
+	// done through FS (e.g. listening on unix sockets)
+	RealPath(name string) string
+}
+
+// newFS returns the filesystem to operate on
+// If GOMI_ROOT is set (e.g. to a temp dir in CI), all the paths are
+// resolved under the directory instead of the real root
+// If GOMI_FAULT is set, failures are injected into it (see faultFS)
+func newFS() FS {
+	if root := os.Getenv("GOMI_ROOT"); root != "" {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		return withFaults(rootFS{Root: root})
+	}
+	return withFaults(osFS{})
+}
+
+// osFS is the real filesystem
+type osFS struct{}
+
+func (osFS) Lstat(name string) (os.FileInfo, error) { return os.Lstat(name) }
+func (osFS) Stat(name string) (os.FileInfo, error)  { return os.Stat(name) }
+func (osFS) Open(name string) (*os.File, error)     { return os.Open(name) }
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+func (osFS) ReadDir(name string) ([]os.FileInfo, error)   { return ioutil.ReadDir(name) }
+func (osFS) Readlink(name string) (string, error)         { return os.Readlink(name) }
+func (osFS) Symlink(oldname, newname string) error        { return os.Symlink(oldname, newname) }
+func (osFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+func (osFS) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (osFS) Chmod(name string, mode os.FileMode) error    { return os.Chmod(name, mode) }
+func (osFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+func (osFS) Mknod(name string, mode os.FileMode, dev uint64) error {
+	return mknod(name, mode, dev)
+}
+func (osFS) Walk(root string, fn filepath.WalkFunc) error { return filepath.Walk(root, fn) }
+func (osFS) RealPath(name string) string                  { return name }
+
+// rootFS is the filesystem which treats Root as "/"
+// Relative paths are resolved from the current directory first
+// and then placed under Root as well
+type rootFS struct {
+	Root string
+}
+
+func (r rootFS) path(name string) string {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		abs = name
+	}
+	return filepath.Join(r.Root, abs)
+}
+
+func (r rootFS) Lstat(name string) (os.FileInfo, error) { return os.Lstat(r.path(name)) }
+func (r rootFS) Stat(name string) (os.FileInfo, error)  { return os.Stat(r.path(name)) }
+func (r rootFS) Open(name string) (*os.File, error)     { return os.Open(r.path(name)) }
+func (r rootFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(r.path(name), flag, perm)
+}
+func (r rootFS) ReadDir(name string) ([]os.FileInfo, error) { return ioutil.ReadDir(r.path(name)) }
+func (r rootFS) Readlink(name string) (string, error)       { return os.Readlink(r.path(name)) }
+func (r rootFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, r.path(newname))
+}
+func (r rootFS) Rename(oldpath, newpath string) error {
+	return os.Rename(r.path(oldpath), r.path(newpath))
+}
+func (r rootFS) Remove(name string) error    { return os.Remove(r.path(name)) }
+func (r rootFS) RemoveAll(path string) error { return os.RemoveAll(r.path(path)) }
+func (r rootFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(r.path(path), perm)
+}
+func (r rootFS) Chmod(name string, mode os.FileMode) error { return os.Chmod(r.path(name), mode) }
+func (r rootFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(r.path(name), atime, mtime)
+}
+func (r rootFS) Mknod(name string, mode os.FileMode, dev uint64) error {
+	return mknod(r.path(name), mode, dev)
+}
+
+func (r rootFS) RealPath(name string) string { return r.path(name) }
+
+// Walk walks the file tree under Root but passes the paths seen from Root
+func (r rootFS) Walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(r.path(root), func(path string, fi os.FileInfo, err error) error {
+		path = string(filepath.Separator) + strings.TrimPrefix(strings.TrimPrefix(path, r.Root), string(filepath.Separator))
+		return fn(path, fi, err)
+	})
+}
+
+// splitExt splits the file name into the base and the extension
+// The leading dot of hidden files (e.g. ".bashrc") is not an extension
+// and compressed tarballs have the double extension (e.g. ".tar.gz")
+func splitExt(name string) (base, ext string) {
+	ext = filepath.Ext(strings.TrimLeft(name, "."))
+	if ext == "." {
+		ext = ""
+	}
+	base = strings.TrimSuffix(name, ext)
+	if ext != "" && strings.HasSuffix(base, ".tar") && base != ".tar" {
+		base, ext = strings.TrimSuffix(base, ".tar"), ".tar"+ext
+	}
+	return base, ext
+}
+
+// nameLess sorts the file names like ls(1) in most locales:
+// case-insensitively and ignoring the leading dot of hidden files
+func nameLess(a, b string) bool {
+	ka := strings.ToLower(strings.TrimPrefix(a, "."))
+	kb := strings.ToLower(strings.TrimPrefix(b, "."))
+	if ka != kb {
+		return ka < kb
+	}
+	return a < b
+}
+
+// syncDir flushes the directory entries (e.g. renamed files) to disk
+func syncDir(fs FS, dir string) error {
+	d, err := fs.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// caseInsensitive returns true if the filesystem of the directory
+// ignores the case of filenames (e.g. APFS and HFS+ on macOS by default)
+// It's detected by creating a probe file in the nearest existing directory
+func caseInsensitive(fs FS, dir string) bool {
+	for {
+		if fi, err := fs.Stat(dir); err == nil && fi.IsDir() {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+	probe := filepath.Join(dir, fmt.Sprintf(".gomi-case-probe.%d", os.Getpid()))
+	f, err := fs.OpenFile(probe, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Printf("[DEBUG] %s: cannot detect case sensitivity: %v", dir, err)
+		return false
+	}
+	f.Close()
+	defer fs.Remove(probe)
+	_, err = fs.Lstat(filepath.Join(dir, strings.ToUpper(filepath.Base(probe))))
+	return err == nil
+}
+
+// actualPath returns the path stored in the filesystem which the given path refers to
+// It differs from the given one only in case on case-insensitive filesystems
+func actualPath(fs FS, path string) string {
+	entries, err := fs.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return path
+	}
+	base := filepath.Base(path)
+	for _, entry := range entries {
+		if entry.Name() == base {
+			return path
+		}
+	}
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name(), base) {
+			return filepath.Join(filepath.Dir(path), entry.Name())
+		}
+	}
+	return path
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// testNow is the time the tests run at (see fixedClock)
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// testEnv is gomi working on a temp dir as the root (see rootFS)
+// gomi dir is /home/.gomi in it as if HOME is /home, and the paths in the
+// tests are seen from the root.
+type testEnv struct {
+	t    testing.TB
+	root string // the real path of "/"
+	CLI  CLI
+}
+
+func newTestEnv(t testing.TB) *testEnv {
+	t.Helper()
+	log.SetOutput(ioutil.Discard)
+	root, err := ioutil.TempDir("", "gomi-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := rootFS{Root: root}
+	dir := "/home/" + gomiDir
+	lock := &Lock{Dir: dir, Strategy: lockAuto, Mode: 0600, FS: fs}
+	var stdout, stderr bytes.Buffer
+	return &testEnv{
+		t:    t,
+		root: root,
+		CLI: CLI{
+			Config:    defaultConfig(),
+			Dir:       dir,
+			FS:        fs,
+			Clock:     fixedClock(testNow),
+			Inventory: &Inventory{Path: filepath.Join(dir, inventoryFile), Mode: 0600, Lock: lock, FS: fs},
+			Journal:   &Journal{Path: filepath.Join(dir, journalFile), Mode: 0600, Lock: lock, FS: fs},
+			Stdin:     &bytes.Buffer{},
+			Stdout:    &stdout,
+			Stderr:    &stderr,
+		},
+	}
+}
+
+func (e *testEnv) Close() {
+	os.RemoveAll(e.root)
+}
+
+// Stdout returns what has been printed so far
+func (e *testEnv) Stdout() string {
+	return e.CLI.Stdout.(*bytes.Buffer).String()
+}
+
+// WriteFile creates the file at path (seen from the root) with the parents
+func (e *testEnv) WriteFile(path, content string) {
+	e.t.Helper()
+	if err := e.CLI.FS.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		e.t.Fatal(err)
+	}
+	if err := writeFile(e.CLI.FS, path, []byte(content), 0644); err != nil {
+		e.t.Fatal(err)
+	}
+}
+
+// ReadFile returns the content of the file, or fails if it doesn't exist
+func (e *testEnv) ReadFile(path string) string {
+	e.t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(e.root, path))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return string(b)
+}
+
+// Exists returns true if the path exists (without following symlinks)
+func (e *testEnv) Exists(path string) bool {
+	_, err := e.CLI.FS.Lstat(path)
+	return err == nil
+}
+
+// Reload reads the inventory again as a new gomi process would
+func (e *testEnv) Reload() {
+	e.t.Helper()
+	e.CLI.Inventory.Files = nil
+	if err := e.CLI.Inventory.Open(); err != nil && !os.IsNotExist(err) {
+		e.t.Fatal(err)
+	}
+}
+
+// Golden compares got with testdata/<name>.golden (written with -update)
+func (e *testEnv) Golden(name, got string) {
+	e.t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			e.t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if got != string(want) {
+		e.t.Errorf("%s differs from %s:\n%s", name, path, got)
+	}
+}
+
+var xidPattern = regexp.MustCompile(`\b[0-9a-v]{20}\b`)
+
+func TestRemoveAndRestore(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	ctx := context.Background()
+
+	e.WriteFile("/work/a.txt", "a")
+	e.WriteFile("/work/dir/b.txt", "b")
+	if err := e.CLI.Remove(ctx, []string{"/work/a.txt", "/work/dir"}); err != nil {
+		t.Fatal(err)
+	}
+	e.Reload()
+	if n := len(e.CLI.Inventory.Files); n != 2 {
+		t.Fatalf("inventory has %d entries, want 2", n)
+	}
+	for _, file := range e.CLI.Inventory.Files {
+		if e.Exists(file.From) {
+			t.Errorf("%s: still exists after trashing", file.From)
+		}
+		if !isUnder(file.To, e.CLI.Dir) || !e.Exists(file.To) {
+			t.Errorf("%s: payload is not in gomi dir: %s", file.From, file.To)
+		}
+	}
+
+	if err := e.CLI.RestoreByPath(ctx, []string{"/work/a.txt", "/work/dir"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.ReadFile("/work/a.txt"); got != "a" {
+		t.Errorf("/work/a.txt = %q, want %q", got, "a")
+	}
+	if got := e.ReadFile("/work/dir/b.txt"); got != "b" {
+		t.Errorf("/work/dir/b.txt = %q, want %q", got, "b")
+	}
+	e.Reload()
+	if n := len(e.CLI.Inventory.Files); n != 0 {
+		t.Errorf("inventory has %d entries after restoring, want 0", n)
+	}
+}
+
+func TestRestoreConflict(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	ctx := context.Background()
+
+	e.WriteFile("/work/a.txt", "old")
+	if err := e.CLI.Remove(ctx, []string{"/work/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	e.WriteFile("/work/a.txt", "new")
+	e.Reload()
+	id := e.CLI.Inventory.Files[0].ID
+	if err := e.CLI.RestoreByPath(ctx, []string{id}); err != nil {
+		t.Fatal(err)
+	}
+	// not interactive, so it's restored next to the existing one
+	if got := e.ReadFile("/work/a.txt"); got != "new" {
+		t.Errorf("/work/a.txt = %q, want %q (overwritten)", got, "new")
+	}
+	if got := e.ReadFile("/work/a.restored-" + id + ".txt"); got != "old" {
+		t.Errorf("restored file = %q, want %q", got, "old")
+	}
+}
+
+func TestList(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	ctx := context.Background()
+
+	e.WriteFile("/work/a.txt", "aaa")
+	e.WriteFile("/work/b.txt", "b")
+	if err := e.CLI.Remove(ctx, []string{"/work/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	e.CLI.Clock = fixedClock(testNow.Add(time.Hour))
+	if err := e.CLI.Remove(ctx, []string{"/work/b.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	e.CLI.Clock = fixedClock(testNow.Add(2 * time.Hour))
+	e.Reload()
+	if err := e.CLI.List(); err != nil {
+		t.Fatal(err)
+	}
+	e.Golden("list", xidPattern.ReplaceAllString(e.Stdout(), "<id>                "))
+}
+
+func TestSplitExt(t *testing.T) {
+	tests := []struct {
+		name, base, ext string
+	}{
+		{"report.pdf", "report", ".pdf"},
+		{"Makefile", "Makefile", ""},
+		{"app.min.js", "app.min", ".js"},
+		{"backup.tar.gz", "backup", ".tar.gz"},
+		{"backup.tar.zst", "backup", ".tar.zst"},
+		{"backup.tar", "backup", ".tar"},
+		{".env", ".env", ""},
+		{".bashrc.bak", ".bashrc", ".bak"},
+		{".tar.gz", ".tar", ".gz"},
+		{"..hidden", "..hidden", ""},
+		{"v1.2.3", "v1.2", ".3"},
+	}
+	for _, test := range tests {
+		base, ext := splitExt(test.name)
+		if base != test.base || ext != test.ext {
+			t.Errorf("splitExt(%q) = %q, %q, want %q, %q", test.name, base, ext, test.base, test.ext)
+		}
+	}
+}
+
+func TestNameLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"a.txt", "b.txt", true},
+		{"B.txt", "a.txt", false}, // case-insensitively
+		{"a.txt", "B.txt", true},
+		{".bashrc", "zsh", true}, // ignoring the leading dot
+		{"bin", ".config", true},
+		{".env", "env", true}, // the hidden one first if the same otherwise
+		{"env", ".env", false},
+		{"File", "file", true},
+		{"file10", "file2", true}, // not numerically, like ls without -v
+		{"file2", "file10", false},
+		{"a.b.c", "a.b", false},
+	}
+	for _, test := range tests {
+		if got := nameLess(test.a, test.b); got != test.want {
+			t.Errorf("nameLess(%q, %q) = %t, want %t", test.a, test.b, got, test.want)
+		}
+	}
+}
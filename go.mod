@@ -3,12 +3,15 @@ module github.com/b4b4r07/gomi
 go 1.12
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/b4b4r07/go-cli-log v0.0.0-20200124120248-8fac4d71de01
 	github.com/dustin/go-humanize v1.0.0
 	github.com/gabriel-vasile/mimetype v1.0.2
 	github.com/jessevdk/go-flags v1.4.0
+	github.com/klauspost/compress v1.9.8
 	github.com/manifoldco/promptui v0.7.0
 	github.com/mattn/go-colorable v0.1.4 // indirect
+	github.com/mattn/go-runewidth v0.0.9
 	github.com/rs/xid v1.2.1
 	golang.org/x/crypto v0.0.0-20200117160349-530e935923ad
 	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// guard asks for the typed confirmation when the files to trash at once
+// are more than the limits in config, to protect from e.g. "gomi *"
+// in the wrong directory. It's skipped with -f.
+func (c CLI) guard(args []string) error {
+	what, err := c.overLimits(args)
+	if err != nil || what == "" {
+		return err
+	}
+	dir, _ := os.Getwd()
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("refusing to trash %s in %s without confirmation (use -f to force)", what, dir)
+	}
+	fmt.Fprintf(c.Stderr, "gomi: about to trash %s in %s\nType \"yes\" to continue: ", what, dir)
+	answer, _ := bufio.NewReader(c.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != "yes" {
+		return errors.New("aborted")
+	}
+	return nil
+}
+
+// overLimits returns what is over the limits of guard (e.g. "more than 100
+// files") if the files are, or "" if not
+func (c CLI) overLimits(args []string) (string, error) {
+	cfg := c.Config.Guard
+	if cfg.MaxFiles == 0 && cfg.MaxSize == 0 {
+		return "", nil
+	}
+	var total usage
+	over := func(u usage) bool {
+		return cfg.MaxFiles > 0 && total.Count+u.Count > int64(cfg.MaxFiles) ||
+			cfg.MaxSize > 0 && total.Size+u.Size > int64(cfg.MaxSize)
+	}
+	for _, arg := range args {
+		// no need to count all of them once over the limits
+		u, err := measure(context.Background(), c.FS, arg, over)
+		if err != nil {
+			return "", err
+		}
+		if over(u) {
+			total.Count += u.Count
+			total.Size += u.Size
+			break
+		}
+		if abs, err := filepath.Abs(arg); err == nil {
+			// not to measure it again for the inventory entry
+			cacheUsage(abs, u)
+		}
+		total.Count += u.Count
+		total.Size += u.Size
+	}
+	if !over(usage{}) {
+		return "", nil
+	}
+	if cfg.MaxFiles == 0 || total.Count <= int64(cfg.MaxFiles) {
+		return fmt.Sprintf("more than %s", humanize.Bytes(uint64(cfg.MaxSize))), nil
+	}
+	return fmt.Sprintf("more than %d files", cfg.MaxFiles), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// setGomiPath changes gomi dir and the paths of the files in it
+func setGomiPath(dir string) {
+	gomiPath = dir
+	inventoryPath = filepath.Join(gomiPath, inventoryFile)
+	journalPath = filepath.Join(gomiPath, journalFile)
+}
+
+// gomiHome returns gomi dir given by GOMI_HOME or trash.dir in config
+// e.g. a mounted volume in containers where HOME is ephemeral
+// It's empty if neither is given (~/.gomi).
+func gomiHome(cfg Config) string {
+	dir := os.Getenv("GOMI_HOME")
+	if dir == "" {
+		dir = cfg.Trash.Dir
+	}
+	if dir == "" {
+		return ""
+	}
+	dir = expandHome(dir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return dir
+}
+
+// inContainer returns true if gomi is running in a container such as docker, podman or kubernetes
+func inContainer() bool {
+	for _, path := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	b, err := ioutil.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	for _, name := range []string{"docker", "kubepods", "containerd", "lxc", "libpod"} {
+		if strings.Contains(string(b), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ephemeralTrash returns true if gomi dir (dir) is on the writable layer of the
+// container (overlayfs upperdir), which vanishes with the container
+func ephemeralTrash(dir string) bool {
+	if !inContainer() {
+		return false
+	}
+	// gomi dir may not be created yet
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+	ok := overlayFS(dir)
+	log.Printf("[DEBUG] in container, %s is on overlayfs: %t", dir, ok)
+	return ok
+}
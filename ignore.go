@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const ignoreFile = ".gomiignore"
+
+// These are the actions for the files matched with .gomiignore
+const (
+	ignoreRefuse = "refuse" // do not delete it
+	ignoreDelete = "delete" // delete it permanently without trashing
+)
+
+// ignoreRule is a pattern line in .gomiignore (gitignore syntax)
+type ignoreRule struct {
+	base    string // directory which has .gomiignore
+	pattern string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// loadIgnoreFile reads the rules from dir/.gomiignore if exists
+func loadIgnoreFile(fs FS, dir string) []ignoreRule {
+	f, err := fs.Open(filepath.Join(dir, ignoreFile))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var rules []ignoreRule
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: dir, pattern: line}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		re, err := compileIgnorePattern(line)
+		if err != nil {
+			log.Printf("[WARN] %s: invalid pattern %q: %v", filepath.Join(dir, ignoreFile), rule.pattern, err)
+			continue
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// compileIgnorePattern converts gitignore pattern to regexp
+// which matches the slash-separated path relative to .gomiignore
+func compileIgnorePattern(pattern string) (*regexp.Regexp, error) {
+	// the pattern which has a slash at the beginning or middle
+	// is relative to the directory, otherwise it matches at any level
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			b.WriteString("/.*")
+			i += 2
+		case ch == '*':
+			b.WriteString("[^/]*")
+		case ch == '?':
+			b.WriteString("[^/]")
+		case ch == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta(string(ch)))
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// match returns true if the rule matches the path (absolute)
+func (r ignoreRule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(r.base, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return r.re.MatchString(filepath.ToSlash(rel))
+}
+
+// ignoreRules returns the rules of .gomiignore in the ancestors of the path
+// The rules in the deeper directory take precedence
+func (c CLI) ignoreRules(path string) []ignoreRule {
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	var rules []ignoreRule
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rules = append(rules, loadIgnoreFile(c.FS, dirs[i])...)
+	}
+	return rules
+}
+
+// ignored returns the rule which the path matches finally
+// The path is also ignored when its parent directory is ignored
+func ignored(rules []ignoreRule, path string, isDir bool) (ignoreRule, bool) {
+	var matched ignoreRule
+	var ok bool
+	for _, rule := range rules {
+		for p, dir := path, isDir; ; p, dir = filepath.Dir(p), true {
+			if !isUnder(p, rule.base) || p == rule.base {
+				break
+			}
+			if rule.match(p, dir) {
+				matched, ok = rule, !rule.negate
+				break
+			}
+		}
+	}
+	return matched, ok
+}
+
+// applyIgnore handles the file to trash based on .gomiignore
+// It returns true if the file should not be trashed
+func (c CLI) applyIgnore(path string, fi os.FileInfo) (bool, error) {
+	rules := c.ignoreRules(path)
+	rule, ok := ignored(rules, path, fi.IsDir())
+	if ok {
+		return true, c.ignore(path, rule)
+	}
+	if !fi.IsDir() || c.Config.Ignore.Action != ignoreDelete {
+		return false, nil
+	}
+	// delete the contents matched with the rules (e.g. node_modules)
+	// before trashing the directory
+	// The mount points left in place by --one-file-system are not touched.
+	rules = append(rules, loadIgnoreFile(c.FS, path)...)
+	dev, _, _ := inode(fi)
+	var targets []string
+	c.FS.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || p == path {
+			return nil
+		}
+		if d, _, _ := inode(fi); fi.IsDir() && d != dev {
+			return filepath.SkipDir
+		}
+		if fi.IsDir() {
+			rules = append(rules, loadIgnoreFile(c.FS, p)...)
+		}
+		if _, ok := ignored(rules, p, fi.IsDir()); ok {
+			targets = append(targets, p)
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	for _, target := range targets {
+		if err := c.FS.RemoveAll(target); err != nil {
+			return false, err
+		}
+		c.verbose("removed %s permanently (%s)", target, ignoreFile)
+	}
+	return false, nil
+}
+
+func (c CLI) ignore(path string, rule ignoreRule) error {
+	src := filepath.Join(rule.base, ignoreFile)
+	switch c.Config.Ignore.Action {
+	case ignoreDelete:
+		log.Printf("[INFO] %s: deleting permanently (matched %q in %s)", path, rule.pattern, src)
+		if err := c.FS.RemoveAll(path); err != nil {
+			return err
+		}
+		c.verbose("removed %s permanently (%s)", path, ignoreFile)
+		return nil
+	default:
+		return fmt.Errorf("%s: refused to delete (matched %q in %s)", path, rule.pattern, src)
+	}
+}
+
+// verbose prints the message when -v is given like rm -v
+func (c CLI) verbose(format string, args ...interface{}) {
+	if c.Option.RmOption.Verbose {
+		fmt.Fprintf(c.Stdout, format+"\n", args...)
+	}
+}
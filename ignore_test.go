@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string // lines of /proj/.gomiignore
+		path    string   // relative to /proj
+		isDir   bool
+		ignored bool
+	}{
+		// unanchored patterns match at any level
+		{"name", []string{"*.log"}, "app.log", false, true},
+		{"name in subdir", []string{"*.log"}, "logs/app.log", false, true},
+		{"star stops at slash", []string{"a*b"}, "a/b", false, false},
+		{"question", []string{"?.txt"}, "a.txt", false, true},
+		{"question stops at slash", []string{"a?b"}, "a/b", false, false},
+		{"no match", []string{"*.log"}, "app.txt", false, false},
+
+		// anchored to the directory of .gomiignore
+		{"leading slash", []string{"/build"}, "build", true, true},
+		{"leading slash in subdir", []string{"/build"}, "src/build", true, false},
+		{"middle slash", []string{"doc/*.md"}, "doc/a.md", false, true},
+		{"middle slash in subdir", []string{"doc/*.md"}, "src/doc/a.md", false, false},
+		{"middle slash deeper", []string{"doc/*.md"}, "doc/sub/a.md", false, false},
+
+		// double asterisks
+		{"leading **/", []string{"**/tmp"}, "tmp", true, true},
+		{"leading **/ deeper", []string{"**/tmp"}, "a/b/tmp", true, true},
+		{"middle /**/", []string{"a/**/b"}, "a/b", false, true},
+		{"middle /**/ deeper", []string{"a/**/b"}, "a/x/y/b", false, true},
+		{"middle /**/ other", []string{"a/**/b"}, "c/x/b", false, false},
+		{"trailing /**", []string{"cache/**"}, "cache/a/b.bin", false, true},
+		{"trailing /** not the dir", []string{"cache/**"}, "cache", true, false},
+
+		// directories only
+		{"dir/", []string{"node_modules/"}, "node_modules", true, true},
+		{"dir/ in subdir", []string{"node_modules/"}, "web/node_modules", true, true},
+		{"dir/ not file", []string{"node_modules/"}, "node_modules", false, false},
+		{"anchored dir/", []string{"/out/"}, "src/out", true, false},
+
+		// matches through parent directories
+		{"under ignored dir", []string{"node_modules/"}, "node_modules/dep/index.js", false, true},
+		{"under ignored name", []string{"build"}, "src/build/a.o", false, true},
+
+		// negation
+		{"negated", []string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{"negated others", []string{"*.log", "!keep.log"}, "app.log", false, true},
+		{"negated then again", []string{"*.log", "!keep.log", "keep.log"}, "keep.log", false, true},
+		{"negation before pattern", []string{"!keep.log", "*.log"}, "keep.log", false, true},
+
+		// escapes and comments
+		{"escaped !", []string{`\!important`}, "!important", false, true},
+		{"escaped ! not negation", []string{"*.txt", `\!keep.txt`}, "keep.txt", false, true},
+		{"escaped #", []string{`\#notes`}, "#notes", false, true},
+		{"comment", []string{"#notes"}, "#notes", false, false},
+		{"trailing spaces", []string{"*.log  "}, "app.log", false, true},
+
+		// character classes
+		{"class", []string{"[ab].txt"}, "a.txt", false, true},
+		{"class no match", []string{"[ab].txt"}, "c.txt", false, false},
+		{"range", []string{"file[0-9]"}, "file7", false, true},
+		{"negated class", []string{"[!a].txt"}, "b.txt", false, true},
+		{"negated class no match", []string{"[!a].txt"}, "a.txt", false, false},
+		{"unclosed class", []string{"[ab"}, "[ab", false, true},
+
+		// the regexp metacharacters are literal
+		{"dot", []string{"a.txt"}, "abtxt", false, false},
+		{"plus", []string{"c++"}, "c++", true, true},
+	}
+	for _, test := range tests {
+		e := newTestEnv(t)
+		e.WriteFile("/proj/"+ignoreFile, strings.Join(test.rules, "\n")+"\n")
+		rules := loadIgnoreFile(e.CLI.FS, "/proj")
+		_, ok := ignored(rules, "/proj/"+test.path, test.isDir)
+		if ok != test.ignored {
+			t.Errorf("%s: %q ignores %s = %t, want %t", test.name, test.rules, test.path, ok, test.ignored)
+		}
+		e.Close()
+	}
+}
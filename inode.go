@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// originDev returns the device of the filesystem where the file would be restored
+// It's the device of the nearest existing parent of the original path
+func (c CLI) originDev(file File) (uint64, bool) {
+	for dir := filepath.Dir(file.From); ; dir = filepath.Dir(dir) {
+		if fi, err := c.FS.Lstat(dir); err == nil {
+			dev, _, _ := inode(fi)
+			return dev, dev != 0
+		}
+		if dir == filepath.Dir(dir) {
+			return 0, false
+		}
+	}
+}
+
+// originChanged returns true if the filesystem of the original path
+// is different from the one where the file was deleted from
+// (e.g. the disk is replaced or the directory is mounted from elsewhere)
+func (c CLI) originChanged(file File) bool {
+	if file.Dev == 0 {
+		// deleted by the older version or on windows
+		return false
+	}
+	dev, ok := c.originDev(file)
+	return ok && dev != file.Dev
+}
+
+// hardLinks returns the groups of the entries which were hard links
+// of the same file (or the same file seen via bind mounts)
+func hardLinks(files []File) [][]File {
+	var keys []string
+	groups := map[string][]File{}
+	for _, file := range files {
+		if file.ID == "" || file.Ino == 0 || file.Type == typeDir {
+			continue
+		}
+		key := fmt.Sprintf("%d:%d", file.Dev, file.Ino)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], file)
+	}
+	var result [][]File
+	for _, key := range keys {
+		if group := groups[key]; len(group) > 1 {
+			sort.Slice(group, func(i, j int) bool {
+				return group[i].Timestamp.Before(group[j].Timestamp)
+			})
+			result = append(result, group)
+		}
+	}
+	return result
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IntegrateOption represents the options of integrate command
+type IntegrateOption struct {
+	Nautilus  bool `long:"nautilus" description:"Add \"Move to gomi\" to the scripts of Nautilus (GNOME Files)"`
+	Dolphin   bool `long:"dolphin" description:"Add \"Move to gomi\" to the service menu of Dolphin (KDE)"`
+	Finder    bool `long:"finder" description:"Add \"Move to gomi\" to the quick actions of Finder (macOS)"`
+	Uninstall bool `long:"uninstall" description:"Remove what was installed instead"`
+}
+
+// integrateMarker is written in the files installed by integrate command
+// not to overwrite or remove the ones made by the user
+const integrateMarker = "installed by gomi integrate"
+
+// integrateName is the name of the menu item in the file managers
+const integrateName = "Move to gomi"
+
+// integration is a file which a file manager reads to show the menu item
+type integration struct {
+	path string
+	data []byte
+	mode os.FileMode
+}
+
+// Integrate installs the menu items of the file managers which trash the
+// selected files with gomi, so that the files deleted from the GUI are in
+// the same trash and inventory as the ones deleted on the command line
+// The errors are shown in the desktop notification (or a dialog) since the
+// file managers don't show the output.
+func (c CLI) Integrate() error {
+	opt := c.Option.Integrate
+	// not resolving the symlinks, which keeps working after upgrades moving
+	// the real binary (e.g. into another version directory of Homebrew)
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var files []integration
+	if opt.Nautilus {
+		files = append(files, integration{
+			path: filepath.Join(xdgDataHome(), "nautilus", "scripts", integrateName),
+			data: []byte(trashScript(exe)),
+			mode: 0755,
+		})
+	}
+	if opt.Dolphin {
+		// the service menu runs the script since Exec cannot redirect the errors
+		script := filepath.Join(xdgDataHome(), "gomi", "trash.sh")
+		files = append(files, integration{path: script, data: []byte(trashScript(exe)), mode: 0755})
+		files = append(files, integration{
+			path: filepath.Join(xdgDataHome(), "kio", "servicemenus", "gomi.desktop"),
+			data: []byte(dolphinServiceMenu(script)),
+			mode: 0755, // KDE requires it to be executable
+		})
+	}
+	if opt.Finder {
+		dir := filepath.Join(os.Getenv("HOME"), "Library", "Services", integrateName+".workflow", "Contents")
+		files = append(files,
+			integration{path: filepath.Join(dir, "Info.plist"), data: []byte(finderInfo()), mode: 0644},
+			integration{path: filepath.Join(dir, "document.wflow"), data: []byte(finderWorkflow(exe)), mode: 0644},
+		)
+	}
+	if len(files) == 0 {
+		return errors.New("integrate: choose --nautilus, --dolphin or --finder")
+	}
+
+	for _, file := range files {
+		if err := c.checkIntegration(file.path); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		if opt.Uninstall {
+			err := c.FS.Remove(file.path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			c.info("removed %s", file.path)
+			continue
+		}
+		if err := c.FS.MkdirAll(filepath.Dir(file.path), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(c.FS, file.path, file.data, file.mode); err != nil {
+			return err
+		}
+		// the mode of the existing file is not changed by writing it
+		if err := c.FS.Chmod(file.path, file.mode); err != nil {
+			return err
+		}
+		c.info("installed %s", file.path)
+	}
+	if opt.Finder && opt.Uninstall {
+		// the bundle of the workflow (only removed if empty)
+		contents := filepath.Dir(files[len(files)-1].path)
+		c.FS.Remove(contents)
+		c.FS.Remove(filepath.Dir(contents))
+	}
+	if opt.Finder && !opt.Uninstall {
+		c.notice("enable %q in System Settings > Keyboard > Keyboard Shortcuts > Services if it's not shown", integrateName)
+	}
+	return nil
+}
+
+// checkIntegration returns an error if the file exists but is not
+// installed by integrate command
+func (c CLI) checkIntegration(path string) error {
+	f, err := c.FS.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(b, []byte(integrateMarker)) {
+		return fmt.Errorf("%s: already exists and not installed by gomi, leaving it as it is", path)
+	}
+	return nil
+}
+
+// xdgDataHome returns $XDG_DATA_HOME (~/.local/share by default)
+func xdgDataHome() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "share")
+}
+
+// trashScript returns the script which trashes the files given as the
+// arguments (Nautilus runs the scripts with the selected files)
+func trashScript(exe string) string {
+	return `#!/bin/sh
+# ` + integrateMarker + `: moves the selected files to gomi
+out=$(` + shellQuote(exe) + ` -- "$@" 2>&1) && exit 0
+if command -v notify-send >/dev/null 2>&1; then
+	notify-send -i user-trash gomi "$out"
+elif command -v kdialog >/dev/null 2>&1; then
+	kdialog --error "$out"
+fi
+exit 1
+`
+}
+
+func dolphinServiceMenu(script string) string {
+	return `# ` + integrateMarker + `
+[Desktop Entry]
+Type=Service
+MimeType=all/all;
+Actions=gomiTrash;
+X-KDE-Priority=TopLevel
+
+[Desktop Action gomiTrash]
+Name=` + integrateName + `
+Icon=user-trash
+Exec="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", "$", `\$`).Replace(script) + `" %F
+`
+}
+
+// finderInfo returns Info.plist of the quick action shown for files in Finder
+func finderInfo() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!-- ` + integrateMarker + ` -->
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>NSServices</key>
+	<array>
+		<dict>
+			<key>NSMenuItem</key>
+			<dict>
+				<key>default</key>
+				<string>` + integrateName + `</string>
+			</dict>
+			<key>NSMessage</key>
+			<string>runWorkflowAsService</string>
+			<key>NSRequiredContext</key>
+			<dict>
+				<key>NSApplicationIdentifier</key>
+				<string>com.apple.finder</string>
+			</dict>
+			<key>NSSendFileTypes</key>
+			<array>
+				<string>public.item</string>
+			</array>
+		</dict>
+	</array>
+</dict>
+</plist>
+`
+}
+
+// finderWorkflow returns the Automator workflow running gomi with the
+// selected files as the arguments of "Run Shell Script"
+func finderWorkflow(exe string) string {
+	script := `out=$(` + shellQuote(exe) + ` -- "$@" 2>&1) || osascript -e 'on run argv' -e 'display alert "gomi" message (item 1 of argv)' -e 'end run' "$out"`
+	var command bytes.Buffer
+	xml.EscapeText(&command, []byte(script))
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!-- ` + integrateMarker + ` -->
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>AMApplicationBuild</key>
+	<string>521</string>
+	<key>AMApplicationVersion</key>
+	<string>2.10</string>
+	<key>AMDocumentVersion</key>
+	<string>2</string>
+	<key>actions</key>
+	<array>
+		<dict>
+			<key>action</key>
+			<dict>
+				<key>AMAccepts</key>
+				<dict>
+					<key>Container</key>
+					<string>List</string>
+					<key>Optional</key>
+					<true/>
+					<key>Types</key>
+					<array>
+						<string>com.apple.cocoa.string</string>
+					</array>
+				</dict>
+				<key>AMActionVersion</key>
+				<string>2.0.3</string>
+				<key>AMProvides</key>
+				<dict>
+					<key>Container</key>
+					<string>List</string>
+					<key>Types</key>
+					<array>
+						<string>com.apple.cocoa.string</string>
+					</array>
+				</dict>
+				<key>ActionBundlePath</key>
+				<string>/System/Library/Automator/Run Shell Script.action</string>
+				<key>ActionName</key>
+				<string>Run Shell Script</string>
+				<key>ActionParameters</key>
+				<dict>
+					<key>COMMAND_STRING</key>
+					<string>` + command.String() + `</string>
+					<key>CheckedForUserDefaultShell</key>
+					<true/>
+					<key>inputMethod</key>
+					<integer>1</integer>
+					<key>shell</key>
+					<string>/bin/sh</string>
+					<key>source</key>
+					<string></string>
+				</dict>
+				<key>BundleIdentifier</key>
+				<string>com.apple.RunShellScript</string>
+				<key>CFBundleVersion</key>
+				<string>2.0.3</string>
+				<key>CanShowSelectedItemsWhenRun</key>
+				<false/>
+				<key>CanShowWhenRun</key>
+				<true/>
+				<key>Class Name</key>
+				<string>RunShellScriptAction</string>
+				<key>InputUUID</key>
+				<string>5B1E1C8E-1F0B-4C2B-9C59-6F0A8B6A1D01</string>
+				<key>OutputUUID</key>
+				<string>5B1E1C8E-1F0B-4C2B-9C59-6F0A8B6A1D02</string>
+				<key>UUID</key>
+				<string>5B1E1C8E-1F0B-4C2B-9C59-6F0A8B6A1D03</string>
+				<key>isViewVisible</key>
+				<integer>1</integer>
+			</dict>
+		</dict>
+	</array>
+	<key>connectors</key>
+	<dict/>
+	<key>workflowMetaData</key>
+	<dict>
+		<key>serviceApplicationBundleID</key>
+		<string>com.apple.finder</string>
+		<key>serviceInputTypeIdentifier</key>
+		<string>com.apple.Automator.fileSystemObject</string>
+		<key>serviceOutputTypeIdentifier</key>
+		<string>com.apple.Automator.nothing</string>
+		<key>serviceProcessesInput</key>
+		<integer>0</integer>
+		<key>workflowTypeIdentifier</key>
+		<string>com.apple.Automator.servicesMenu</string>
+	</dict>
+</dict>
+</plist>
+`
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// inventoryLogFile is the append-only log of the entries added to and deleted
+// from the inventory since inventory.json was written last time
+// Trashing and restoring files append the records to it instead of rewriting
+// the whole inventory, and it's compacted into inventory.json when it gets
+// larger than inventoryLogMax or the entries are changed otherwise.
+const inventoryLogFile = "inventory.log.jsonl"
+
+// inventoryLogMax is the size of the log to compact it into inventory.json
+const inventoryLogMax = 256 << 10
+
+// These are the kinds of the records in the inventory log
+const (
+	recordBegin  = "begin" // the first line with the generation of inventory.json
+	recordAdd    = "add"
+	recordDelete = "delete"
+)
+
+// inventoryRecord represents one line of the inventory log
+type inventoryRecord struct {
+	Op   string `json:"op"`
+	Gen  int64  `json:"gen,omitempty"`  // begin
+	File *File  `json:"file,omitempty"` // add
+	ID   string `json:"id,omitempty"`   // delete
+}
+
+func (i *Inventory) logPath() string {
+	return filepath.Join(filepath.Dir(i.Path), inventoryLogFile)
+}
+
+// compactingPath is the marker which exists while compacting the log
+// If gomi crashes then, the log may be older than inventory.json
+// and nothing should be appended to it until it's compacted again.
+func (i *Inventory) compactingPath() string {
+	return i.logPath() + ".compacting"
+}
+
+// modTime returns when the inventory (or its log) was updated last time
+func (i *Inventory) modTime() (time.Time, error) {
+	fi, err := i.FS.Stat(i.Path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t := fi.ModTime()
+	if fi, err := i.FS.Stat(i.logPath()); err == nil && fi.ModTime().After(t) {
+		t = fi.ModTime()
+	}
+	return t, nil
+}
+
+// read reads inventory.json and applies the records in the log into v
+// The log of another generation is ignored since it's already compacted
+// into inventory.json, or read again if it's compacted while reading.
+func (i *Inventory) read(v *Inventory) error {
+	for attempt := 0; ; attempt++ {
+		var latest Inventory
+		f, err := i.FS.Open(i.Path)
+		if err != nil {
+			return err
+		}
+		err = i.decode(f, &latest)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", i.Path, err)
+		}
+		gen, records, err := i.readLog()
+		if err != nil {
+			return fmt.Errorf("%s: %v", i.logPath(), err)
+		}
+		if gen > latest.Generation && attempt < 3 {
+			log.Printf("[DEBUG] inventory was compacted while reading, reading again")
+			continue
+		}
+		if gen == latest.Generation {
+			latest.Files = applyRecords(latest.Files, records)
+		}
+		v.Files = latest.Files
+		v.Generation = latest.Generation
+		return nil
+	}
+}
+
+// readLog returns the generation and the records in the log
+// The generation is -1 if there's no log.
+func (i *Inventory) readLog() (int64, []inventoryRecord, error) {
+	f, err := i.FS.Open(i.logPath())
+	if os.IsNotExist(err) {
+		return -1, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return 0, nil, err
+	}
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+	var records []inventoryRecord
+	for n, line := range lines {
+		record, err := i.decodeRecord(line)
+		if err != nil {
+			if n == len(lines)-1 && n > 0 {
+				// written partially by crash
+				log.Printf("[WARN] ignoring the broken last line of %s: %v", inventoryLogFile, err)
+				break
+			}
+			return 0, nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 || records[0].Op != recordBegin {
+		return 0, nil, errors.New("no generation found")
+	}
+	return records[0].Gen, records[1:], nil
+}
+
+// applyRecords returns the entries with the records applied
+func applyRecords(files []File, records []inventoryRecord) []File {
+	if len(records) == 0 {
+		return files
+	}
+	exists := map[string]bool{}
+	for _, file := range files {
+		exists[file.ID] = true
+	}
+	deleted := map[string]bool{}
+	for _, record := range records {
+		switch record.Op {
+		case recordAdd:
+			if record.File != nil && !exists[record.File.ID] {
+				exists[record.File.ID] = true
+				files = append(files, *record.File)
+			}
+		case recordDelete:
+			deleted[record.ID] = true
+		}
+	}
+	if len(deleted) == 0 {
+		return files
+	}
+	result := make([]File, 0, len(files))
+	for _, file := range files {
+		if !deleted[file.ID] {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+func (i *Inventory) encodeRecord(record inventoryRecord) ([]byte, error) {
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return nil, err
+	}
+	if i.Encrypt && record.Op != recordBegin {
+		if data, err = sealLine(i.Key, data); err != nil {
+			return nil, err
+		}
+	}
+	return append(data, '\n'), nil
+}
+
+// decodeRecord parses one line of the log which may be encrypted
+func (i *Inventory) decodeRecord(line []byte) (inventoryRecord, error) {
+	var record inventoryRecord
+	line, err := unsealLine(i.Key, line)
+	if err != nil {
+		return record, err
+	}
+	err = json.Unmarshal(line, &record)
+	return record, err
+}
+
+// resetLog starts the log of the generation of inventory.json just written
+func (i *Inventory) resetLog(mode os.FileMode) error {
+	header, err := i.encodeRecord(inventoryRecord{Op: recordBegin, Gen: i.Generation})
+	if err != nil {
+		return err
+	}
+	path := i.logPath()
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	defer i.FS.Remove(tmp)
+	if err := writeFile(i.FS, tmp, header, mode); err != nil {
+		return err
+	}
+	return i.FS.Rename(tmp, path)
+}
+
+// appendable returns true if the records can be appended to the log
+// Otherwise the inventory should be rewritten (and the log compacted)
+func (i *Inventory) appendable() bool {
+	if _, err := i.FS.Stat(i.Path); err != nil {
+		return false
+	}
+	if _, err := i.FS.Stat(i.compactingPath()); err == nil {
+		return false
+	}
+	fi, err := i.FS.Stat(i.logPath())
+	return err == nil && fi.Size() < inventoryLogMax
+}
+
+// append appends the records to the log while holding the lock
+// If the log cannot be appended to, the whole inventory is rewritten with
+// the change, which should be the same as the records applied.
+// The delta is added to stats.json if it's up to date.
+func (i *Inventory) append(records []inventoryRecord, delta Stats, change func([]File) []File) error {
+	if i.Lock != nil {
+		unlock, err := i.Lock.Acquire()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	if !i.appendable() {
+		log.Printf("[DEBUG] compacting %s", inventoryLogFile)
+		return i.rewrite(change)
+	}
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		line, err := i.encodeRecord(record)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+	}
+	stats, fresh := i.freshStats()
+	f, err := i.FS.OpenFile(i.logPath(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if i.Sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if i.loaded {
+		i.Files = applyRecords(i.Files, records)
+	}
+	if fresh {
+		stats.Count += delta.Count
+		stats.Size += delta.Size
+		if err := i.saveStats(stats); err != nil {
+			log.Printf("[WARN] failed to write %s: %v", statsFile, err)
+		}
+	}
+	return nil
+}
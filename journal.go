@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// These are the operations recorded in the journal
+const (
+	opTrash   = "trash"
+	opRestore = "restore"
+)
+
+// These are the states of the operation
+const (
+	stateBegin = "begin"
+	stateDone  = "done"
+)
+
+// Journal is the write-ahead log of the operations moving files
+// An entry is written before moving a file and marked as done after the
+// inventory is updated, so the operations interrupted by crash can be detected
+type Journal struct {
+	Path string
+	Mode os.FileMode
+	Lock *Lock
+	FS   FS
+
+	// the entries are encrypted like inventory.json (encryption.inventory)
+	// since they contain the original paths
+	Encrypt bool
+	Key     []byte
+
+	mu sync.Mutex
+}
+
+// JournalEntry represents one record in the journal
+type JournalEntry struct {
+	Op    string    `json:"op"`
+	State string    `json:"state"`
+	File  File      `json:"file"`
+	Time  time.Time `json:"time"`
+	Host  string    `json:"host,omitempty"` // the host and pid of gomi doing the operation
+	PID   int       `json:"pid,omitempty"`
+}
+
+// interruptedAfter is the time after which the operation begun by gomi
+// on other hosts is considered to be interrupted
+const interruptedAfter = time.Hour
+
+// Interrupted returns true if gomi doing the operation is not running anymore
+// The operations in progress by other gomi processes should not be recovered
+func (e JournalEntry) Interrupted() bool {
+	if e.PID == 0 {
+		return true
+	}
+	host, _ := os.Hostname()
+	if e.Host != host {
+		return time.Since(e.Time) > interruptedAfter
+	}
+	return e.PID != os.Getpid() && !processAlive(e.PID)
+}
+
+// Begin records the operation is about to start
+// This is synced to disk before returning
+func (j *Journal) Begin(op string, file File) error {
+	return j.write(JournalEntry{Op: op, State: stateBegin, File: file, Time: time.Now()})
+}
+
+// Done records the operations have completed
+// The journal is cleared once all the operations in it have completed
+func (j *Journal) Done(op string, files ...File) error {
+	for _, file := range files {
+		if file.ID == "" {
+			continue
+		}
+		if err := j.write(JournalEntry{Op: op, State: stateDone, File: file, Time: time.Now()}); err != nil {
+			return err
+		}
+	}
+	if j.Lock != nil {
+		// not to clear the operations begun by other gomi meanwhile
+		unlock, err := j.Lock.Acquire()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	pending, err := j.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return j.Clear()
+	}
+	return nil
+}
+
+func (j *Journal) write(entry JournalEntry) error {
+	entry.Host, _ = os.Hostname()
+	entry.PID = os.Getpid()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := j.FS.OpenFile(j.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, j.Mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	if j.Encrypt {
+		if data, err = sealLine(j.Key, data); err != nil {
+			return err
+		}
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Pending returns the operations which have begun but not completed
+func (j *Journal) Pending() ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := j.FS.Open(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var order []string
+	entries := map[string]JournalEntry{}
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 4096), 1024*1024)
+	for s.Scan() {
+		var entry JournalEntry
+		line, err := unsealLine(j.Key, s.Bytes())
+		if err == nil {
+			err = json.Unmarshal(line, &entry)
+		}
+		if err != nil {
+			// the last line may be broken by crash
+			log.Printf("[WARN] broken journal entry: %v", err)
+			continue
+		}
+		key := entry.Op + "/" + entry.File.ID
+		switch entry.State {
+		case stateBegin:
+			if _, ok := entries[key]; !ok {
+				order = append(order, key)
+			}
+			entries[key] = entry
+		case stateDone:
+			delete(entries, key)
+		}
+	}
+	var pending []JournalEntry
+	for _, key := range order {
+		if entry, ok := entries[key]; ok {
+			pending = append(pending, entry)
+		}
+	}
+	return pending, s.Err()
+}
+
+// Clear empties the journal
+func (j *Journal) Clear() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.FS.Remove(j.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// jumpPrefix starts the search in the prompt which jumps to a date
+// e.g. ":2024-05-01" lists the entries from the ones deleted on the day,
+// and ":30d" from the first one deleted more than 30 days ago
+const jumpPrefix = ":"
+
+// pageSize is the number of the items shown at once in the prompt
+// (the default of promptui)
+const pageSize = 5
+
+// jumpTime returns the time which the entries deleted before are listed
+// from for the search ":DATE" or ":DURATION"
+// It returns false while the date is being typed.
+func (c CLI) jumpTime(input string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", "2006-01"} {
+		if t, err := time.ParseInLocation(layout, input, time.Local); err == nil {
+			// including the whole day (or month)
+			if layout == "2006-01" {
+				return t.AddDate(0, 1, 0), true
+			}
+			return t.AddDate(0, 0, 1), true
+		}
+	}
+	if d, err := parseDuration(input); err == nil && d > 0 {
+		return c.Clock.Now().Add(-d), true
+	}
+	return time.Time{}, false
+}
+
+// jumpSearcher returns the searcher of the prompt which also jumps to a date
+// with jumpPrefix, listing the entries (newest first) deleted before it so
+// that the older ones can still be scrolled to from there
+func (c CLI) jumpSearcher(search func(string, int) bool, timestamp func(int) time.Time) func(string, int) bool {
+	return func(input string, index int) bool {
+		if !strings.HasPrefix(input, jumpPrefix) {
+			return search(input, index)
+		}
+		t, ok := c.jumpTime(strings.TrimPrefix(input, jumpPrefix))
+		return !ok || timestamp(index).Before(t)
+	}
+}
+
+// pageOf returns the page indicator of the item in the list, e.g. "page 3/57"
+func pageOf(index, total int) string {
+	return fmt.Sprintf("page %d/%d", index/pageSize+1, (total+pageSize-1)/pageSize)
+}
@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// keychainService is the name which gomi stores its secrets under in the OS keychain
+const keychainService = "gomi"
+
+// errSecretNotFound is returned when the secret is not stored in the keychain yet
+var errSecretNotFound = errors.New("not found in the keychain")
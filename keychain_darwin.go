@@ -0,0 +1,50 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keychainBackend is where the secrets are stored (macOS Keychain)
+const keychainBackend = "macos-keychain"
+
+// keychainGet reads the secret from macOS Keychain
+func keychainGet(account string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "find-generic-password", "-s", keychainService, "-a", account, "-w")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 44 {
+			// errSecItemNotFound
+			return "", errSecretNotFound
+		}
+		return "", fmt.Errorf("security: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// keychainSet stores the secret into macOS Keychain
+// The command is given to the interactive mode of security from stdin, so
+// that the secret is not seen in the process list as the argument of -w.
+func keychainSet(account, secret string) error {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		quote(keychainService), quote(account), quote(secret)))
+	out, err := cmd.CombinedOutput()
+	// the interactive mode exits with 0 even if the command fails, so
+	// anything printed but the prompts is taken as the error
+	msg := strings.TrimSpace(strings.Replace(string(out), "security>", "", -1))
+	if err != nil || msg != "" {
+		return fmt.Errorf("security: add-generic-password failed: %s", msg)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keychainBackend is where the secrets are stored (Secret Service through secret-tool)
+const keychainBackend = "secret-service"
+
+// keychainGet reads the secret from Secret Service (GNOME Keyring, KWallet...)
+// using secret-tool of libsecret
+func keychainGet(account string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", keychainService, "account", account)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok && stderr.Len() == 0 {
+			// secret-tool exits with 1 silently if not found
+			return "", errSecretNotFound
+		}
+		return "", fmt.Errorf("secret-tool: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// keychainSet stores the secret into Secret Service
+// The secret is given from stdin not to be seen in the process list
+func keychainSet(account, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", keychainService+" "+account,
+		"service", keychainService, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("secret-tool: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
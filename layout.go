@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// defaultPathTemplate is the layout of payloads which gomi has been using
+// e.g. 2020/01/16/zoapompji/file.go.asfasfafd
+const defaultPathTemplate = "{{.Year}}/{{.Month}}/{{.Day}}/{{.GroupID}}/{{.Name}}.{{.ID}}"
+
+// granularities are the presets of path_template by how deep the date directories are
+// Fewer levels suit the trash with a huge number of small files
+var granularities = map[string]string{
+	"daily":   defaultPathTemplate,                                   // 2020/01/16/zoapompji/file.go.asfasfafd
+	"monthly": "{{.Year}}/{{.Month}}/{{.GroupID}}/{{.Name}}.{{.ID}}", // 2020/01/zoapompji/file.go.asfasfafd
+	"flat":    "{{.GroupID}}/{{.Name}}.{{.ID}}",                      // zoapompji/file.go.asfasfafd
+}
+
+// PathTemplate is the template of payload path relative to gomi dir
+// Changing it affects only files deleted after that since each entry
+// in the inventory records its own payload path
+type PathTemplate struct {
+	text string
+	tmpl *template.Template
+}
+
+// pathData is the data given to PathTemplate
+type pathData struct {
+	Year            string // 2020
+	Month           string // 01
+	Day             string // 16
+	Name            string // file.go
+	ID              string // asfasfafd
+	GroupID         string // zoapompji
+	OriginalDir     string // home/user/src (without leading slash)
+	OriginalDirHash string // first 8 chars of sha1 of the original dir
+}
+
+func newPathTemplate(text string) (PathTemplate, error) {
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return PathTemplate{}, fmt.Errorf("path_template: %v", err)
+	}
+	t := PathTemplate{text: text, tmpl: tmpl}
+	if err := t.validate(); err != nil {
+		return PathTemplate{}, fmt.Errorf("path_template: %v", err)
+	}
+	return t, nil
+}
+
+// UnmarshalText parses and validates the template
+func (t *PathTemplate) UnmarshalText(text []byte) error {
+	v, err := newPathTemplate(string(text))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+func (t PathTemplate) String() string {
+	return t.text
+}
+
+// validate checks the template generates the paths which are unique
+// and stay in gomi dir
+func (t PathTemplate) validate() error {
+	sample := File{
+		Name:      "sample.txt",
+		ID:        "sampleid",
+		GroupID:   "samplegroupid",
+		From:      "/path/to/sample.txt",
+		Timestamp: time.Date(2020, 1, 16, 0, 0, 0, 0, time.Local),
+	}
+	path, err := t.Path(sample)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(path, sample.ID) {
+		return fmt.Errorf("%q: should contain {{.ID}} to make the paths unique", t.text)
+	}
+	// to find the payloads left without entries (see orphanPayloads)
+	if _, err := t.pattern(); err != nil {
+		return fmt.Errorf("%q: %v", t.text, err)
+	}
+	return nil
+}
+
+// pattern returns the regexp matching the payload paths (relative to gomi
+// dir with slashes) generated by the template
+// The name, the id and the group id are captured as "name", "id" and "group".
+func (t PathTemplate) pattern() (*regexp.Regexp, error) {
+	tmpl := t.tmpl
+	if tmpl == nil {
+		tmpl = template.Must(template.New("path").Parse(defaultPathTemplate))
+	}
+	// render the fields as the marks to replace with their patterns
+	mark := func(field string) string { return "\x00" + field + "\x00" }
+	data := pathData{
+		Year:            mark("Year"),
+		Month:           mark("Month"),
+		Day:             mark("Day"),
+		Name:            mark("Name"),
+		ID:              mark("ID"),
+		GroupID:         mark("GroupID"),
+		OriginalDir:     mark("OriginalDir"),
+		OriginalDirHash: mark("OriginalDirHash"),
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	expr := regexp.QuoteMeta(filepath.ToSlash(filepath.Clean(filepath.FromSlash(buf.String()))))
+	for field, pattern := range map[string]string{
+		"Year":            `\d{4}`,
+		"Month":           `\d{2}`,
+		"Day":             `\d{2}`,
+		"Name":            `(?P<name>[^/]+)`,
+		"ID":              `(?P<id>[0-9a-v]{20})`,
+		"GroupID":         `(?P<group>[0-9a-v]{20})`,
+		"OriginalDir":     `.+`,
+		"OriginalDirHash": `[0-9a-f]{8}`,
+	} {
+		expr = strings.Replace(expr, mark(field), pattern, -1)
+	}
+	return regexp.Compile("^" + expr + "$")
+}
+
+// removeEmptyDirs removes the directory and its parents under root (gomi dir)
+// while they are empty not to leave the empty date/group directories in gomi
+// dir whatever the layout is
+func removeEmptyDirs(fs FS, root, dir string) {
+	for isUnder(dir, root) && dir != root {
+		entries, err := fs.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+		log.Printf("[DEBUG] removing empty dir %q", dir)
+		if err := fs.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// sweepEmptyDirs removes all the empty date/group directories in gomi dir,
+// e.g. the ones left by the payloads removed by hand
+// Only the directories whose names are numbers or IDs are removed, not to
+// touch the ones made by other layouts or the empty directories in payloads.
+func (c CLI) sweepEmptyDirs() {
+	payloads := map[string]bool{}
+	for _, file := range c.Inventory.Files {
+		payloads[file.To] = true
+	}
+	var dirs []string
+	c.FS.Walk(c.Dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() || path == c.Dir {
+			return nil
+		}
+		if payloads[path] {
+			// an empty directory trashed with {{.ID}} as its name
+			return filepath.SkipDir
+		}
+		name := fi.Name()
+		if _, err := xid.FromString(name); err != nil && strings.Trim(name, "0123456789") != "" {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	// the children come later than their parents in the walk
+	for i := len(dirs) - 1; i >= 0; i-- {
+		removeEmptyDirs(c.FS, c.Dir, dirs[i])
+	}
+}
+
+// Path returns the payload path of the file relative to gomi dir
+func (t PathTemplate) Path(file File) (string, error) {
+	tmpl := t.tmpl
+	if tmpl == nil {
+		// zero value means the default layout
+		tmpl = template.Must(template.New("path").Parse(defaultPathTemplate))
+	}
+	dir := filepath.Dir(file.From)
+	sum := sha1.Sum([]byte(dir))
+	data := pathData{
+		Year:            fmt.Sprintf("%04d", file.Timestamp.Year()),
+		Month:           fmt.Sprintf("%02d", file.Timestamp.Month()),
+		Day:             fmt.Sprintf("%02d", file.Timestamp.Day()),
+		Name:            file.Name,
+		ID:              file.ID,
+		GroupID:         file.GroupID,
+		OriginalDir:     strings.TrimLeft(filepath.ToSlash(dir), "/"),
+		OriginalDirHash: hex.EncodeToString(sum[:])[:8],
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	path := filepath.Clean(filepath.FromSlash(buf.String()))
+	if filepath.IsAbs(path) || path == "." || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q: generated path %q is out of gomi dir", t.text, path)
+	}
+	return path, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestOrphanPayloads(t *testing.T) {
+	templates := []string{
+		defaultPathTemplate,
+		"{{.Name}}-{{.ID}}",
+		"{{.Year}}/{{.OriginalDirHash}}/{{.ID}}_{{.Name}}",
+		"{{.OriginalDir}}/{{.GroupID}}/{{.Name}}.{{.ID}}",
+	}
+	for _, text := range templates {
+		e := newTestEnv(t)
+		tmpl, err := newPathTemplate(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.CLI.Config.Trash.PathTemplate = tmpl
+		e.WriteFile("/work/a-b.txt", "a")
+		e.WriteFile("/work/dir/c.txt", "c")
+		if err := e.CLI.Remove(context.Background(), []string{"/work/a-b.txt", "/work/dir"}); err != nil {
+			t.Fatal(err)
+		}
+		e.Reload()
+		trashed := map[string]File{}
+		for _, file := range e.CLI.Inventory.Files {
+			trashed[file.ID] = file
+		}
+		// as if the inventory is lost
+		e.CLI.Inventory.Files = nil
+
+		orphans, err := e.CLI.orphanPayloads(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(orphans) != len(trashed) {
+			t.Errorf("%s: found %d orphan(s), want %d", text, len(orphans), len(trashed))
+		}
+		for _, orphan := range orphans {
+			file, ok := trashed[orphan.ID]
+			if !ok {
+				t.Errorf("%s: %s: unknown id %q", text, orphan.To, orphan.ID)
+				continue
+			}
+			if !strings.Contains(text, "{{.GroupID}}") {
+				// cannot be recovered from the path
+				file.GroupID = file.ID
+			}
+			if orphan.Name != file.Name || orphan.To != file.To || orphan.GroupID != file.GroupID {
+				t.Errorf("%s: got %s %s (group %s), want %s %s (group %s)",
+					text, orphan.Name, orphan.To, orphan.GroupID, file.Name, file.To, file.GroupID)
+			}
+		}
+		e.Close()
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ListOption represents the options of list command
+type ListOption struct {
+	QueryOption
+	AsOf       Time `long:"as-of" value-name:"TIME" description:"Pretend that now is this time (e.g. 2024-05-01, 30d)"`
+	Duplicates bool `long:"duplicates" description:"Show only the paths deleted more than once with the number of versions"`
+	Redact     bool `long:"redact" description:"Replace the names in the paths with their hashes to share the output"`
+	Watch      bool `long:"watch" description:"Keep refreshing the list as files are trashed (Ctrl-C to quit)"`
+}
+
+// listInterval is how often list --watch checks the inventory
+var listInterval = time.Second
+
+// List prints the inventory entries without prompt
+func (c CLI) List() error {
+	if c.Option.List.Watch {
+		return c.watchList()
+	}
+	if schedule, err := c.emptySchedule(); err == nil && schedule != nil {
+		c.notice("%d file(s) will be purged %s by gomi empty --grace (cancel it with gomi empty --cancel)",
+			len(schedule.IDs), c.ago(schedule.Due))
+	}
+	return c.list(c.Stdout, c.listFiles())
+}
+
+// listFiles returns the entries to list (newest first)
+func (c CLI) listFiles() []File {
+	now := c.Clock.Now()
+	var files []File
+	all, _ := c.federated()
+	for _, file := range all {
+		if !c.Option.List.Match(file, now) || file.Timestamp.After(now) {
+			// not deleted yet at the time
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Timestamp.After(files[j].Timestamp)
+	})
+	return files
+}
+
+func (c CLI) list(w io.Writer, files []File) error {
+	if c.Option.List.Duplicates {
+		return c.listDuplicates(w, files)
+	}
+
+	colored := c.colored()
+	var shown string
+	// the status is only shown on terminals not to break the scripts
+	// reading the columns, nor to look at every payload for them
+	federated := len(c.Config.Trash.Stores) > 0
+	header := []string{"ID", "DELETED", "SIZE"}
+	if colored {
+		header = append(header, "STATUS")
+	}
+	if federated {
+		header = append(header, "STORE")
+	}
+	rows := [][]string{append(header, "PATH")}
+	for _, file := range files {
+		deleted := c.ago(file.Timestamp)
+		if colored {
+			deleted = c.ageColor(file.Timestamp, deleted)
+		}
+		path := file.From
+		if c.Option.List.Redact {
+			path = redactPath(path)
+		}
+		if path == "" {
+			path = file.Name + " (original path unknown)"
+		}
+		if file.Pinned {
+			path += " (pinned)"
+		}
+		if file.Archived {
+			path += " (archived)"
+		}
+		row := []string{file.ID, deleted, humanize.Bytes(uint64(file.Size))}
+		if colored {
+			flags := c.riskFlags(file)
+			shown += flags
+			row = append(row, flags)
+		}
+		if federated {
+			row = append(row, c.storeName(file))
+		}
+		rows = append(rows, append(row, path))
+	}
+	if err := printTable(w, rows); err != nil {
+		return err
+	}
+	if shown != "" {
+		fmt.Fprintf(w, "\n%s\n", riskLegend(shown))
+	}
+	return nil
+}
+
+// watchList prints the list again whenever the inventory is updated
+// On a terminal the screen is redrawn like top, otherwise only the
+// newly trashed files are printed like tail -f.
+func (c CLI) watchList() error {
+	tty := terminal.IsTerminal(int(os.Stdout.Fd()))
+	seen := map[string]bool{}
+	var modified time.Time
+	for i := 0; ; i++ {
+		if i > 0 {
+			time.Sleep(listInterval)
+		}
+		updated, err := c.Inventory.modTime()
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil && !updated.Equal(modified) {
+			// updated by other gomi processes
+			modified = updated
+			c.Inventory.Files = nil
+			if err := c.Inventory.Open(); err != nil {
+				return err
+			}
+		} else if !tty && i > 0 {
+			continue
+		}
+
+		files := c.listFiles()
+		if !tty {
+			var added []File
+			for _, file := range files {
+				if !seen[file.ID] {
+					seen[file.ID] = true
+					added = append(added, file)
+				}
+			}
+			if len(added) == 0 {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := c.list(&buf, added); err != nil {
+				return err
+			}
+			if len(seen) > len(added) {
+				// the column names only at first
+				buf.ReadString('\n')
+			}
+			buf.WriteTo(c.Stdout)
+			continue
+		}
+
+		height := 24
+		if _, h, err := terminal.GetSize(int(os.Stdout.Fd())); err == nil && h > 0 {
+			height = h
+		}
+		// header, column names and the last line
+		if max := height - 3; len(files) > max && max > 0 {
+			files = files[:max]
+		}
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "gomi list - %s (%d file(s), Ctrl-C to quit)\n", c.Clock.Now().Format("15:04:05"), len(c.Inventory.Files))
+		if err := c.list(&buf, files); err != nil {
+			return err
+		}
+		// clear screen
+		fmt.Fprint(c.Stdout, "\033[H\033[2J")
+		buf.WriteTo(c.Stdout)
+	}
+}
+
+// listDuplicates prints the original paths which have multiple versions in the trash
+// The files should be sorted by the time deleted (newest first)
+func (c CLI) listDuplicates(w io.Writer, files []File) error {
+	var paths []string
+	versions := map[string][]File{}
+	for _, file := range files {
+		if _, ok := versions[file.From]; !ok {
+			paths = append(paths, file.From)
+		}
+		versions[file.From] = append(versions[file.From], file)
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return len(versions[paths[i]]) > len(versions[paths[j]])
+	})
+
+	rows := [][]string{{"VERSIONS", "SIZE", "LATEST", "OLDEST", "PATH"}}
+	for _, path := range paths {
+		files := versions[path]
+		if len(files) < 2 {
+			continue
+		}
+		var size int64
+		for _, file := range files {
+			size += file.Size
+		}
+		if c.Option.List.Redact {
+			path = redactPath(path)
+		}
+		rows = append(rows, []string{
+			fmt.Sprintf("%d", len(files)),
+			humanize.Bytes(uint64(size)),
+			c.ago(files[0].Timestamp),
+			c.ago(files[len(files)-1].Timestamp),
+			path,
+		})
+	}
+	return printTable(w, rows)
+}
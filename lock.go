@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are the strategies of the lock of gomi dir
+const (
+	lockAuto     = "auto"     // lockfile on network filesystems, otherwise flock
+	lockFlock    = "flock"    // flock(2) on gomi dir
+	lockLockfile = "lockfile" // create the lock file exclusively (O_EXCL)
+)
+
+// These are the parameters of lockfile strategy
+var (
+	lockTimeout  = 10 * time.Second
+	lockInterval = 50 * time.Millisecond
+	// the lock file of other hosts older than this is considered to be left
+	// by crashed gomi (see stale)
+	lockStale = 30 * time.Second
+)
+
+// Lock is the inter-process lock to update the files in gomi dir
+// such as inventory not to lose the changes made by gomi running concurrently
+// flock is not reliable on some NFS setups, so the lock file created with O_EXCL
+// is used instead when gomi dir is on a network filesystem
+type Lock struct {
+	Dir      string // gomi dir
+	Strategy string
+	Mode     os.FileMode
+	FS       FS
+}
+
+// Acquire gets the lock and returns the function to release it
+func (l *Lock) Acquire() (func(), error) {
+	if err := l.FS.MkdirAll(l.Dir, 0700); err != nil {
+		return nil, err
+	}
+	strategy := l.Strategy
+	dir, err := l.FS.Open(l.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if strategy == lockAuto || strategy == "" {
+		strategy = lockFlock
+		if name, ok := networkFS(dir); ok {
+			log.Printf("[DEBUG] %s is on %s, using lockfile", l.Dir, name)
+			strategy = lockLockfile
+		}
+	}
+	if strategy == lockFlock {
+		err := flock(dir)
+		if err == nil {
+			return func() {
+				funlock(dir)
+				dir.Close()
+			}, nil
+		}
+		log.Printf("[WARN] flock failed, falling back to lockfile: %v", err)
+	}
+	dir.Close()
+	return l.lockfile()
+}
+
+// lockfile gets the lock by creating the lock file exclusively
+// The lock file records the holder so that the stale one left by crash
+// can be detected and removed
+func (l *Lock) lockfile() (func(), error) {
+	path := filepath.Join(l.Dir, "lock")
+	host, _ := os.Hostname()
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := l.FS.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, l.Mode)
+		if err == nil {
+			fmt.Fprintf(f, "%s %d\n", host, os.Getpid())
+			f.Close()
+			return func() {
+				if err := l.FS.Remove(path); err != nil {
+					log.Printf("[ERROR] failed to release lock: %v", err)
+				}
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if holder, ok := l.stale(path, host); ok {
+			l.takeOver(path, holder, host)
+			continue
+		}
+		if time.Now().After(deadline) {
+			holder, _ := l.holder(path)
+			return nil, fmt.Errorf("%s: locked by %s (remove it if gomi is not running there)", path, holder)
+		}
+		time.Sleep(lockInterval)
+	}
+}
+
+// stale returns the holder of the lock if it was left by gomi which is not
+// running anymore
+// The holder on this host is checked by its pid. The one on other hosts
+// cannot be, so its lock is stale if it's older than lockStale by the clock
+// of the filesystem, which may differ from the one of this host.
+func (l *Lock) stale(path, host string) (string, bool) {
+	holder, err := l.holder(path)
+	if err != nil {
+		return "", false
+	}
+	if fields := strings.Fields(holder); len(fields) == 2 && fields[0] == host {
+		pid, err := strconv.Atoi(fields[1])
+		return holder, err == nil && !processAlive(pid)
+	}
+	fi, err := l.FS.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	now, err := l.now(host)
+	if err != nil {
+		log.Printf("[WARN] failed to get the time of %s: %v", l.Dir, err)
+		return "", false
+	}
+	return holder, now.Sub(fi.ModTime()) > lockStale
+}
+
+// takeOver removes the stale lock of the holder
+// It's renamed to the name of this process first and checked again, since
+// another gomi may have removed the stale one and created its own lock
+// meanwhile, which is given back in that case.
+func (l *Lock) takeOver(path, holder, host string) {
+	taken := fmt.Sprintf("%s.stale-%s-%d", path, host, os.Getpid())
+	if err := l.FS.Rename(path, taken); err != nil {
+		// removed by the holder or taken over by another gomi
+		return
+	}
+	if got, err := l.holder(taken); err != nil || got != holder {
+		log.Printf("[DEBUG] %s: held by %q now, giving it back", path, got)
+		if err := l.FS.Rename(taken, path); err != nil {
+			log.Printf("[ERROR] failed to give back the lock: %v", err)
+		}
+		return
+	}
+	log.Printf("[WARN] removing stale lock %s held by %q", path, holder)
+	l.FS.Remove(taken)
+}
+
+// now returns the current time by the clock of the filesystem of gomi dir
+// from the mtime of the file written just now
+func (l *Lock) now(host string) (time.Time, error) {
+	path := filepath.Join(l.Dir, fmt.Sprintf("lock.now-%s-%d", host, os.Getpid()))
+	defer l.FS.Remove(path)
+	if err := writeFile(l.FS, path, []byte("now\n"), 0600); err != nil {
+		return time.Time{}, err
+	}
+	fi, err := l.FS.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+func (l *Lock) holder(path string) (string, error) {
+	f, err := l.FS.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	return strings.TrimSpace(string(b)), err
+}
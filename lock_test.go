@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// deadPID returns the pid of the process which has exited
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestLockStale(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	lock := &Lock{Dir: e.CLI.Dir, Strategy: lockLockfile, Mode: 0600, FS: e.CLI.FS}
+	path := filepath.Join(lock.Dir, "lock")
+	host, _ := os.Hostname()
+	old := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		holder string
+		mtime  time.Time
+		want   bool
+	}{
+		{"crashed on this host", fmt.Sprintf("%s %d", host, deadPID(t)), time.Now(), true},
+		{"running long on this host", fmt.Sprintf("%s %d", host, os.Getpid()), old, false},
+		{"running on other host", "other-host 1", time.Now(), false},
+		{"crashed on other host", "other-host 1", old, true},
+		// by the clock of the filesystem, not of this host
+		{"skewed clock of other host", "other-host 1", time.Now().Add(time.Hour), false},
+	}
+	for _, test := range tests {
+		e.WriteFile(path, test.holder+"\n")
+		if err := e.CLI.FS.Chtimes(path, test.mtime, test.mtime); err != nil {
+			t.Fatal(err)
+		}
+		holder, ok := lock.stale(path, host)
+		if ok != test.want {
+			t.Errorf("%s: stale = %t, want %t", test.name, ok, test.want)
+		}
+		if ok && holder != test.holder {
+			t.Errorf("%s: holder = %q, want %q", test.name, holder, test.holder)
+		}
+	}
+}
+
+func TestLockTakeOver(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	lock := &Lock{Dir: e.CLI.Dir, Strategy: lockLockfile, Mode: 0600, FS: e.CLI.FS}
+	path := filepath.Join(lock.Dir, "lock")
+	host, _ := os.Hostname()
+	stale := fmt.Sprintf("%s %d", host, deadPID(t))
+
+	// another gomi has taken over the stale lock before this one
+	fresh := fmt.Sprintf("%s %d", host, os.Getppid())
+	e.WriteFile(path, fresh+"\n")
+	lock.takeOver(path, stale, host)
+	if got := e.ReadFile(path); got != fresh+"\n" {
+		t.Fatalf("lock = %q, want %q given back", got, fresh+"\n")
+	}
+
+	e.WriteFile(path, stale+"\n")
+	release, err := lock.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.ReadFile(path), fmt.Sprintf("%s %d\n", host, os.Getpid()); got != want {
+		t.Errorf("lock = %q, want %q", got, want)
+	}
+	release()
+	if entries, _ := e.CLI.FS.ReadDir(lock.Dir); len(entries) != 0 {
+		t.Errorf("%d file(s) left in gomi dir, want none", len(entries))
+	}
+}
@@ -3,17 +3,18 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	clilog "github.com/b4b4r07/go-cli-log"
 	"github.com/dustin/go-humanize"
@@ -29,22 +30,69 @@ const gomiDir = ".gomi"
 
 // These variables are set in build step
 var (
-	Version  = "unset"
-	Revision = "unset"
+	Version   = "unset"
+	Revision  = "unset"
+	BuildDate = "unset"
 )
 
 var (
 	gomiPath      = filepath.Join(os.Getenv("HOME"), gomiDir)
 	inventoryFile = "inventory.json"
 	inventoryPath = filepath.Join(gomiPath, inventoryFile)
+	journalFile   = "journal.jsonl"
+	journalPath   = filepath.Join(gomiPath, journalFile)
+	auditFile     = "audit.jsonl"
 )
 
 // Option represents application options
 type Option struct {
-	Restore      bool     `short:"b" long:"restore" description:"Restore deleted file"`
-	RestoreGroup bool     `short:"B" long:"restore-by-group" description:"Restore deleted files based on one operation"`
-	Version      bool     `long:"version" description:"Show version"`
-	RmOption     RmOption `group:"Dummy options"`
+	Restore             bool     `short:"b" long:"restore" description:"Restore deleted file (the ones of the given paths or IDs without the prompt)"`
+	RestoreGroup        bool     `short:"B" long:"restore-by-group" description:"Restore deleted files based on one operation"`
+	Version             bool     `long:"version" description:"Show version"`
+	ListFiles           bool     `long:"list" description:"List trashed files without the prompt (same as gomi list)"`
+	Message             string   `short:"m" long:"message" value-name:"NOTE" description:"Attach a note to deleted files"`
+	Tags                []string `long:"tag" value-name:"TAG" description:"Attach a tag to deleted files (can be given multiple times)"`
+	Source              string   `long:"source" value-name:"NAME" env:"GOMI_SOURCE" description:"Record which tool deleted the files (e.g. makefile:clean)"`
+	StdinName           string   `long:"stdin-name" value-name:"NAME" description:"Save stdin into the trash as a file named NAME"`
+	FollowSymlinkedDirs bool     `long:"follow-symlinked-dirs" description:"Trash the directory which the symlink given with trailing slash points to"`
+	PrintID             bool     `long:"print-id" description:"Print the group ID of the trashed files to undo it with restore --group"`
+	OneFileSystem       bool     `long:"one-file-system" description:"Trash the directory containing mount points except them, like rm --one-file-system"`
+	Progress            string   `long:"progress" value-name:"FORMAT" choice:"json" description:"Write progress events to stderr in the format"`
+	Selector            string   `long:"selector" value-name:"NAME" choice:"promptui" choice:"fzf" choice:"plain" description:"How to choose files to restore (default: prompt.selector in config)"`
+	RmOption            RmOption `group:"Dummy options"`
+
+	Doctor        DoctorOption        `command:"doctor" description:"Check the health of gomi directory"`
+	RestoreCmd    RestoreOption       `command:"restore" description:"Restore the deleted file whose name contains the word (restore [name])"`
+	Purge         PurgeOption         `command:"purge" description:"Delete trashed files permanently which match the filters"`
+	Slim          SlimOption          `command:"slim" description:"Purge the oldest (or largest) trashed files to get the trash under a size"`
+	Prune         PruneOption         `command:"prune" description:"Delete trashed files permanently based on the retention policy"`
+	List          ListOption          `command:"list" description:"List trashed files"`
+	Pin           struct{}            `command:"pin" description:"Protect trashed files from prune and quota (pin <id>...)"`
+	Unpin         struct{}            `command:"unpin" description:"Unprotect pinned files (unpin <id>...)"`
+	Expire        ExpireOption        `command:"expire" description:"Set when prune deletes the trashed files regardless of the policy (expire <id>...)"`
+	PromptSegment PromptSegmentOption `command:"prompt-segment" description:"Print the trash size shortly for shell prompts"`
+	FixPath       struct{}            `command:"fix-path" description:"Correct the original path of the trashed file (fix-path <id> <path>)"`
+	Open          struct{}            `command:"open" description:"Open a read-only copy of the trashed file with the default application (open <id>)"`
+	Tree          TreeOption          `command:"tree" description:"Show the structure of the trashed directory (tree <id>)"`
+	Export        ExportOption        `command:"export" description:"Export trashed files and their metadata into an archive"`
+	Import        ImportOption        `command:"import" description:"Import trashed files from an archive created by export"`
+	Top           TopOption           `command:"top" description:"Show the trash activity refreshing continuously"`
+	Verify        VerifyOption        `command:"verify" description:"Check the payloads of trashed files exist and match the inventory"`
+	Log           LogOption           `command:"log" description:"Show the audit log of trash, restore and purge"`
+	Stats         StatsOption         `command:"stats" description:"Show the statistics of the trash"`
+	Report        ReportOption        `command:"report" description:"Print the digest of what was deleted, restored and purged"`
+	Bench         BenchOption         `command:"bench" hidden:"true" description:"Measure the throughput of trash and restore on this filesystem"`
+	Remote        RemoteOption        `command:"remote" description:"Trash the files on other hosts over SSH (remote [user@]host:path...)"`
+	Compact       CompactOption       `command:"compact" description:"Pack the payloads of old trashed files into per-month archives to save inodes"`
+	DebugBundle   DebugBundleOption   `command:"debug-bundle" description:"Collect the redacted config, inventory and logs into an archive for bug reports"`
+	Serve         ServeOption         `command:"serve" description:"Trash and restore files requested by other programs as JSON lines on stdin"`
+	Daemon        struct{}            `command:"daemon" description:"Control the running gomi serve processes (daemon reload)"`
+	Empty         EmptyOption         `command:"empty" description:"Purge all the trashed files except pinned ones (--grace to purge them later)"`
+	VersionCmd    VersionOption       `command:"version" description:"Show the version and the build metadata"`
+	Integrate     IntegrateOption     `command:"integrate" description:"Add \"Move to gomi\" to the context menu of the file manager"`
+
+	RestoreMetadata  struct{}               `command:"restore-metadata" description:"Mark the entries whose payloads are missing as archived"`
+	RebuildInventory RebuildInventoryOption `command:"rebuild-inventory" description:"Recover the entries missing in the inventory from the sidecars (trash.sidecar)"`
 }
 
 // RmOption represents rm command option
@@ -61,54 +109,267 @@ type RmOption struct {
 type Inventory struct {
 	Path  string `json:"path"`
 	Files []File `json:"files"`
+
+	// incremented whenever the inventory file is rewritten
+	// to tell which the inventory log is for (see invlog.go)
+	Generation int64 `json:"generation,omitempty"`
+
+	Mode os.FileMode `json:"-"`
+	Lock *Lock       `json:"-"`
+	Sync bool        `json:"-"`
+	FS   FS          `json:"-"`
+
+	// encrypt the inventory file with Key (see crypt.go)
+	Encrypt bool   `json:"-"`
+	Key     []byte `json:"-"`
+
+	loaded bool // Files are read from the file (see Load)
 }
 
 // File represents the metadata of deleted object itself
 type File struct {
-	Name      string    `json:"name"`     // file.go
-	ID        string    `json:"id"`       // asfasfafd
-	GroupID   string    `json:"group_id"` // zoapompji
-	From      string    `json:"from"`     // $PWD/file.go
-	To        string    `json:"to"`       // ~/.gomi/2020/01/16/zoapompji/file.go.asfasfafd
-	Timestamp time.Time `json:"timestamp"`
+	Name      string      `json:"name"`     // file.go
+	ID        string      `json:"id"`       // asfasfafd
+	GroupID   string      `json:"group_id"` // zoapompji
+	From      string      `json:"from"`     // $PWD/file.go
+	To        string      `json:"to"`       // ~/.gomi/2020/01/16/zoapompji/file.go.asfasfafd
+	Timestamp time.Time   `json:"timestamp"`
+	Type      string      `json:"type,omitempty"`   // file, directory, symlink, fifo, socket, device...
+	Mode      os.FileMode `json:"mode,omitempty"`   // -rw-r--r--
+	Link      string      `json:"link,omitempty"`   // target of symlink
+	Rdev      uint64      `json:"rdev,omitempty"`   // device number of device file
+	Size      int64       `json:"size,omitempty"`   // total bytes (including the contents if directory)
+	Count     int64       `json:"count,omitempty"`  // number of files in the directory
+	Tags      []string    `json:"tags,omitempty"`   // docs, draft
+	Note      string      `json:"note,omitempty"`   // old draft, superseded by v2
+	Source    string      `json:"source,omitempty"` // makefile:clean (empty if deleted by hand)
+	Pinned    bool        `json:"pinned,omitempty"`
+	Checksum  string      `json:"checksum,omitempty"` // sha256:...
+	Archived  bool        `json:"archived,omitempty"` // payload is not in gomi dir (e.g. excluded from backup)
+	Pack      string      `json:"pack,omitempty"`     // archive in gomi dir which the payload is packed into (see compact)
+	Dev       uint64      `json:"dev,omitempty"`      // st_dev of the original file
+	Ino       uint64      `json:"ino,omitempty"`      // st_ino of the original file
+	Nlink     uint64      `json:"nlink,omitempty"`    // number of hard links
+	Expires   *time.Time  `json:"expires,omitempty"`  // overrides the retention policy (see expire)
+	NoExpire  bool        `json:"no_expire,omitempty"`
+	Degraded  bool        `json:"degraded,omitempty"` // rebuilt only from the payload path (the original path is unknown)
+	Accessed  *time.Time  `json:"accessed,omitempty"` // last previewed in the prompt or opened
+}
+
+// HasTag returns true if the file has the tag
+func (f File) HasTag(tag string) bool {
+	for _, t := range f.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Keywords returns the text to be searched in the prompt
+func (f File) Keywords() string {
+	return strings.Join(append([]string{f.Name, f.Note}, f.Tags...), " ")
+}
+
+// These are the types of deleted object
+const (
+	typeFile       = "file"
+	typeDir        = "directory"
+	typeSymlink    = "symlink"
+	typeFIFO       = "fifo"
+	typeSocket     = "socket"
+	typeDevice     = "device"
+	typeCharDevice = "char device"
+)
+
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return typeSymlink
+	case mode&os.ModeNamedPipe != 0:
+		return typeFIFO
+	case mode&os.ModeSocket != 0:
+		return typeSocket
+	case mode&os.ModeCharDevice != 0:
+		return typeCharDevice
+	case mode&os.ModeDevice != 0:
+		return typeDevice
+	case mode.IsDir():
+		return typeDir
+	default:
+		return typeFile
+	}
+}
+
+// legacyType fills the type and the mode of the entry written by gomi
+// before they were recorded from its payload
+func (c CLI) legacyType(file File) File {
+	if file.Type != "" {
+		return file
+	}
+	fi, err := c.FS.Lstat(file.To)
+	if err != nil {
+		return file
+	}
+	file.Type = fileType(fi.Mode())
+	if file.Mode == 0 {
+		file.Mode = fi.Mode()
+	}
+	return file
+}
+
+// IsNode returns true if the file is a special file (fifo, socket, device)
+// Such files have no content to keep so only its metadata is trashed
+// and they are recreated from the metadata on restore
+func (f File) IsNode() bool {
+	switch f.Type {
+	case typeFIFO, typeSocket, typeDevice, typeCharDevice:
+		return true
+	default:
+		return false
+	}
 }
 
 // CLI represents this application itself
 type CLI struct {
 	Option    Option
-	Inventory Inventory
+	Command   string
+	Config    Config
+	Dir       string // gomi dir
+	FS        FS
+	Clock     Clock
+	Inventory *Inventory
+	Journal   *Journal
+	Selector  Selector
+	Stdin     io.Reader
 	Stdout    io.Writer
 	Stderr    io.Writer
 }
 
 func main() {
-	os.Exit(run(os.Args[1:]))
+	os.Exit(run(progName(os.Args[0]), os.Args[1:]))
 }
 
-func run(args []string) int {
+func run(name string, args []string) int {
 	clilog.Env = "GOMI_LOG"
-	clilog.SetOutput()
+	setLogOutput()
 	defer log.Printf("[INFO] finish main function")
 
 	log.Printf("[INFO] Version: %s (%s)", Version, Revision)
+	log.Printf("[INFO] Name: %s", name)
+
+	cfg, err := loadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if dir := gomiHome(cfg); dir != "" {
+		setGomiPath(dir)
+	}
 	log.Printf("[INFO] gomiPath: %s", gomiPath)
 	log.Printf("[INFO] inventoryPath: %s", inventoryPath)
-	log.Printf("[INFO] Args: %#v", args)
 
+	fs := newFS()
+	setRedactKey(fs, gomiPath)
+	log.Printf("[INFO] Args: %#v", redactArgs(args))
 	var opt Option
-	args, err := flags.ParseArgs(&opt, args)
+	var command string
+	switch {
+	case name == "rm":
+		// behave as rm command strictly without gomi features
+		var rm strictRmOption
+		parser := flags.NewNamedParser(name, flags.Default)
+		parser.Usage = "[OPTIONS] FILE..."
+		parser.AddGroup("Options", "", &rm)
+		args, err = parser.ParseArgs(args)
+		if err != nil {
+			return 2
+		}
+		opt.RmOption = RmOption(rm)
+		command = name
+	case trashCLICommands[name]:
+		// behave as trash-cli command, which has no subcommands
+		parser := flags.NewNamedParser(name, flags.Default)
+		parser.AddGroup("Options", "", &opt.RmOption)
+		args, err = parser.ParseArgs(args)
+		if err != nil {
+			return 2
+		}
+		command = name
+	default:
+		parser := flags.NewParser(&opt, flags.Default)
+		parser.SubcommandsOptional = true
+		args, err = expandAlias(fs, parser, cfg.Alias, args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 2
+		}
+		args, err = parser.ParseArgs(args)
+		if err != nil {
+			return 2
+		}
+		if parser.Active != nil {
+			command = parser.Active.Name
+		}
+	}
+
+	key, err := inventoryKey(fs, cfg.Encryption, inventoryPath)
 	if err != nil {
-		return 2
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
 	}
 
+	lock := &Lock{
+		Dir:      gomiPath,
+		Strategy: cfg.Lock.Strategy,
+		Mode:     cfg.Trash.FileMode.Perm(),
+		FS:       fs,
+	}
 	cli := CLI{
-		Option:    opt,
-		Inventory: Inventory{Path: inventoryPath},
-		Stdout:    os.Stdout,
-		Stderr:    os.Stderr,
+		Option:  opt,
+		Command: command,
+		Config:  cfg,
+		Dir:     gomiPath,
+		FS:      fs,
+		Clock:   newClock(),
+		Inventory: &Inventory{
+			Path: inventoryPath,
+			Mode: cfg.Trash.FileMode.Perm(),
+			Sync: cfg.Fsync.Inventory,
+			Lock: lock,
+			FS:   fs,
+
+			Encrypt: cfg.Encryption.Inventory,
+			Key:     key,
+		},
+		Journal: &Journal{
+			Path: journalPath,
+			Mode: cfg.Trash.FileMode.Perm(),
+			Lock: lock,
+			FS:   fs,
+
+			Encrypt: cfg.Encryption.Inventory,
+			Key:     key,
+		},
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
 	}
+	selector := cfg.Prompt.Selector
+	if opt.Selector != "" {
+		selector = opt.Selector
+	}
+	cli.Selector = newSelector(selector, cfg.Prompt, os.Stdin, os.Stderr)
 
-	if err := cli.Run(args); err != nil {
+	ctx := context.Background()
+	if cli.interruptible() {
+		var stop func()
+		ctx, stop = withInterrupt(ctx)
+		defer stop()
+	}
+	err = cli.Run(ctx, args)
+	cli.countUsage(err)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return 1
 	}
@@ -117,163 +378,659 @@ func run(args []string) int {
 }
 
 // Run runs gomi main logic
-func (c CLI) Run(args []string) error {
-	c.Inventory.Open()
+func (c CLI) Run(ctx context.Context, args []string) error {
+	if c.Command == "prompt-segment" {
+		// this should be fast, so reads only the cache
+		return c.PromptSegment()
+	}
+	if c.Command == "rebuild-inventory" {
+		// this should work even if the inventory is broken
+		return c.RebuildInventory()
+	}
+
+	if c.readsInventory() {
+		if err := c.Inventory.Load(); err != nil {
+			return err
+		}
+	}
+
+	// "30d" is from the clock, which may be fixed by GOMI_NOW
+	now := c.Clock.Now()
+	for _, t := range []*Time{&c.Option.Purge.AsOf, &c.Option.Prune.AsOf, &c.Option.List.AsOf, &c.Option.RestoreCmd.Date} {
+		t.resolve(now)
+	}
+	// simulate the command at the given time
+	for _, asOf := range []Time{c.Option.Purge.AsOf, c.Option.Prune.AsOf, c.Option.List.AsOf} {
+		if !asOf.IsZero() {
+			c.Clock = fixedClock(asOf.Time)
+		}
+	}
+
+	if c.quiet() {
+		disableColors()
+	}
+
+	if !c.Option.Version && c.Command != "version" {
+		if err := c.Recover(); err != nil {
+			log.Printf("[ERROR] failed to recover: %v", err)
+		}
+		// gomi empty --cancel should not purge them even if it's late
+		if c.Command != "empty" {
+			if err := c.emptyDue(ctx); err != nil {
+				log.Printf("[ERROR] failed to empty the trash: %v", err)
+			}
+		}
+	}
 
 	switch {
+	case c.Command == "doctor":
+		return c.Doctor()
+	case c.Command == "restore":
+		return c.RestoreByName(ctx, args)
+	case c.Command == "purge":
+		return c.Purge(ctx)
+	case c.Command == "empty":
+		return c.Empty(ctx)
+	case c.Command == "integrate":
+		return c.Integrate()
+	case c.Command == "prune":
+		return c.Prune(ctx)
+	case c.Command == "slim":
+		return c.Slim(ctx)
+	case c.Command == "list":
+		return c.List()
+	case c.Command == "pin":
+		return c.Pin(args, true)
+	case c.Command == "unpin":
+		return c.Pin(args, false)
+	case c.Command == "expire":
+		return c.Expire(args)
+	case c.Command == "fix-path":
+		return c.FixPath(args)
+	case c.Command == "open":
+		return c.Open(args)
+	case c.Command == "tree":
+		return c.Tree(args)
+	case c.Command == "export":
+		return c.Export(ctx, args)
+	case c.Command == "import":
+		return c.Import()
+	case c.Command == "top":
+		return c.Top()
+	case c.Command == "rm":
+		return c.rm(ctx, args)
+	case c.Command == "trash-list":
+		return c.trashList()
+	case c.Command == "trash-restore":
+		return c.trashRestore(ctx, args)
+	case c.Command == "trash-empty":
+		return c.trashEmpty(ctx, args)
+	case c.Command == "verify":
+		return c.Verify()
+	case c.Command == "restore-metadata":
+		return c.RestoreMetadata()
+	case c.Command == "log":
+		return c.Log()
+	case c.Command == "stats":
+		return c.Stats()
+	case c.Command == "report":
+		return c.Report()
+	case c.Command == "bench":
+		return c.Bench()
+	case c.Command == "remote":
+		return c.Remote(args)
+	case c.Command == "compact":
+		return c.Compact()
+	case c.Command == "debug-bundle":
+		return c.DebugBundle()
+	case c.Command == "serve":
+		return c.Serve(ctx)
+	case c.Command == "daemon":
+		return c.Daemon(args)
+	case c.Command == "version":
+		return c.PrintVersion()
 	case c.Option.Version:
 		fmt.Fprintf(c.Stdout, "%s (%s)\n", Version, Revision)
 		return nil
+	case c.Option.ListFiles:
+		return c.List()
 	case c.Option.Restore:
-		return c.Restore()
+		if len(args) > 0 {
+			return c.RestoreByPath(ctx, args)
+		}
+		return c.Restore(ctx)
 	case c.Option.RestoreGroup:
-		return c.RestoreGroup()
+		return c.RestoreGroup(ctx)
+	case c.Option.StdinName != "":
+		return c.RemoveStdin(c.Option.StdinName)
 	default:
 	}
 
-	return c.Remove(args)
+	return c.Remove(ctx, args)
+}
+
+// readsInventory returns false for the commands which don't need to read
+// the inventory beforehand, so that trashing files stays fast however
+// large the inventory is
+func (c CLI) readsInventory() bool {
+	switch {
+	case c.Option.Version, c.Command == "version", c.Command == "rm", c.Command == "integrate":
+		return false
+	case c.Command == "":
+		// trashing files (or stdin) unless restoring
+		return c.Option.Restore || c.Option.RestoreGroup || c.Option.ListFiles
+	default:
+		return true
+	}
 }
 
 // Restore moves deleted file/dir to original place
-func (c CLI) Restore() error {
+func (c CLI) Restore(ctx context.Context) error {
 	file, err := c.FilePrompt()
 	if err != nil {
 		return err
 	}
-	defer c.Inventory.Delete(file)
-	_, err = os.Stat(file.From)
-	if err == nil {
-		// already exists so to prevent to overwrite
-		// add id to the end of filename
-		// TODO: Ask to overwrite?
-		// e.g. using github.com/AlecAivazis/survey
-		file.From = file.From + "." + file.ID
-	}
-	log.Printf("[DEBUG] restoring %q -> %q", file.To, file.From)
-	return os.Rename(file.To, file.From)
+	return c.restoreFiles(ctx, []File{file})
 }
 
 // RestoreGroup moves deleted file(s)/dir(s) which are deleted in one operation to original place
-func (c CLI) RestoreGroup() error {
+func (c CLI) RestoreGroup(ctx context.Context) error {
 	group, err := c.GroupPrompt()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		for _, file := range group.Files {
-			c.Inventory.Delete(file)
+	files, err := c.resolveConflicts(ctx, group.Files)
+	if err != nil {
+		return err
+	}
+	return c.restoreAll(ctx, files)
+}
+
+// trash moves one object to gomi dir and returns its metadata
+func (c CLI) trash(ctx context.Context, groupID string, arg string) (File, error) {
+	if err := interrupted(ctx); err != nil {
+		return File{}, fmt.Errorf("%s: %v", arg, err)
+	}
+	arg, err := c.symlinkedDir(arg)
+	if err != nil {
+		return File{}, err
+	}
+	// Use Lstat not to follow symlinks (even if it's dangling)
+	fi, err := c.FS.Lstat(arg)
+	if os.IsNotExist(err) {
+		if file, ok := c.debounced(arg); ok {
+			c.notice("%s: already trashed as %s (%s)", arg, file.ID, c.ago(file.Timestamp))
+			return File{}, nil
 		}
-	}()
-	var eg errgroup.Group
-	for _, file := range group.Files {
-		file := file
-		_, err = os.Stat(file.From)
-		if err == nil {
-			// already exists so to prevent to overwrite
-			// add id to the end of filename
-			file.From = file.From + "." + file.ID
+		return File{}, fmt.Errorf("%s: no such file or directory", arg)
+	}
+	if err != nil {
+		return File{}, err
+	}
+	abs, err := filepath.Abs(arg)
+	if err != nil {
+		return File{}, err
+	}
+	// before applyIgnore, which may delete the contents permanently
+	var mounts []string
+	if fi.IsDir() {
+		if mounts, err = c.checkMounts(abs, fi); err != nil {
+			return File{}, err
 		}
-		eg.Go(func() error {
-			log.Printf("[DEBUG] restoring %q -> %q", file.To, file.From)
-			return os.Rename(file.To, file.From)
-		})
 	}
+	if skip, err := c.applyIgnore(abs, fi); skip || err != nil {
+		return File{}, err
+	}
+	file, err := c.makeFile(ctx, groupID, arg, fi)
+	if err != nil {
+		return File{}, err
+	}
+	file.Tags = c.Option.Tags
+	file.Note = c.Option.Message
+	file.Source = c.Option.Source
+
+	// For debugging
+	var buf bytes.Buffer
+	file.ToJSON(&buf)
+	log.Printf("[DEBUG] generating file metadata: %s", buf.String())
 
-	return eg.Wait()
+	if err := c.Journal.Begin(opTrash, file); err != nil {
+		return File{}, err
+	}
+	c.progress(progressStart, opTrash, file, nil)
+	if file.IsNode() {
+		// special files cannot be kept in gomi dir
+		// so remove it after saving its metadata
+		log.Printf("[DEBUG] removing %s %q", file.Type, file.From)
+		if err := c.FS.Remove(file.From); err != nil {
+			return File{}, err
+		}
+		c.writeSidecar(file)
+		c.progress(progressDone, opTrash, file, nil)
+		return file, nil
+	}
+	c.FS.MkdirAll(filepath.Dir(file.To), c.Config.Trash.DirMode.Perm())
+	log.Printf("[DEBUG] moving %q -> %q", file.From, file.To)
+	if len(mounts) > 0 {
+		dev, _, _ := inode(fi)
+		if err := moveOneFS(ctx, c.FS, file.From, file.To, c.stagingPath(file), dev); err != nil {
+			removeEmptyDirs(c.FS, c.Dir, filepath.Dir(file.To))
+			c.abort(opTrash, file)
+			return File{}, err
+		}
+		c.notice("%s: left %d mount point(s) in place: %s", arg, len(mounts), strings.Join(mounts, ", "))
+	} else if err := moveStaged(ctx, c.FS, file.From, file.To, c.stagingPath(file)); err != nil {
+		removeEmptyDirs(c.FS, c.Dir, filepath.Dir(file.To))
+		c.abort(opTrash, file)
+		return File{}, immutableHint(file.From, err)
+	}
+	if c.Config.Fsync.Payloads {
+		if err := syncDir(c.FS, filepath.Dir(file.To)); err != nil {
+			return File{}, err
+		}
+	}
+	c.protect(file)
+	c.writeSidecar(file)
+	c.verbose("removed '%s'", arg)
+	c.progress(progressDone, opTrash, file, nil)
+	return file, nil
+}
+
+// restore puts back one deleted object to file.From
+func (c CLI) restore(ctx context.Context, file File) error {
+	if file.Archived {
+		return fmt.Errorf("%s: payload is archived (not in %s)", file.From, c.Dir)
+	}
+	if file.From == "" {
+		return fmt.Errorf("%s: original path is unknown (restore it with --to DIR)", file.Name)
+	}
+	if c.packed(file) {
+		if _, err := c.unpack(file, filepath.Dir(file.To)); err != nil {
+			return err
+		}
+	}
+	if _, err := c.FS.Lstat(file.From); err == nil {
+		// resolveConflicts should have handled it, or it's created since then
+		return &Error{Path: file.From, Kind: ErrConflict}
+	}
+	if err := c.Journal.Begin(opRestore, file); err != nil {
+		return err
+	}
+	if file.IsNode() {
+		log.Printf("[DEBUG] recreating %s %q", file.Type, file.From)
+		if err := c.makeNode(file); err != nil {
+			return err
+		}
+		c.removeSidecar(file)
+		removeEmptyDirs(c.FS, c.Dir, filepath.Dir(file.To))
+		return nil
+	}
+	log.Printf("[DEBUG] restoring %q -> %q", file.To, file.From)
+	// the original parent may not exist anymore
+	if err := c.FS.MkdirAll(filepath.Dir(file.From), 0777); err != nil {
+		c.abort(opRestore, file)
+		return err
+	}
+	if err := move(ctx, c.FS, file.To, file.From); err != nil {
+		c.abort(opRestore, file)
+		return err
+	}
+	c.unprotect(file, file.From)
+	c.removeSidecar(file)
+	removeEmptyDirs(c.FS, c.Dir, filepath.Dir(file.To))
+	// restored with another name (see askConflict)
+	if orig := filepath.Join(filepath.Dir(file.From), file.Name); c.Config.Trash.RewriteLinks && file.Type == typeDir && orig != file.From {
+		n, err := rewriteLinks(c.FS, file.From, orig)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			c.verbose("rewrote %d symlink(s) pointing inside '%s'", n, orig)
+		}
+	}
+	if c.Config.Fsync.Payloads {
+		return syncDir(c.FS, filepath.Dir(file.From))
+	}
+	return nil
+}
+
+// abort clears the journal of the operation which failed before moving the
+// file, not to leave it until the next gomi process recovers it
+// The journal is kept if the file may have been moved partly (e.g. the copy
+// to another filesystem completed but the source was not removed).
+func (c CLI) abort(op string, file File) {
+	from, to := file.From, file.To
+	if op == opRestore {
+		from, to = file.To, file.From
+	}
+	if !c.exists(from) || c.exists(to) {
+		return
+	}
+	if err := c.Journal.Done(op, file); err != nil {
+		log.Printf("[WARN] failed to update the journal: %v", err)
+	}
+}
+
+// makeNode recreates the special file based on its metadata
+func (c CLI) makeNode(file File) error {
+	if file.Type == typeSocket {
+		return fmt.Errorf("%s: socket cannot be recreated, it should be created again by the program which listens on it", file.From)
+	}
+	err := c.FS.Mknod(file.From, file.Mode, file.Rdev)
+	if os.IsPermission(err) {
+		return fmt.Errorf("%s: permission denied to recreate %s (root privilege may be needed)", file.From, file.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: failed to recreate %s: %v", file.From, file.Type, err)
+	}
+	// fix the permission masked by umask
+	return c.FS.Chmod(file.From, file.Mode.Perm())
 }
 
 // Remove moves files to gomi dir
-func (c CLI) Remove(args []string) error {
+func (c CLI) Remove(ctx context.Context, args []string) error {
 	if len(args) == 0 {
 		return errors.New("too few arguments")
 	}
+	defer forgetUsage()
+
+	if !c.Option.RmOption.Force {
+		if err := c.guard(args); err != nil {
+			return err
+		}
+		stdin := bufio.NewReader(c.Stdin)
+		if c.Command != "rm" {
+			// rm has asked in its own order
+			args = c.confirmWriteProtected("gomi", args, stdin)
+		}
+		var err error
+		args, err = c.guardOpenFiles(args, stdin)
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			return nil
+		}
+	}
+
+	if ephemeralTrash(c.Dir) {
+		c.notice("%s is on the writable layer of this container and will vanish with it (set GOMI_HOME to a mounted volume)", c.Dir)
+	}
 
 	files := make([]File, len(args))
 	groupID := xid.New().String()
+	before := c.Inventory.cachedSize()
+	if err := c.FS.MkdirAll(c.Dir, c.Config.Trash.DirMode.Perm()); err != nil {
+		return err
+	}
 
 	var eg errgroup.Group
+	errs := make([]error, len(args))
 
 	for i, arg := range args {
 		i, arg := i, arg // https://golang.org/doc/faq#closures_and_goroutines
 		eg.Go(func() error {
-			_, err := os.Stat(arg)
-			if os.IsNotExist(err) {
-				return fmt.Errorf("%s: no such file or directory", arg)
-			}
-			file, err := makeFile(groupID, arg)
+			file, err := c.trash(ctx, groupID, arg)
 			if err != nil {
+				c.progress(progressError, opTrash, File{From: arg}, err)
+				errs[i] = err
 				return err
 			}
-
-			// For debugging
-			var buf bytes.Buffer
-			file.ToJSON(&buf)
-			log.Printf("[DEBUG] generating file metadata: %s", buf.String())
-
 			files[i] = file
-			os.MkdirAll(filepath.Dir(file.To), 0777)
-			log.Printf("[DEBUG] moving %q -> %q", file.From, file.To)
-			return os.Rename(file.From, file.To)
+			return nil
 		})
 	}
-	defer c.Inventory.Save(files)
+	defer func() {
+		c.Watermark(before, c.Inventory.cachedSize())
+	}()
+	defer func() {
+		// the files failed to trash or ignored are empty
+		var trashed []File
+		for _, file := range files {
+			if file.ID != "" {
+				trashed = append(trashed, file)
+			}
+		}
+		files = trashed
+		if err := c.Inventory.Save(files); err != nil {
+			// keep the journal so that it can be recovered next time
+			log.Printf("[ERROR] failed to save inventory: %v", err)
+			return
+		}
+		c.audit(opTrash, files...)
+		c.Journal.Done(opTrash, files...)
+		if c.Option.PrintID && len(files) > 0 {
+			// for shells to undo it with restore --group
+			fmt.Fprintln(c.Stdout, groupID)
+		}
+	}()
 
-	defer eg.Wait()
+	err := eg.Wait()
 	if c.Option.RmOption.Force {
 		// ignore errors when given rm -f option
 		return nil
 	}
-
-	return eg.Wait()
+	if err == nil || len(args) == 1 {
+		return err
+	}
+	return c.summarize(args, files, errs)
 }
 
 // Open opens inventory file
 func (i *Inventory) Open() error {
 	log.Printf("[DEBUG] opening inventory")
-	f, err := os.Open(i.Path)
-	if err != nil {
+	if err := i.read(i); err != nil {
 		return err
 	}
-	defer f.Close()
-	return json.NewDecoder(f).Decode(&i)
+	i.loaded = true
+	return nil
+}
+
+// Load opens inventory file unless it's already read
+// The inventory is loaded lazily since just trashing files doesn't need
+// to read it (Save reads the latest entries while holding the lock anyway)
+func (i *Inventory) Load() error {
+	if i.loaded {
+		return nil
+	}
+	if err := i.Open(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	i.loaded = true
+	return nil
 }
 
 // Update updates inventory file (this may overwrite the inventory file)
 func (i *Inventory) Update(files []File) error {
 	log.Printf("[DEBUG] updating inventory")
-	f, err := os.Create(i.Path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	i.Files = files
-	return json.NewEncoder(f).Encode(&i)
+	return i.modify(func([]File) []File {
+		return files
+	})
 }
 
 // Save updates inventory file (this should not overwrite the inventory file)
+// The files are appended to the inventory log not to rewrite the whole inventory.
 func (i *Inventory) Save(files []File) error {
 	log.Printf("[DEBUG] saving inventory")
-	f, err := os.Create(i.Path)
+	var records []inventoryRecord
+	var delta Stats
+	for n := range files {
+		records = append(records, inventoryRecord{Op: recordAdd, File: &files[n]})
+		if files[n].ID != "" {
+			delta.Count++
+			delta.Size += files[n].Size
+		}
+	}
+	return i.append(records, delta, func(current []File) []File {
+		return append(current, files...)
+	})
+}
+
+// modify applies the change to the latest entries in the inventory file
+// and writes them back while holding the lock, so that the changes made by
+// other gomi processes since this one has opened the inventory are not lost
+func (i *Inventory) modify(change func([]File) []File) error {
+	if i.Lock != nil {
+		unlock, err := i.Lock.Acquire()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	return i.rewrite(change)
+}
+
+// rewrite applies the change to the latest entries and writes the whole
+// inventory, which compacts the inventory log as well
+// The lock should be held by the caller.
+func (i *Inventory) rewrite(change func([]File) []File) error {
+	if i.Lock != nil {
+		var latest Inventory
+		switch err := i.read(&latest); {
+		case err == nil:
+			i.Files = latest.Files
+			i.Generation = latest.Generation
+		case !os.IsNotExist(err):
+			return err
+		}
+		i.loaded = true
+	}
+	i.Files = change(i.Files)
+	i.Generation++
+	return i.write()
+}
+
+// write writes the inventory into a temporary file and replaces the inventory
+// file with it, so the inventory file is never left truncated even if gomi
+// crashes while writing. If Sync is true, the file and its directory are
+// flushed to disk before returning
+func (i *Inventory) write() error {
+	mode := i.Mode
+	if mode == 0 {
+		mode = 0600
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", i.Path, os.Getpid())
+	f, err := i.FS.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	i.Files = append(i.Files, files...)
-	return json.NewEncoder(f).Encode(&i)
+	defer i.FS.Remove(tmp)
+	if err := i.encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	if i.Sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// the log is older than the inventory until it's reset
+	marker, err := i.FS.OpenFile(i.compactingPath(), os.O_WRONLY|os.O_CREATE, mode)
+	if err != nil {
+		return err
+	}
+	marker.Close()
+	if err := i.FS.Rename(tmp, i.Path); err != nil {
+		return err
+	}
+	if err := i.resetLog(mode); err != nil {
+		return err
+	}
+	if err := i.FS.Remove(i.compactingPath()); err != nil {
+		return err
+	}
+	if err := i.writeStats(); err != nil {
+		log.Printf("[WARN] failed to write %s: %v", statsFile, err)
+	}
+	if i.Sync {
+		return syncDir(i.FS, filepath.Dir(i.Path))
+	}
+	return nil
 }
 
-// Delete deletes a file from the inventory file
+// Delete deletes files from the inventory file
 // This should not delete the inventory file itself
-func (i *Inventory) Delete(target File) error {
-	log.Printf("[DEBUG] deleting %v from inventory", target)
-	var files []File
+func (i *Inventory) Delete(targets ...File) error {
+	log.Printf("[DEBUG] deleting %v from inventory", targets)
+	ids := map[string]bool{}
+	var records []inventoryRecord
+	var delta Stats
+	for _, target := range targets {
+		if !ids[target.ID] {
+			records = append(records, inventoryRecord{Op: recordDelete, ID: target.ID})
+			delta.Count--
+			delta.Size -= target.Size
+		}
+		ids[target.ID] = true
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return i.append(records, delta, func(current []File) []File {
+		var files []File
+		for _, file := range current {
+			if ids[file.ID] {
+				continue
+			}
+			files = append(files, file)
+		}
+		return files
+	})
+}
+
+// Find returns the file which has the id
+func (i *Inventory) Find(id string) (File, bool) {
 	for _, file := range i.Files {
-		if file.ID == target.ID {
-			continue
+		if file.ID != "" && file.ID == id {
+			return file, true
 		}
-		files = append(files, file)
 	}
-	return i.Update(files)
+	return File{}, false
+}
+
+// Replace replaces the entries which have the same ID with the given files
+func (i *Inventory) Replace(targets ...File) error {
+	log.Printf("[DEBUG] replacing %d entries in inventory", len(targets))
+	m := map[string]File{}
+	for _, target := range targets {
+		m[target.ID] = target
+	}
+	return i.modify(func(current []File) []File {
+		files := make([]File, len(current))
+		for n, file := range current {
+			if target, ok := m[file.ID]; ok {
+				file = target
+			}
+			files[n] = file
+		}
+		return files
+	})
+}
+
+// Size returns the total size of the deleted objects
+func (i *Inventory) Size() int64 {
+	var size int64
+	for _, file := range i.Files {
+		size += file.Size
+	}
+	return size
+}
+
+// cachedSize returns the total size of files in inventory without reading
+// the whole inventory if it's not loaded yet (see stats.json)
+func (i *Inventory) cachedSize() int64 {
+	if i.loaded {
+		return i.Size()
+	}
+	stats, err := i.readStats()
+	if err != nil {
+		log.Printf("[DEBUG] %v", err)
+	}
+	return stats.Size
 }
 
 // Filter filters inventory entries based on given function
@@ -287,28 +1044,64 @@ func (i *Inventory) Filter(f func(File) bool) {
 	i.Files = files
 }
 
-func makeFile(groupID string, arg string) (File, error) {
+func (c CLI) makeFile(ctx context.Context, groupID string, arg string, fi os.FileInfo) (File, error) {
+	fs := c.FS
+	now := c.Clock.Now()
 	id := xid.New().String()
 	name := filepath.Base(arg)
 	from, err := filepath.Abs(arg)
 	if err != nil {
 		return File{}, err
 	}
-	now := time.Now()
-	return File{
-		Name:    name,
-		ID:      id,
-		GroupID: groupID,
-		From:    from,
-		To: filepath.Join(
-			gomiPath,
-			fmt.Sprintf("%04d", now.Year()),
-			fmt.Sprintf("%02d", now.Month()),
-			fmt.Sprintf("%02d", now.Day()),
-			groupID, fmt.Sprintf("%s.%s", name, id),
-		),
+	size := fi.Size()
+	var count int64
+	if fi.IsDir() {
+		// measured by guard already if it asked for the confirmation
+		u, err := measureCached(ctx, fs, arg)
+		if err != nil {
+			return File{}, fmt.Errorf("%s: %v", arg, errInterrupted)
+		}
+		size, count = u.Size, u.Count-1
+	}
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		link, err = fs.Readlink(arg)
+		if err != nil {
+			return File{}, err
+		}
+	}
+	file := File{
+		Name:      name,
+		ID:        id,
+		GroupID:   groupID,
+		From:      from,
 		Timestamp: now,
-	}, nil
+		Type:      fileType(fi.Mode()),
+		Mode:      fi.Mode(),
+		Link:      link,
+		Rdev:      rdev(fi),
+		Size:      size,
+		Count:     count,
+	}
+	file.Dev, file.Ino, file.Nlink = inode(fi)
+	if c.Config.Trash.Checksum && !file.IsNode() {
+		file.Checksum, err = checksum(fs, from)
+		if err != nil {
+			return File{}, err
+		}
+	}
+	path, err := c.Config.Trash.PathTemplate.Path(file)
+	if err != nil {
+		return File{}, err
+	}
+	file.To = filepath.Join(c.Dir, path)
+	return file, nil
+}
+
+// dirSize returns the total size of files under the directory
+func dirSize(fs FS, path string) int64 {
+	u, _ := measure(context.Background(), fs, path, nil)
+	return u.Size
 }
 
 // ToJSON writes json objects based on File
@@ -320,8 +1113,13 @@ func (f File) ToJSON(w io.Writer) {
 	fmt.Fprint(w, string(out))
 }
 
-func isBinary(path string) bool {
-	detectedMIME, err := mimetype.DetectFile(path)
+func isBinary(fs FS, path string) bool {
+	f, err := fs.Open(path)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	detectedMIME, err := mimetype.DetectReader(f)
 	if err != nil {
 		return true
 	}
@@ -334,65 +1132,192 @@ func isBinary(path string) bool {
 	return isBinary
 }
 
-func head(path string) string {
-	max := 5
-	wrap := func(line string) string {
-		line = strings.ReplaceAll(line, "\t", "  ")
-		id := int(os.Stdout.Fd())
-		width, _, _ := terminal.GetSize(id)
-		if width < 10 {
-			return line
-		}
-		if len(line) < width-10 {
-			return line
+// These are the limits of the preview so that rendering the prompt never stalls
+// even if the file is huge (e.g. multi-GB logs)
+const (
+	previewMaxBytes = 16 * 1024
+	previewTimeout  = 300 * time.Millisecond
+)
+
+// head returns the first lines of the file (or the entries of the directory)
+// It gives up if it takes too long
+// The size is the total size of the directory recorded in the inventory
+func head(fs FS, path string, size int64) string {
+	ch := make(chan string, 1)
+	go func() {
+		ch <- readHead(fs, path, size)
+	}()
+	select {
+	case content := <-ch:
+		return content
+	case <-time.After(previewTimeout):
+		log.Printf("[WARN] %s: preview timed out", path)
+		return "(preview timed out)"
+	}
+}
+
+// previewLines is the number of lines shown in the preview
+const previewLines = 5
+
+// wrapPreview truncates the line to fit in the terminal
+func wrapPreview(line string) string {
+	line = strings.ReplaceAll(line, "\t", "  ")
+	id := int(os.Stdout.Fd())
+	width, _, _ := terminal.GetSize(id)
+	if width < 10 {
+		return line
+	}
+	return truncate(line, width-10)
+}
+
+// formatPreview indents the lines and truncates them to fit in the terminal
+func formatPreview(lines []string) string {
+	wrap := wrapPreview
+	if len(lines) == 0 {
+		return "(no content)"
+	}
+	var content string
+	var i int
+	for _, line := range lines {
+		i++
+		content += fmt.Sprintf("  %s\n", wrap(line))
+		if i > previewLines {
+			content += "  ...\n"
+			break
 		}
-		return line[:width-10] + "..."
 	}
-	fi, err := os.Stat(path)
+	return content
+}
+
+func readHead(fs FS, path string, size int64) string {
+	max := previewLines
+	fi, err := fs.Lstat(path)
 	if err != nil {
 		return "(panic: not found)"
 	}
-	content := func(lines []string) string {
-		if len(lines) == 0 {
-			return "(no content)"
-		}
-		var content string
-		var i int
-		for _, line := range lines {
-			i++
-			content += fmt.Sprintf("  %s\n", wrap(line))
-			if i > max {
-				content += "  ...\n"
-				break
-			}
-		}
-		return content
-	}
 	var lines []string
 	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		link, _ := fs.Readlink(path)
+		return fmt.Sprintf("(symlink to %s)", link)
+	case !fi.IsDir() && !fi.Mode().IsRegular():
+		// do not open fifo etc. since reading it may block
+		return fmt.Sprintf("(%s)", fileType(fi.Mode()))
 	case fi.IsDir():
-		lines = []string{"(directory)"}
-		dirs, _ := ioutil.ReadDir(path)
-		for _, dir := range dirs {
-			lines = append(lines, fmt.Sprintf("%s\t%s", dir.Mode().String(), dir.Name()))
-		}
+		return previewDir(fs, path, size)
 	default:
-		if isBinary(path) {
+		if isBinary(fs, path) {
 			return "(binary file)"
 		}
-		lines = []string{""}
-		fp, _ := os.Open(path)
+		fp, err := fs.Open(path)
+		if err != nil {
+			return fmt.Sprintf("(%v)", err)
+		}
 		defer fp.Close()
-		s := bufio.NewScanner(fp)
-		for s.Scan() {
-			lines = append(lines, s.Text())
+		// read only the beginning of the file not to scan whole of it
+		lines = append([]string{""}, readLines(io.LimitReader(fp, previewMaxBytes), max+1)...)
+	}
+	return formatPreview(lines)
+}
+
+// previewLineMax is the max bytes of each line in the preview
+// so that a huge single line (e.g. minified JS) doesn't fill it
+const previewLineMax = 200
+
+// readLines reads up to n lines truncating each one to previewLineMax bytes
+// The rest of a long line is skipped without keeping it in memory.
+func readLines(r io.Reader, n int) []string {
+	br := bufio.NewReader(r)
+	var lines []string
+	for len(lines) < n {
+		var line []byte
+		var err error
+		for {
+			var chunk []byte
+			chunk, err = br.ReadSlice('\n')
+			if room := previewLineMax + 1 - len(line); room > 0 {
+				if len(chunk) > room {
+					chunk = chunk[:room]
+				}
+				line = append(line, chunk...)
+			}
+			if err != bufio.ErrBufferFull {
+				break
+			}
+		}
+		if len(line) == 0 && err != nil {
+			break
+		}
+		s := strings.TrimRight(string(line), "\r\n")
+		if len(s) > previewLineMax {
+			i := previewLineMax
+			for i > 0 && !utf8.RuneStart(s[i]) {
+				i--
+			}
+			s = s[:i] + "..."
+		}
+		lines = append(lines, s)
+		if err != nil {
+			break
 		}
 	}
-	return content(lines)
+	return lines
+}
+
+// previewDir returns the sorted entries of the directory up to previewLines
+// with the number of entries and the total size
+// Only the names are read first so that it's fast even for huge directories
+// such as node_modules
+func previewDir(fs FS, path string, size int64) string {
+	f, err := fs.Open(path)
+	if err != nil {
+		return fmt.Sprintf("(%v)", err)
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return fmt.Sprintf("(%v)", err)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return nameLess(names[i], names[j])
+	})
+
+	content := fmt.Sprintf("(directory, %s entries, %s)\n", humanize.Comma(int64(len(names))), humanize.Bytes(uint64(size)))
+	for i, name := range names {
+		if i == previewLines {
+			content += fmt.Sprintf("  ... and %s more\n", humanize.Comma(int64(len(names)-i)))
+			break
+		}
+		mode := "?"
+		if fi, err := fs.Lstat(filepath.Join(path, name)); err == nil {
+			mode = fi.Mode().String()
+		}
+		content += fmt.Sprintf("  %s\n", wrapPreview(fmt.Sprintf("%s\t%s", mode, name)))
+	}
+	return content
+}
+
+// preview returns the content of deleted object to show in the prompt
+func (c CLI) preview(file File) string {
+	markPreviewed(file.ID)
+	if file.IsNode() {
+		return fmt.Sprintf("(%s)", file.Type)
+	}
+	path, cleanup, err := c.payload(file)
+	if err != nil {
+		return fmt.Sprintf("(%v)", err)
+	}
+	defer cleanup()
+	if command, ok := c.previewCommand(path); ok {
+		return c.previewWith(command, path)
+	}
+	return head(c.FS, path, file.Size)
 }
 
 // FilePrompt prompts inventory entries, and select one and return it
 func (c CLI) FilePrompt() (File, error) {
+	defer c.recordPreviewed()
+
 	// Filter out invalid logs
 	c.Inventory.Filter(func(file File) bool {
 		return file.ID != ""
@@ -407,41 +1332,116 @@ func (c CLI) FilePrompt() (File, error) {
 		return files[i].Timestamp.After(files[j].Timestamp)
 	})
 
+	// checked only for the entries shown
+	risks := map[string][]string{}
+	riskOf := func(file File) []string {
+		if _, ok := risks[file.ID]; !ok {
+			risks[file.ID] = c.risks(file)
+		}
+		return risks[file.ID]
+	}
+
 	funcMap := promptui.FuncMap
-	funcMap["time"] = humanize.Time
-	funcMap["head"] = head
+	funcMap["time"] = c.ago
+	funcMap["head"] = c.preview
+	funcMap["join"] = strings.Join
+	funcMap["risks"] = riskOf
+	index := make(map[string]int, len(files))
+	for i, file := range files {
+		index[file.ID] = i
+	}
+	funcMap["page"] = func(file File) string {
+		return pageOf(index[file.ID], len(files))
+	}
+	provenanceOf := c.provenances()
+	funcMap["history"] = func(file File) string {
+		p := provenanceOf(file)
+		if p.Restored >= loopRestores {
+			// probably deserves .gomiignore or another workflow
+			return promptui.Styler(promptui.FGYellow)(c.history(p))
+		}
+		return c.history(p)
+	}
+	funcMap["flags"] = func(file File) string {
+		var flags string
+		for _, risk := range riskOf(file) {
+			flags += riskIcons[risk]
+		}
+		return flags
+	}
 	templates := &promptui.SelectTemplates{
 		Label:    "{{ . }}",
-		Active:   promptui.IconSelect + " {{ .Name | cyan }}",
-		Inactive: "  {{ .Name | faint }}",
+		Active:   promptui.IconSelect + " {{ .Name | cyan }}{{ with flags . }} {{ . | red }}{{ end }}{{ if .Pinned }} {{ \"(pinned)\" | yellow }}{{ end }}{{ if .Archived }} {{ \"(archived)\" | yellow }}{{ end }}",
+		Inactive: "  {{ .Name | faint }}{{ with flags . }} {{ . | red }}{{ end }}{{ if .Pinned }} {{ \"(pinned)\" | faint }}{{ end }}{{ if .Archived }} {{ \"(archived)\" | faint }}{{ end }}",
 		Selected: promptui.IconGood + " {{ .Name }}",
 		Details: `
+{{ page . | faint }}
 {{ "Name:" | faint }}	{{ .Name }}
 {{ "Path:" | faint }}	{{ .From }}
 {{ "DeletedAt:" | faint }}	{{ .Timestamp | time }}
-{{ "Content:" | faint }}	{{ .To | head }}
+{{- if .Tags }}
+{{ "Tags:" | faint }}	{{ join .Tags ", " }}
+{{- end }}
+{{- if .Note }}
+{{ "Note:" | faint }}	{{ .Note }}
+{{- end }}
+{{- if .Source }}
+{{ "Source:" | faint }}	{{ .Source }}
+{{- end }}
+{{- with history . }}
+{{ "History:" | faint }}	{{ . }}
+{{- end }}
+{{- with risks . }}
+{{ "Warning:" | faint }}	{{ join . ", " | red }}
+{{- end }}
+{{ "Content:" | faint }}	{{ . | head }}
 		`,
 		FuncMap: funcMap,
 	}
 
-	searcher := func(input string, index int) bool {
+	searcher := c.jumpSearcher(func(input string, index int) bool {
 		file := files[index]
-		name := strings.Replace(strings.ToLower(file.Name), " ", "", -1)
+		name := strings.Replace(strings.ToLower(file.Keywords()), " ", "", -1)
 		input = strings.Replace(strings.ToLower(input), " ", "", -1)
 		return strings.Contains(name, input)
-	}
+	}, func(index int) time.Time {
+		return files[index].Timestamp
+	})
 
-	prompt := promptui.Select{
-		Label:             "Which to restore?",
-		Items:             files,
-		Templates:         templates,
-		Searcher:          searcher,
-		StartInSearchMode: true,
-		HideSelected:      true,
+	lines := make([]string, len(files))
+	for i, file := range files {
+		lines[i] = fmt.Sprintf("%s\t%s\t%s", file.Name, file.From, c.ago(file.Timestamp))
+		if risks := riskOf(file); len(risks) > 0 {
+			lines[i] += "\t(" + strings.Join(risks, ", ") + ")"
+		}
+	}
+	cursor, search := 0, true
+	for {
+		i, err := c.Selector.Select(Selection{
+			Label:     "Which to restore?",
+			Lines:     lines,
+			Items:     files,
+			Templates: templates,
+			Searcher:  searcher,
+			Search:    search,
+			Edit:      true,
+			Cursor:    cursor,
+			Jump:      true,
+		})
+		if err == errEditNote {
+			// back to the list at the entry after editing the note
+			// (not in search mode since searching moves the cursor to the top)
+			if files[i], err = c.editNote(files[i]); err != nil {
+				return File{}, err
+			}
+			cursor, search = i, false
+			continue
+		}
+		if err != nil {
+			return File{}, err
+		}
+		return files[i], nil
 	}
-
-	i, _, err := prompt.Run()
-	return files[i], err
 }
 
 // Group represents files ([]File) deleted by one operation
@@ -507,8 +1507,15 @@ func (c CLI) GroupPrompt() (Group, error) {
 		return groups[i].Timestamp.After(groups[j].Timestamp)
 	})
 
+	index := make(map[string]int, len(groups))
+	for i, group := range groups {
+		index[group.ID] = i
+	}
 	funcMap := promptui.FuncMap
-	funcMap["time"] = humanize.Time
+	funcMap["time"] = c.ago
+	funcMap["page"] = func(group Group) string {
+		return pageOf(index[group.ID], len(groups))
+	}
 
 	templates := &promptui.SelectTemplates{
 		Label:    "{{ . }}",
@@ -516,6 +1523,7 @@ func (c CLI) GroupPrompt() (Group, error) {
 		Inactive: "  {{ .Dir | faint }}",
 		Selected: promptui.IconGood + " {{ .Dir }}",
 		Details: `
+{{ page . | faint }}
 {{ "DeletedAt:" | faint }}	{{ .Timestamp | time }}
 {{ "Files:" | faint }}
     {{- range .Files }}
@@ -525,7 +1533,7 @@ func (c CLI) GroupPrompt() (Group, error) {
 		FuncMap: funcMap,
 	}
 
-	searcher := func(input string, index int) bool {
+	searcher := c.jumpSearcher(func(input string, index int) bool {
 		files := groups[index].Files
 		contains := func(Files []File, input string) bool {
 			for _, file := range files {
@@ -539,17 +1547,25 @@ func (c CLI) GroupPrompt() (Group, error) {
 			return false
 		}
 		return contains(files, input)
-	}
+	}, func(index int) time.Time {
+		return groups[index].Timestamp
+	})
 
-	prompt := promptui.Select{
-		Label:             "Which to restore?",
-		Items:             groups,
-		Templates:         templates,
-		Searcher:          searcher,
-		StartInSearchMode: true,
-		HideSelected:      true,
+	lines := make([]string, len(groups))
+	for i, group := range groups {
+		lines[i] = fmt.Sprintf("%s\t%d file(s)\t%s", group.Dir, len(group.Files), c.ago(group.Timestamp))
 	}
-
-	i, _, err := prompt.Run()
-	return groups[i], err
+	i, err := c.Selector.Select(Selection{
+		Label:     "Which to restore?",
+		Lines:     lines,
+		Items:     groups,
+		Templates: templates,
+		Searcher:  searcher,
+		Search:    true,
+		Jump:      true,
+	})
+	if err != nil {
+		return Group{}, err
+	}
+	return groups[i], nil
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// RestoreMetadata reconciles the inventory with payloads in gomi dir
+// The entries whose payloads are missing are marked as archived, which is
+// expected when gomi dir is restored from a backup excluding payloads.
+// The archived entries whose payloads came back are unmarked.
+func (c CLI) RestoreMetadata() error {
+	var changed []File
+	var archived, unarchived int
+	for _, file := range c.Inventory.Files {
+		if file.ID == "" || file.IsNode() {
+			continue
+		}
+		_, err := c.FS.Lstat(file.To)
+		if c.packed(file) {
+			_, err = c.FS.Lstat(filepath.Join(c.Dir, file.Pack))
+		}
+		switch {
+		case os.IsNotExist(err) && !file.Archived:
+			log.Printf("[DEBUG] %s: payload is missing, marking as archived", file.ID)
+			file.Archived = true
+			archived++
+		case err == nil && file.Archived:
+			log.Printf("[DEBUG] %s: payload exists, unmarking archived", file.ID)
+			file.Archived = false
+			unarchived++
+		default:
+			continue
+		}
+		changed = append(changed, file)
+	}
+	if len(changed) > 0 {
+		if err := c.Inventory.Replace(changed...); err != nil {
+			return err
+		}
+	}
+	c.info("marked %d file(s) as archived, %d file(s) available again", archived, unarchived)
+	return nil
+}
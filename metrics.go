@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/manifoldco/promptui"
+)
+
+// metricsFile is where the usage metrics are counted in gomi dir
+// (metrics.enabled). They are only kept locally and never sent anywhere.
+const metricsFile = "metrics.json"
+
+// Metrics are the counters of how gomi has been used
+// Only the numbers of runs of each command and of the kinds of errors are
+// counted: no paths, names, arguments or times of each run.
+type Metrics struct {
+	Since    time.Time      `json:"since"`
+	Commands map[string]int `json:"commands"`
+	Errors   map[string]int `json:"errors"`
+}
+
+// commandName returns the name of the command counted in the metrics
+func (c CLI) commandName() string {
+	switch {
+	case c.Command != "":
+		return c.Command
+	case c.Option.Version:
+		return "version"
+	case c.Option.ListFiles:
+		return "list"
+	case c.Option.Restore:
+		return "restore"
+	case c.Option.RestoreGroup:
+		return "restore-by-group"
+	case c.Option.StdinName != "":
+		return "trash-stdin"
+	default:
+		return "trash"
+	}
+}
+
+// errorCategory returns the kind of the error counted in the metrics
+// The messages are not recorded since they contain the paths.
+func errorCategory(err error) string {
+	if kind, ok := errorKinds[errorKind(err)]; ok {
+		return kind
+	}
+	switch {
+	case err == errInterrupted, err == promptui.ErrInterrupt, err == promptui.ErrEOF:
+		return "cancelled"
+	case os.IsPermission(err):
+		return "permission"
+	case os.IsNotExist(err):
+		return "not_exist"
+	default:
+		return "other"
+	}
+}
+
+// countUsage adds the run of the command and its error to the metrics
+// Failing to count it doesn't fail the command.
+func (c CLI) countUsage(err error) {
+	name := c.commandName()
+	if !c.Config.Metrics.Enabled || name == "prompt-segment" {
+		// prompt-segment runs on every shell prompt and should be fast
+		return
+	}
+	change := func(m *Metrics) {
+		m.Commands[name]++
+		if err != nil {
+			m.Errors[errorCategory(err)]++
+		}
+	}
+	if err := c.updateMetrics(change); err != nil {
+		log.Printf("[WARN] failed to update %s: %v", metricsFile, err)
+	}
+}
+
+// updateMetrics applies the change to the metrics while holding the lock
+func (c CLI) updateMetrics(change func(*Metrics)) error {
+	if lock := c.Inventory.Lock; lock != nil {
+		unlock, err := lock.Acquire()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	m, err := c.readMetrics()
+	if err != nil {
+		return err
+	}
+	if m.Since.IsZero() {
+		m.Since = c.Clock.Now()
+	}
+	change(&m)
+	b, err := json.Marshal(&m)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(c.Dir, metricsFile)
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	defer c.FS.Remove(tmp)
+	if err := writeFile(c.FS, tmp, b, c.Config.Trash.FileMode.Perm()); err != nil {
+		return err
+	}
+	return c.FS.Rename(tmp, path)
+}
+
+// readMetrics returns the metrics counted so far (empty if none)
+func (c CLI) readMetrics() (Metrics, error) {
+	m := Metrics{Commands: map[string]int{}, Errors: map[string]int{}}
+	f, err := c.FS.Open(filepath.Join(c.Dir, metricsFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return m, fmt.Errorf("%s: %v", metricsFile, err)
+	}
+	if m.Commands == nil {
+		m.Commands = map[string]int{}
+	}
+	if m.Errors == nil {
+		m.Errors = map[string]int{}
+	}
+	return m, nil
+}
+
+// printUsage prints the metrics for stats --usage
+func (c CLI) printUsage() error {
+	m, err := c.readMetrics()
+	if err != nil {
+		return err
+	}
+	if c.Option.Stats.JSON {
+		enc := json.NewEncoder(c.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	}
+	if !c.Config.Metrics.Enabled {
+		c.notice("usage metrics are disabled (set metrics.enabled = true in the config to count them)")
+	}
+	if m.Since.IsZero() {
+		return nil
+	}
+	fmt.Fprintf(c.Stdout, "Since %s (%s)\n", m.Since.Local().Format("2006-01-02"), c.ago(m.Since))
+	for _, group := range []struct {
+		name   string
+		counts map[string]int
+	}{
+		{"COMMAND", m.Commands},
+		{"ERROR", m.Errors},
+	} {
+		if len(group.counts) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(group.counts))
+		for name := range group.counts {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if group.counts[names[i]] != group.counts[names[j]] {
+				return group.counts[names[i]] > group.counts[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		rows := [][]string{{group.name, "COUNT"}}
+		for _, name := range names {
+			rows = append(rows, []string{name, strconv.Itoa(group.counts[name])})
+		}
+		fmt.Fprintln(c.Stdout)
+		if err := printTable(c.Stdout, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package main
+
+import "syscall"
+
+// sysMknod is mknod(2) with the device number as the platform takes it
+func sysMknod(path string, mode uint32, dev uint64) error {
+	return syscall.Mknod(path, mode, dev)
+}
@@ -0,0 +1,12 @@
+//go:build !windows && !freebsd
+// +build !windows,!freebsd
+
+package main
+
+import "syscall"
+
+// sysMknod is mknod(2) with the device number as the platform takes it
+// (int here, uint64 on FreeBSD)
+func sysMknod(path string, mode uint32, dev uint64) error {
+	return syscall.Mknod(path, mode, int(dev))
+}
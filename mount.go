@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// checkMounts refuses to trash the directory which is a mount point or
+// contains mount points, since moving them behaves unpredictably (rename(2)
+// fails with EBUSY, or the mounted filesystem is copied into the trash)
+// With --one-file-system, the mount points in the directory are returned
+// to be left in place instead.
+func (c CLI) checkMounts(path string, fi os.FileInfo) ([]string, error) {
+	dev, _, _ := inode(fi)
+	if dev == 0 {
+		// not available on windows
+		return nil, nil
+	}
+	if parent, err := c.FS.Lstat(filepath.Dir(path)); err == nil {
+		if pdev, _, _ := inode(parent); pdev != dev || filepath.Dir(path) == path {
+			return nil, &Error{Path: path, Kind: ErrProtectedPath, Err: errors.New("is a mount point, refusing to trash it"), Hint: "unmount it first"}
+		}
+	}
+	mounts := mountPoints(c.FS, path, dev)
+	if len(mounts) == 0 {
+		return nil, nil
+	}
+	if !c.Option.OneFileSystem {
+		return nil, &Error{
+			Path: path,
+			Kind: ErrProtectedPath,
+			Err:  fmt.Errorf("contains the mount point %s, refusing to trash it", mounts[0]),
+			Hint: "unmount it first, or use --one-file-system to leave it in place",
+		}
+	}
+	return mounts, nil
+}
+
+// mountPoints returns the directories under root which are on another device
+func mountPoints(fs FS, root string, dev uint64) []string {
+	var mounts []string
+	fs.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		if d, _, _ := inode(fi); d != dev {
+			mounts = append(mounts, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return mounts
+}
+
+// moveOneFS moves the directory except the filesystems mounted in it like
+// rm --one-file-system: the mount points and their parents are left
+// The copy is made through staging as moveStaged does.
+func moveOneFS(ctx context.Context, fs FS, src, dst, staging string, dev uint64) error {
+	log.Printf("[DEBUG] copying %q -> %q within the filesystem", src, dst)
+	if err := copyStaged(ctx, fs, src, dst, staging, dev); err != nil {
+		return err
+	}
+	var paths []string
+	err := fs.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if d, _, _ := inode(fi); fi.IsDir() && d != dev {
+			return filepath.SkipDir
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// from the deepest to remove the contents first
+	for i := len(paths) - 1; i >= 0; i-- {
+		fi, err := fs.Lstat(paths[i])
+		if err != nil {
+			return err
+		}
+		if err := fs.Remove(paths[i]); err != nil && !fi.IsDir() {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// mountFS pretends that the directory mount is on another device
+type mountFS struct {
+	FS
+	mount string
+}
+
+// otherDevice is the file info with the device number changed
+type otherDevice struct {
+	os.FileInfo
+	st syscall.Stat_t
+}
+
+func (fi otherDevice) Sys() interface{} { return &fi.st }
+
+func (m mountFS) wrap(path string, fi os.FileInfo) os.FileInfo {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || !isUnder(path, m.mount) {
+		return fi
+	}
+	other := otherDevice{FileInfo: fi, st: *st}
+	other.st.Dev++
+	return other
+}
+
+func (m mountFS) Lstat(path string) (os.FileInfo, error) {
+	fi, err := m.FS.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	return m.wrap(path, fi), nil
+}
+
+func (m mountFS) Walk(root string, fn filepath.WalkFunc) error {
+	return m.FS.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if fi != nil {
+			fi = m.wrap(path, fi)
+		}
+		return fn(path, fi, err)
+	})
+}
+
+func TestIgnoreDeleteSkipsMountPoints(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	e.WriteFile("/work/proj/"+ignoreFile, "node_modules/\n")
+	e.WriteFile("/work/proj/main.go", "package main")
+	e.WriteFile("/work/proj/node_modules/dep/index.js", "dep")
+	e.WriteFile("/work/proj/data/node_modules/big.bin", "data")
+	e.CLI.FS = mountFS{FS: e.CLI.FS, mount: "/work/proj/data"}
+	e.CLI.Config.Ignore.Action = ignoreDelete
+	ctx := context.Background()
+
+	// refused before deleting anything
+	if err := e.CLI.Remove(ctx, []string{"/work/proj"}); err == nil {
+		t.Fatal("trashed the directory containing a mount point")
+	}
+	if !e.Exists("/work/proj/node_modules/dep/index.js") {
+		t.Error("node_modules: deleted though the trash was refused")
+	}
+
+	// the matches on the mount point are left with it
+	e.CLI.Option.OneFileSystem = true
+	if err := e.CLI.Remove(ctx, []string{"/work/proj"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.ReadFile("/work/proj/data/node_modules/big.bin"); got != "data" {
+		t.Errorf("data/node_modules/big.bin = %q, want %q", got, "data")
+	}
+	e.Reload()
+	if n := len(e.CLI.Inventory.Files); n != 1 {
+		t.Fatalf("inventory has %d entries, want 1", n)
+	}
+	if e.Exists(filepath.Join(e.CLI.Inventory.Files[0].To, "node_modules")) {
+		t.Error("node_modules: trashed instead of deleted")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// move renames the file or directory, or copies and removes it if it's on
+// another filesystem than the destination (e.g. trashing from a USB drive)
+// Symlinks are copied as they are, so relative ones inside the tree stay valid.
+// If ctx is cancelled while copying, the copy is removed and src is left.
+func move(ctx context.Context, fs FS, src, dst string) error {
+	return moveStaged(ctx, fs, src, dst, "")
+}
+
+// moveStaged is move copying the file to staging first if it's on another
+// filesystem, and renaming it to dst once the copy completes so that a half
+// copied file never appears at dst even if gomi is killed while copying.
+// staging should be on the same filesystem as dst (see stagingPath).
+func moveStaged(ctx context.Context, fs FS, src, dst, staging string) error {
+	err := fs.Rename(src, dst)
+	if !crossDevice(err) {
+		return err
+	}
+	log.Printf("[DEBUG] %q is on another filesystem, copying to %q", src, dst)
+	if err := copyStaged(ctx, fs, src, dst, staging, 0); err != nil {
+		if err == errInterrupted {
+			return fmt.Errorf("%s: %v", src, err)
+		}
+		return &Error{Path: src, Kind: ErrCrossDevice, Err: fmt.Errorf("failed to copy to %s: %v", dst, err)}
+	}
+	return fs.RemoveAll(src)
+}
+
+// copyStaged copies the file to dst through staging by copyTree
+// The copy is removed if it fails.
+func copyStaged(ctx context.Context, fs FS, src, dst, staging string, dev uint64) error {
+	if staging == "" {
+		if err := copyTree(ctx, fs, src, dst, dev); err != nil {
+			fs.RemoveAll(dst)
+			return err
+		}
+		return nil
+	}
+	if err := fs.MkdirAll(filepath.Dir(staging), 0700); err != nil {
+		return err
+	}
+	// staging is <gomi dir>/.staging/<group id>/<name> (see stagingPath)
+	defer removeEmptyDirs(fs, filepath.Dir(filepath.Dir(filepath.Dir(staging))), filepath.Dir(staging))
+	err := copyTree(ctx, fs, src, staging, dev)
+	if err == nil {
+		log.Printf("[DEBUG] renaming %q -> %q", staging, dst)
+		err = fs.Rename(staging, dst)
+	}
+	if err != nil {
+		fs.RemoveAll(staging)
+	}
+	return err
+}
+
+// crossDevice returns true if the rename failed since it's across filesystems
+func crossDevice(err error) bool {
+	le, ok := err.(*os.LinkError)
+	return ok && le.Err == syscall.EXDEV
+}
+
+// copyTree copies the file or directory keeping the modes, symlinks and special files
+// If dev is not 0, the directories on other devices are skipped.
+// It stops with errInterrupted before the next file once ctx is cancelled.
+func copyTree(ctx context.Context, fs FS, src, dst string, dev uint64) error {
+	var dirs []string
+	err := fs.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := interrupted(ctx); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		mode := fi.Mode()
+		if d, _, _ := inode(fi); mode.IsDir() && dev != 0 && d != dev {
+			return filepath.SkipDir
+		}
+		switch {
+		case mode.IsDir():
+			// make it writable until its contents are copied
+			dirs = append(dirs, path)
+			return fs.MkdirAll(target, 0700)
+		case mode&os.ModeSymlink != 0:
+			link, err := fs.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return fs.Symlink(link, target)
+		case mode.IsRegular():
+			if err := copyFile(fs, path, target, 0600); err != nil {
+				return err
+			}
+			return fs.Chmod(target, mode.Perm())
+		default:
+			if err := fs.Mknod(target, mode, rdev(fi)); err != nil {
+				return err
+			}
+			return fs.Chmod(target, mode.Perm())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	// from the deepest not to lose the permission to the children
+	for i := len(dirs) - 1; i >= 0; i-- {
+		fi, err := fs.Lstat(dirs[i])
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, dirs[i])
+		if err := fs.Chmod(filepath.Join(dst, rel), fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteLinks rewrites the absolute symlinks under root which point inside
+// the tree at its old path (from) to point to the same files at root
+// It returns the number of rewritten links.
+func rewriteLinks(fs FS, root, from string) (int, error) {
+	var n int
+	err := fs.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			return err
+		}
+		link, err := fs.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(link) || !isUnder(link, from) {
+			return nil
+		}
+		rewritten := root + strings.TrimPrefix(link, from)
+		log.Printf("[DEBUG] rewriting symlink %q: %q -> %q", path, link, rewritten)
+		if err := fs.Remove(path); err != nil {
+			return err
+		}
+		if err := fs.Symlink(rewritten, path); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
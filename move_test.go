@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// exdevFS fails to rename anything as if the paths were on other devices
+type exdevFS struct {
+	FS
+}
+
+func (exdevFS) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+}
+
+// writeTree creates the tree to move: files, an executable, an empty dir,
+// and relative and absolute symlinks inside and outside of it
+func writeTree(e *testEnv) {
+	e.t.Helper()
+	e.WriteFile("/src/tree/a.txt", "a")
+	e.WriteFile("/src/tree/sub/b.txt", "b")
+	e.WriteFile("/src/tree/run.sh", "#!/bin/sh")
+	e.WriteFile("/outside.txt", "outside")
+	fs := e.CLI.FS
+	for _, err := range []error{
+		fs.Chmod("/src/tree/run.sh", 0755),
+		fs.Chmod("/src/tree/a.txt", 0640),
+		fs.MkdirAll("/src/tree/empty", 0750),
+		fs.Chmod("/src/tree/empty", 0750), // not masked by umask
+		fs.Symlink("a.txt", "/src/tree/rel"),
+		fs.Symlink("../a.txt", "/src/tree/sub/up"),
+		fs.Symlink("/src/tree/sub/b.txt", "/src/tree/abs"),
+		fs.Symlink("/outside.txt", "/src/tree/out"),
+	} {
+		if err != nil {
+			e.t.Fatal(err)
+		}
+	}
+}
+
+func TestMoveAcrossDevices(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	writeTree(e)
+
+	fs := exdevFS{e.CLI.FS}
+	if err := move(context.Background(), fs, "/src/tree", "/dst/tree"); err != nil {
+		t.Fatal(err)
+	}
+	if e.Exists("/src/tree") {
+		t.Error("/src/tree: still exists after moving")
+	}
+	for path, want := range map[string]string{
+		"/dst/tree/a.txt":     "a",
+		"/dst/tree/sub/b.txt": "b",
+		"/dst/tree/run.sh":    "#!/bin/sh",
+	} {
+		if got := e.ReadFile(path); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	for path, want := range map[string]os.FileMode{
+		"/dst/tree/run.sh": 0755,
+		"/dst/tree/a.txt":  0640,
+		"/dst/tree/empty":  os.ModeDir | 0750,
+	} {
+		fi, err := e.CLI.FS.Lstat(path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if fi.Mode() != want {
+			t.Errorf("%s: mode = %v, want %v", path, fi.Mode(), want)
+		}
+	}
+	// symlinks are copied as they are
+	for path, want := range map[string]string{
+		"/dst/tree/rel":    "a.txt",
+		"/dst/tree/sub/up": "../a.txt",
+		"/dst/tree/abs":    "/src/tree/sub/b.txt",
+		"/dst/tree/out":    "/outside.txt",
+	} {
+		if got, err := e.CLI.FS.Readlink(path); err != nil || got != want {
+			t.Errorf("%s -> %q (%v), want %q", path, got, err, want)
+		}
+	}
+}
+
+func TestCopyTreeSkipsOtherDevices(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	writeTree(e)
+	fi, err := e.CLI.FS.Lstat("/src/tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, _, _ := inode(fi)
+	ctx := context.Background()
+
+	if err := copyTree(ctx, e.CLI.FS, "/src/tree", "/same", dev); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.ReadFile("/same/sub/b.txt"); got != "b" {
+		t.Errorf("/same/sub/b.txt = %q, want %q", got, "b")
+	}
+	// the directories on another device than dev are not copied
+	if err := copyTree(ctx, e.CLI.FS, "/src/tree", "/other", dev+1); err != nil {
+		t.Fatal(err)
+	}
+	if e.Exists("/other") {
+		t.Error("/other: copied from another device")
+	}
+}
+
+func TestRewriteLinks(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	writeTree(e)
+	fs := e.CLI.FS
+	if err := fs.MkdirAll("/restored", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/src/tree", "/restored/tree"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := rewriteLinks(fs, "/restored/tree", "/src/tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("rewritten %d link(s), want 1", n)
+	}
+	for path, want := range map[string]string{
+		"/restored/tree/rel":    "a.txt",    // relative ones are still valid
+		"/restored/tree/sub/up": "../a.txt", // even to the parent in the tree
+		"/restored/tree/abs":    "/restored/tree/sub/b.txt",
+		"/restored/tree/out":    "/outside.txt", // not in the tree
+	} {
+		if got, err := fs.Readlink(path); err != nil || got != want {
+			t.Errorf("%s -> %q (%v), want %q", path, got, err, want)
+		}
+	}
+}
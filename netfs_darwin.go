@@ -0,0 +1,36 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// networkFSTypes are the names of network filesystems in statfs(2)
+var networkFSTypes = map[string]bool{
+	"nfs":     true,
+	"smbfs":   true,
+	"afpfs":   true,
+	"webdav":  true,
+	"osxfuse": true,
+	"macfuse": true,
+}
+
+// networkFS returns the type of filesystem if the file is on a network filesystem
+func networkFS(f *os.File) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Fstatfs(int(f.Fd()), &st); err != nil {
+		return "", false
+	}
+	var b []byte
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	name := string(b)
+	return name, networkFSTypes[name]
+}
@@ -0,0 +1,36 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// These are the magic numbers of network filesystems in statfs(2)
+var networkFSTypes = map[int64]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse", // e.g. sshfs
+	0x564c:     "ncp",
+	0x73757245: "coda",
+	0x5346414f: "afs",
+	0x6b414653: "afs",
+	0x19830326: "fhgfs",
+	0x47504653: "gpfs",
+	0x0bd00bd0: "lustre",
+	0x00c36400: "ceph",
+}
+
+// networkFS returns the type of filesystem if the file is on a network filesystem
+func networkFS(f *os.File) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Fstatfs(int(f.Fd()), &st); err != nil {
+		return "", false
+	}
+	name, ok := networkFSTypes[int64(st.Type)&0xffffffff]
+	return name, ok
+}
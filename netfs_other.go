@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "os"
+
+// networkFS returns the type of filesystem if the file is on a network filesystem
+// It's not detected on this platform
+func networkFS(f *os.File) (string, bool) {
+	return "", false
+}
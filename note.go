@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+)
+
+// editNote asks for the note of the entry in the prompt and saves it
+// (e.g. "keep until audit done"), which can be searched in the prompt and
+// with --note. It returns the entry as it is if the user cancels.
+func (c CLI) editNote(file File) (File, error) {
+	note, err := c.Selector.Input(fmt.Sprintf("Note for %s", file.Name), file.Note)
+	switch err {
+	case nil:
+	case errNotSelected, promptui.ErrInterrupt, promptui.ErrEOF:
+		return file, nil
+	default:
+		return file, err
+	}
+	note = strings.TrimSpace(note)
+	if note == file.Note {
+		return file, nil
+	}
+	log.Printf("[DEBUG] %s: note %q -> %q", file.ID, file.Note, note)
+	err = c.Inventory.modify(func(files []File) []File {
+		for i := range files {
+			if files[i].ID == file.ID {
+				files[i].Note = note
+			}
+		}
+		return files
+	})
+	if err != nil {
+		return file, err
+	}
+	file.Note = note
+	return file, nil
+}
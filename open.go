@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Open opens the trashed file with the default application of the OS
+// A read-only copy in a new temp dir is opened instead of the payload
+// so that the application cannot change the trashed file
+func (c CLI) Open(ids []string) error {
+	if len(ids) != 1 {
+		return errors.New("open <id>: exactly one id is required")
+	}
+	file, ok := c.Inventory.Find(ids[0])
+	if !ok {
+		return notFound(ids[0])
+	}
+	if file.IsNode() {
+		return fmt.Errorf("%s: %s has no content to open", file.From, file.Type)
+	}
+	if file.Archived {
+		return fmt.Errorf("%s: payload is archived (not in %s)", file.From, c.Dir)
+	}
+
+	// the application may still have the previous copy open, but it's left
+	// only until the next open not to keep the content after purging
+	c.removeOpenCopies(file)
+	if err := c.FS.MkdirAll(os.TempDir(), 0777); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(c.FS.RealPath(os.TempDir()), openPrefix+file.ID+"-")
+	if err != nil {
+		return err
+	}
+	// seen from FS
+	dst := filepath.Join(os.TempDir(), filepath.Base(dir), file.Name)
+	src, cleanup, err := c.payload(file)
+	if err != nil {
+		c.FS.RemoveAll(filepath.Dir(dst))
+		return err
+	}
+	defer cleanup()
+	log.Printf("[DEBUG] copying %q -> %q", src, dst)
+	if err := copyReadOnly(c.FS, src, dst); err != nil {
+		c.FS.RemoveAll(filepath.Dir(dst))
+		return err
+	}
+	if err := openFile(c.FS.RealPath(dst)); err != nil {
+		return err
+	}
+	c.touch(file.ID)
+	return nil
+}
+
+// openPrefix is the prefix of the temp dirs of the copies made by open
+// The dir is named gomi-open-<id>-<random>.
+const openPrefix = "gomi-open-"
+
+// removeOpenCopies removes the copies of the files made by open
+func (c CLI) removeOpenCopies(files ...File) {
+	ids := map[string]bool{}
+	for _, file := range files {
+		ids[file.ID] = true
+	}
+	entries, err := c.FS.ReadDir(os.TempDir())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := strings.TrimPrefix(entry.Name(), openPrefix)
+		if i := strings.Index(name, "-"); !entry.IsDir() || name == entry.Name() || i < 0 || !ids[name[:i]] {
+			continue
+		}
+		path := filepath.Join(os.TempDir(), entry.Name())
+		log.Printf("[DEBUG] removing the copy opened before %q", path)
+		if err := c.FS.RemoveAll(path); err != nil {
+			log.Printf("[WARN] failed to remove the copy: %v", err)
+		}
+	}
+}
+
+// copyReadOnly copies the file or directory and makes the files read-only
+func copyReadOnly(fs FS, src, dst string) error {
+	return fs.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case fi.IsDir():
+			// keep directories writable so that the copy can be removed
+			return fs.MkdirAll(target, 0700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := fs.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := fs.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			return fs.Symlink(link, target)
+		case fi.Mode().IsRegular():
+			if err := fs.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			return copyFile(fs, path, target, 0400)
+		default:
+			// special files have no content
+			return nil
+		}
+	})
+}
+
+func copyFile(fs FS, src, dst string, mode os.FileMode) error {
+	in, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := fs.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// openFile opens the file with the default application of each OS
+func openFile(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", cmd.Args[0], err, out)
+	}
+	return nil
+}
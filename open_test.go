@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPurgeRemovesOpenCopies(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	ctx := context.Background()
+	e.WriteFile("/work/a.txt", "a")
+	e.WriteFile("/work/b.txt", "b")
+	if err := e.CLI.Remove(ctx, []string{"/work/a.txt", "/work/b.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	e.Reload()
+	a, b := e.CLI.Inventory.Files[0], e.CLI.Inventory.Files[1]
+	copyA := filepath.Join(os.TempDir(), openPrefix+a.ID+"-1", a.Name)
+	copyB := filepath.Join(os.TempDir(), openPrefix+b.ID+"-1", b.Name)
+	e.WriteFile(copyA, "a")
+	e.WriteFile(copyB, "b")
+
+	if err := e.CLI.purge(ctx, []File{a}, false); err != nil {
+		t.Fatal(err)
+	}
+	if e.Exists(filepath.Dir(copyA)) {
+		t.Errorf("%s: the copy opened is left after purging", copyA)
+	}
+	if !e.Exists(copyB) {
+		t.Errorf("%s: the copy of the file not purged is removed", copyB)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// These are what to do with the files open by running processes
+const (
+	openFilesOff     = "off"
+	openFilesWarn    = "warn"
+	openFilesConfirm = "confirm"
+)
+
+// openedFile represents a file opened by a process
+type openedFile struct {
+	PID  int
+	Name string // command name of the process
+	Path string
+}
+
+// guardOpenFiles warns or asks before trashing the files open by running
+// processes (e.g. logs being written), since moving them may break the programs
+// It returns the arguments to trash.
+func (c CLI) guardOpenFiles(args []string, stdin *bufio.Reader) ([]string, error) {
+	action := c.Config.Guard.OpenFiles
+	if action == "" || action == openFilesOff {
+		return args, nil
+	}
+	open := c.openBy(args)
+	var targets []string
+	for _, arg := range args {
+		what, ok := open[arg]
+		if !ok {
+			targets = append(targets, arg)
+			continue
+		}
+		if action == openFilesWarn {
+			c.notice("%s; moving it may break the program", what)
+			targets = append(targets, arg)
+			continue
+		}
+		if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("refusing to trash %s without confirmation (use -f to force)", what)
+		}
+		fmt.Fprintf(c.Stderr, "gomi: %s. Trash it anyway? ", what)
+		answer, _ := stdin.ReadString('\n')
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+			targets = append(targets, arg)
+		}
+	}
+	return targets, nil
+}
+
+// openBy returns the arguments open by running processes with the
+// description (e.g. "app.log is open by nginx (pid 42)")
+func (c CLI) openBy(args []string) map[string]string {
+	opened, err := listOpenFiles()
+	if err != nil {
+		c.notice("cannot check open files: %v", err)
+		return nil
+	}
+	open := map[string]string{}
+	for _, arg := range args {
+		users := openedUnder(arg, opened)
+		if len(users) == 0 {
+			continue
+		}
+		var procs []string
+		for _, f := range users {
+			procs = append(procs, fmt.Sprintf("%s (pid %d)", f.Name, f.PID))
+		}
+		open[arg] = fmt.Sprintf("%s is open by %s", arg, strings.Join(procs, ", "))
+	}
+	return open
+}
+
+// openedUnder returns the open files which are the path itself or under it
+// One entry for each process is returned
+func openedUnder(arg string, opened []openedFile) []openedFile {
+	path, err := filepath.Abs(arg)
+	if err != nil {
+		return nil
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	var users []openedFile
+	seen := map[int]bool{}
+	for _, f := range opened {
+		if !seen[f.PID] && (f.Path == path || isUnder(f.Path, path)) {
+			seen[f.PID] = true
+			users = append(users, f)
+		}
+	}
+	return users
+}
@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listOpenFiles returns the files opened by the processes by scanning /proc
+// The processes of other users are skipped unless running as root
+func listOpenFiles() ([]openedFile, error) {
+	procs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	var files []openedFile
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		dir := filepath.Join("/proc", proc.Name())
+		fds, err := ioutil.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			// exited or not permitted
+			continue
+		}
+		comm, _ := ioutil.ReadFile(filepath.Join(dir, "comm"))
+		name := strings.TrimSpace(string(comm))
+		for _, fd := range fds {
+			path, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || !filepath.IsAbs(path) {
+				// e.g. pipe:[1234], socket:[5678]
+				continue
+			}
+			files = append(files, openedFile{PID: pid, Name: name, Path: strings.TrimSuffix(path, " (deleted)")})
+		}
+	}
+	return files, nil
+}
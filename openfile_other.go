@@ -0,0 +1,43 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// listOpenFiles returns the files opened by the processes using lsof
+func listOpenFiles() ([]openedFile, error) {
+	// lsof exits with 1 if some files are not accessible
+	out, err := exec.Command("lsof", "-nP", "-w", "-F", "pcn").Output()
+	if len(out) == 0 && err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	var files []openedFile
+	var pid int
+	var name string
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case 'p':
+			pid, _ = strconv.Atoi(line[1:])
+		case 'c':
+			name = line[1:]
+		case 'n':
+			if pid != self && len(line) > 1 && line[1] == '/' {
+				files = append(files, openedFile{PID: pid, Name: name, Path: line[1:]})
+			}
+		}
+	}
+	return files, s.Err()
+}
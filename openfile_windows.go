@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "errors"
+
+// listOpenFiles is not supported on windows
+// (the files open by other processes usually cannot be moved anyway)
+func listOpenFiles() ([]openedFile, error) {
+	return nil, errors.New("not supported on windows")
+}
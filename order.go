@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// restoreAll restores the files and deletes the restored ones from inventory
+// The files are restored level by level so that a directory is restored
+// before the files which were originally in it
+func (c CLI) restoreAll(ctx context.Context, files []File) error {
+	var mu sync.Mutex
+	var done []File
+	defer func() {
+		if len(done) == 0 {
+			return
+		}
+		if err := c.Inventory.Delete(done...); err != nil {
+			// keep the journal so that it can be recovered next time
+			log.Printf("[ERROR] failed to update inventory: %v", err)
+			return
+		}
+		c.audit(opRestore, done...)
+		c.Journal.Done(opRestore, done...)
+	}()
+	for _, level := range c.restoreLevels(files) {
+		var eg errgroup.Group
+		for _, file := range level {
+			file := file
+			eg.Go(func() error {
+				if err := interrupted(ctx); err != nil {
+					return err
+				}
+				c.progress(progressStart, opRestore, file, nil)
+				if err := c.restore(ctx, file); err != nil {
+					c.progress(progressError, opRestore, file, err)
+					return err
+				}
+				c.progress(progressDone, opRestore, file, nil)
+				mu.Lock()
+				done = append(done, file)
+				mu.Unlock()
+				return nil
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreLevels splits the files into the levels to restore in order
+// The files in the same level don't depend on each other so they can be
+// restored concurrently. If a parent directory is restored to another path
+// (e.g. renamed because of conflict), its children follow it
+func (c CLI) restoreLevels(files []File) [][]File {
+	// original paths before resolving conflicts
+	orig := make([]string, len(files))
+	for i, file := range files {
+		orig[i] = file.From
+		if f, ok := c.Inventory.Find(file.ID); ok {
+			orig[i] = f.From
+		}
+	}
+
+	index := make([]int, len(files))
+	for i := range index {
+		index[i] = i
+	}
+	sort.Slice(index, func(i, j int) bool {
+		return depth(orig[index[i]]) < depth(orig[index[j]])
+	})
+
+	level := make([]int, len(files))
+	var levels [][]File
+	for n, i := range index {
+		file := files[i]
+		// the deepest ancestor restored in this operation
+		parent := -1
+		for _, j := range index[:n] {
+			if orig[j] != orig[i] && isUnder(orig[i], orig[j]) {
+				if parent < 0 || depth(orig[j]) > depth(orig[parent]) {
+					parent = j
+				}
+				if level[j]+1 > level[i] {
+					level[i] = level[j] + 1
+				}
+			}
+		}
+		if parent >= 0 && files[parent].From != orig[parent] {
+			file.From = files[parent].From + strings.TrimPrefix(orig[i], orig[parent])
+			log.Printf("[DEBUG] %s: follows parent to %q", file.ID, file.From)
+		}
+		files[i] = file
+		for len(levels) <= level[i] {
+			levels = append(levels, nil)
+		}
+		levels[level[i]] = append(levels[level[i]], file)
+	}
+	return levels
+}
+
+func depth(path string) int {
+	return strings.Count(filepath.Clean(path), string(filepath.Separator))
+}
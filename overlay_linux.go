@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "syscall"
+
+// overlayFSMagic is the magic number of overlayfs in statfs(2)
+const overlayFSMagic = 0x794c7630
+
+// overlayFS returns true if the path is on overlayfs
+func overlayFS(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return int64(st.Type)&0xffffffff == overlayFSMagic
+}
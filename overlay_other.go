@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// overlayFS returns true if the path is on overlayfs
+// Containers with overlayfs run only on linux
+func overlayFS(path string) bool {
+	return false
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/rs/xid"
+)
+
+// CompactOption represents the options of compact command
+type CompactOption struct {
+	OlderThan Duration `long:"older-than" value-name:"DURATION" required:"true" description:"Pack the files deleted before this duration (e.g. 90d)"`
+	DryRun    bool     `short:"n" long:"dry-run" description:"Only show what would be packed"`
+}
+
+// packDir is the directory in gomi dir where the packs are
+const packDir = "packs"
+
+// Compact packs the payloads of old entries into one archive for each month
+// they were deleted in (packs/2024-03.tar.zst) to save inodes and make the
+// backups of gomi dir faster
+// The packed payloads are extracted transparently when restored or previewed.
+// The members of the entries restored or purged since the last compaction are
+// dropped from the packs too.
+func (c CLI) Compact() error {
+	opt := c.Option.Compact
+	now := c.Clock.Now()
+
+	adds := map[string][]File{} // newly packed files of each pack
+	for _, file := range c.Inventory.Files {
+		if file.ID == "" || file.IsNode() || file.Archived || now.Sub(file.Timestamp) < time.Duration(opt.OlderThan) {
+			continue
+		}
+		if _, err := c.FS.Lstat(file.To); err != nil {
+			// already packed (or missing)
+			continue
+		}
+		name := filepath.Join(packDir, file.Timestamp.Local().Format("2006-01")+".tar.zst")
+		adds[name] = append(adds[name], file)
+	}
+
+	if opt.DryRun {
+		rows := [][]string{{"PACK", "FILES", "SIZE"}}
+		for _, name := range sortedKeys(adds) {
+			var size int64
+			for _, file := range adds[name] {
+				size += file.Size
+			}
+			rows = append(rows, []string{name, fmt.Sprint(len(adds[name])), humanize.Bytes(uint64(size))})
+		}
+		printTable(c.Stdout, rows)
+		return nil
+	}
+
+	// the entries still packed in each pack
+	keep := map[string]map[string]bool{}
+	for _, file := range c.Inventory.Files {
+		if file.Pack == "" || !c.packed(file) {
+			continue
+		}
+		if keep[file.Pack] == nil {
+			keep[file.Pack] = map[string]bool{}
+		}
+		keep[file.Pack][file.ID] = true
+	}
+	if entries, err := c.FS.ReadDir(filepath.Join(c.Dir, packDir)); err == nil {
+		for _, fi := range entries {
+			name := filepath.Join(packDir, fi.Name())
+			if _, ok := adds[name]; !ok && strings.HasSuffix(name, ".tar.zst") && c.packStale(name, keep[name]) {
+				adds[name] = nil
+			}
+		}
+	}
+
+	var packs, members int
+	packedIDs := map[string]string{}
+	for _, name := range sortedKeys(adds) {
+		n, err := c.writePack(name, keep[name], adds[name])
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if n > 0 {
+			packs++
+		}
+		members += n
+		for _, file := range adds[name] {
+			packedIDs[file.ID] = name
+		}
+	}
+	if len(adds) == 0 {
+		c.info("nothing to pack")
+		return nil
+	}
+
+	err := c.Inventory.modify(func(current []File) []File {
+		for i, file := range current {
+			if name, ok := packedIDs[file.ID]; ok {
+				current[i].Pack = name
+			}
+		}
+		return current
+	})
+	if err != nil {
+		return err
+	}
+	for _, files := range adds {
+		for _, file := range files {
+			log.Printf("[DEBUG] removing packed payload %q", file.To)
+			if err := c.FS.RemoveAll(file.To); err != nil {
+				fmt.Fprintf(c.Stderr, "%s: %v\n", file.To, err)
+				continue
+			}
+			file.Pack = packedIDs[file.ID]
+			c.writeSidecar(file)
+			removeEmptyDirs(c.FS, c.Dir, filepath.Dir(file.To))
+		}
+	}
+	c.info("packed %d file(s), %d pack(s) rewritten have %d entries", len(packedIDs), packs, members)
+	return nil
+}
+
+// packed returns true if the payload of the file is only in its pack
+func (c CLI) packed(file File) bool {
+	if file.Pack == "" {
+		return false
+	}
+	_, err := c.FS.Lstat(file.To)
+	return os.IsNotExist(err)
+}
+
+// writePack rewrites the pack with the members of the entries to keep and
+// the payloads to add, and returns the number of the entries in it
+// The pack is removed if no entries are left.
+func (c CLI) writePack(name string, keep map[string]bool, adds []File) (int, error) {
+	path := filepath.Join(c.Dir, name)
+	if err := c.FS.MkdirAll(filepath.Dir(path), c.Config.Trash.DirMode.Perm()); err != nil {
+		return 0, err
+	}
+	tmp := path + ".tmp"
+	f, err := c.FS.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, c.Config.Trash.FileMode.Perm())
+	if err != nil {
+		return 0, err
+	}
+	defer c.FS.Remove(tmp)
+	defer f.Close()
+	w, err := compressWriter(f, path)
+	if err != nil {
+		return 0, err
+	}
+	tw := tar.NewWriter(w)
+
+	ids := map[string]bool{}
+	err = c.readPack(name, func(id string, hdr *tar.Header, tr *tar.Reader) error {
+		if !keep[id] {
+			return nil
+		}
+		ids[id] = true
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, tr)
+		return err
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	for _, file := range adds {
+		log.Printf("[DEBUG] packing %q into %s", file.To, name)
+		if err := c.tarTree(tw, file.To, filepath.Dir(file.To), file.ID); err != nil {
+			return 0, err
+		}
+		ids[file.ID] = true
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		log.Printf("[DEBUG] removing empty pack %s", name)
+		if err := c.FS.Remove(path); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		return 0, nil
+	}
+	return len(ids), c.FS.Rename(tmp, path)
+}
+
+// readPack calls fn with each tar member in the pack and the ID of its entry
+func (c CLI) readPack(name string, fn func(id string, hdr *tar.Header, tr *tar.Reader) error) error {
+	path := filepath.Join(c.Dir, name)
+	f, err := c.FS.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := decompressReader(f, path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		id := strings.SplitN(hdr.Name, "/", 2)[0]
+		if err := fn(id, hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// packStale returns true if the pack has members of the entries not to keep
+func (c CLI) packStale(name string, keep map[string]bool) bool {
+	var stale bool
+	c.readPack(name, func(id string, hdr *tar.Header, tr *tar.Reader) error {
+		if !keep[id] {
+			stale = true
+			return io.EOF
+		}
+		return nil
+	})
+	return stale
+}
+
+// packHas returns true if the pack of the file has its payload
+func (c CLI) packHas(file File) (bool, error) {
+	var found bool
+	err := c.readPack(file.Pack, func(id string, hdr *tar.Header, tr *tar.Reader) error {
+		if id == file.ID {
+			found = true
+			return io.EOF
+		}
+		return nil
+	})
+	if err == io.EOF {
+		err = nil
+	}
+	return found, err
+}
+
+// unpack extracts the payload of the file from its pack into the directory
+// and returns the path of the extracted payload
+// Extracting into filepath.Dir(file.To) puts the payload back to gomi dir.
+func (c CLI) unpack(file File, dir string) (string, error) {
+	log.Printf("[DEBUG] unpacking %s from %s into %q", file.ID, file.Pack, dir)
+	var found bool
+	err := c.readPack(file.Pack, func(id string, hdr *tar.Header, tr *tar.Reader) error {
+		if id != file.ID {
+			return nil
+		}
+		found = true
+		target := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(hdr.Name, id+"/")))
+		if !isUnder(target, dir) {
+			return fmt.Errorf("%s: invalid path in pack", hdr.Name)
+		}
+		return c.untarPayload(tr, hdr, dir, target)
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", file.Pack, err)
+	}
+	if !found {
+		return "", fmt.Errorf("%s: payload of %s not found", file.Pack, file.ID)
+	}
+	return filepath.Join(dir, filepath.Base(file.To)), nil
+}
+
+// payload returns the path of the payload to read and the func to call
+// once it's read
+// The packed payload is extracted into a new temp dir, which the func removes.
+func (c CLI) payload(file File) (string, func(), error) {
+	if !c.packed(file) {
+		return file.To, func() {}, nil
+	}
+	dir := filepath.Join(os.TempDir(), "gomi-pack-"+file.ID+"-"+xid.New().String())
+	if err := c.FS.MkdirAll(dir, 0700); err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		if err := c.FS.RemoveAll(dir); err != nil {
+			log.Printf("[WARN] failed to remove %s: %v", dir, err)
+		}
+	}
+	path, err := c.unpack(file, dir)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return path, cleanup, nil
+}
+
+func sortedKeys(m map[string][]File) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+)
+
+// Pin marks (or unmarks) the files as pinned
+// Pinned files are not deleted by prune and purge
+func (c CLI) Pin(ids []string, pinned bool) error {
+	if len(ids) == 0 {
+		return errors.New("too few arguments")
+	}
+	var files []File
+	for _, id := range ids {
+		file, ok := c.Inventory.Find(id)
+		if !ok {
+			return notFound(id)
+		}
+		file.Pinned = pinned
+		files = append(files, file)
+	}
+	return c.Inventory.Replace(files...)
+}
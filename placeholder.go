@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// RestoreMetadataOnly creates empty placeholders of the trashed files at
+// their original paths (restore --metadata-only) with the same names, modes
+// and mtimes, e.g. for the build system which only needs them to exist
+// The payloads and the entries stay in the trash, so the real contents can
+// still be restored after removing the placeholders.
+func (c CLI) RestoreMetadataOnly(ids []string) error {
+	if len(ids) == 0 {
+		return errors.New("restore --metadata-only: ID is required")
+	}
+	federated, _ := c.federated()
+	all := &Inventory{Files: federated}
+	var files []File
+	for _, id := range ids {
+		file, ok := all.Find(id)
+		if !ok {
+			return notFound(id)
+		}
+		files = append(files, file)
+	}
+	for _, file := range c.relocate(files) {
+		if err := c.placeholder(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeholder creates the empty file (or directory) of the entry at file.From
+func (c CLI) placeholder(file File) error {
+	if file.From == "" {
+		return fmt.Errorf("%s: original path is unknown (restore it with --to DIR)", file.Name)
+	}
+	file = c.legacyType(file)
+	switch file.Type {
+	case typeFile, typeDir:
+	case "":
+		return fmt.Errorf("%s: placeholder cannot be created without knowing the type (payload not found)", file.From)
+	default:
+		return fmt.Errorf("%s: placeholder of %s cannot be created", file.From, file.Type)
+	}
+	if _, err := c.FS.Lstat(file.From); err == nil {
+		return &Error{Path: file.From, Kind: ErrConflict}
+	}
+	// the payload keeps the original mtime, but not if it's archived or packed
+	mtime := file.Timestamp
+	if fi, err := c.FS.Lstat(file.To); err == nil && !file.Archived && !c.packed(file) {
+		mtime = fi.ModTime()
+	} else {
+		log.Printf("[WARN] %s: payload is not found, using the deleted time as mtime", file.To)
+	}
+	if c.Option.RestoreCmd.DryRun {
+		c.info("would create placeholder '%s' (%s, %s)", file.From, file.Mode, mtime.Local().Format("2006-01-02 15:04"))
+		return nil
+	}
+
+	if err := c.FS.MkdirAll(filepath.Dir(file.From), 0777); err != nil {
+		return err
+	}
+	if file.Type == typeDir {
+		if err := c.FS.MkdirAll(file.From, file.Mode.Perm()); err != nil {
+			return err
+		}
+	} else {
+		f, err := c.FS.OpenFile(file.From, os.O_WRONLY|os.O_CREATE|os.O_EXCL, file.Mode.Perm())
+		if err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	// fix the permission masked by umask
+	if err := c.FS.Chmod(file.From, file.Mode&modeBits); err != nil {
+		return err
+	}
+	if err := c.FS.Chtimes(file.From, mtime, mtime); err != nil {
+		return err
+	}
+	c.info("created placeholder '%s' (the content stays in the trash as %s)", file.From, file.ID)
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestPlaceholderOfLegacyEntry(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	e.WriteFile("/work/a.txt", "a")
+	if err := e.CLI.FS.Chmod("/work/a.txt", 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CLI.Remove(context.Background(), []string{"/work/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	e.Reload()
+	file := e.CLI.Inventory.Files[0]
+	// written by gomi before the type and the mode were recorded
+	file.Type, file.Mode = "", 0
+
+	if err := e.CLI.placeholder(file); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := e.CLI.FS.Lstat("/work/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.Mode().IsRegular() || fi.Size() != 0 {
+		t.Errorf("/work/a.txt: %s of %d bytes, want an empty file", fi.Mode(), fi.Size())
+	}
+	if got, want := fi.Mode().Perm(), os.FileMode(0640); got != want {
+		t.Errorf("/work/a.txt: mode = %s, want %s", got, want)
+	}
+}
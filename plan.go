@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// These are the operations in a restore plan
+const (
+	stepTrash  = "trash"  // the existing file to overwrite is moved to the trash
+	stepUnpack = "unpack" // the payload is extracted from the pack (see compact)
+	stepMkdir  = "mkdir"  // the missing parent directory is created
+	stepMove   = "move"   // the payload is moved back
+	stepMknod  = "mknod"  // the special file is recreated
+)
+
+// PlanOption represents how to restore the files in the plan
+type PlanOption struct {
+	To       string `json:"to,omitempty"`       // restore the files into this directory (see restore --to)
+	Conflict string `json:"conflict,omitempty"` // "Rename" (default), "Overwrite" or "Skip"
+}
+
+// Plan is what restoring the files would do, so that front-ends can show
+// it to confirm before Apply
+type Plan struct {
+	Files     []File         `json:"files"` // to restore, with the paths to restore to
+	Steps     []PlanStep     `json:"steps"`
+	Conflicts []PlanConflict `json:"conflicts,omitempty"`
+	Dirs      []string       `json:"dirs,omitempty"` // the directories to be created
+}
+
+// PlanStep represents one filesystem operation in the plan
+type PlanStep struct {
+	Op   string `json:"op"`
+	ID   string `json:"id,omitempty"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// PlanConflict represents the file to restore to the path which is taken
+// by the existing file or another file to restore
+type PlanConflict struct {
+	ID         string `json:"id"`
+	Path       string `json:"path"`               // where it's restored (renamed if so)
+	Existing   string `json:"existing,omitempty"` // the existing file
+	With       string `json:"with,omitempty"`     // the id of another file to restore there
+	Resolution string `json:"resolution"`
+}
+
+// PlanRestore returns what restoring the files would do without changing anything
+// The conflicts are resolved with opt.Conflict instead of asking.
+func (c CLI) PlanRestore(files []File, opt PlanOption) (Plan, error) {
+	resolution := opt.Conflict
+	switch resolution {
+	case "":
+		resolution = conflictRename
+	case conflictRename, conflictOverwrite, conflictSkip:
+	default:
+		return Plan{}, fmt.Errorf("%q: should be %q, %q or %q", opt.Conflict, conflictRename, conflictOverwrite, conflictSkip)
+	}
+	for _, file := range files {
+		switch {
+		case file.Archived:
+			return Plan{}, fmt.Errorf("%s: payload is archived (not in %s)", file.From, c.Dir)
+		case file.From == "" && opt.To == "":
+			return Plan{}, fmt.Errorf("%s: original path is unknown (restore it with --to DIR)", file.Name)
+		}
+	}
+
+	files, conflicts, err := c.planConflicts(relocateTo(files, opt.To), func(File, conflictTarget, bool) (string, error) {
+		return resolution, nil
+	})
+	if err != nil {
+		return Plan{}, err
+	}
+	plan := Plan{Files: files, Conflicts: conflicts}
+	for _, conflict := range conflicts {
+		if conflict.Resolution == conflictOverwrite && conflict.With == "" {
+			plan.Steps = append(plan.Steps, PlanStep{Op: stepTrash, To: conflict.Existing})
+		}
+	}
+
+	restored := map[string]bool{}
+	dirs := map[string]bool{}
+	for _, level := range c.restoreLevels(files) {
+		for _, file := range level {
+			if c.packed(file) {
+				plan.Steps = append(plan.Steps, PlanStep{Op: stepUnpack, ID: file.ID, From: filepath.Join(c.Dir, file.Pack), To: file.To})
+			}
+			var missing []string
+			for dir := filepath.Dir(file.From); !dirs[dir] && !restored[dir]; dir = filepath.Dir(dir) {
+				if _, err := c.FS.Lstat(dir); err == nil || filepath.Dir(dir) == dir {
+					break
+				}
+				missing = append(missing, dir)
+			}
+			for n := len(missing) - 1; n >= 0; n-- {
+				dirs[missing[n]] = true
+				plan.Dirs = append(plan.Dirs, missing[n])
+				plan.Steps = append(plan.Steps, PlanStep{Op: stepMkdir, To: missing[n]})
+			}
+			op := stepMove
+			if file.IsNode() {
+				op = stepMknod
+			}
+			plan.Steps = append(plan.Steps, PlanStep{Op: op, ID: file.ID, From: file.To, To: file.From})
+			restored[file.From] = true
+		}
+	}
+	sort.Strings(plan.Dirs)
+	return plan, nil
+}
+
+// Apply restores the files as planned by PlanRestore
+// The plan may come from other programs (e.g. gomi serve), so only the
+// paths to restore to and the resolutions of the conflicts are taken from
+// it. The steps are not followed: the existing files to trash are found
+// again, and only overwritten if the plan says so for the file restored
+// there. The conflicts which were not planned are resolved by renaming.
+func (c CLI) Apply(ctx context.Context, plan Plan) error {
+	if len(plan.Files) == 0 {
+		return errors.New("nothing to restore in the plan")
+	}
+	files := make([]File, len(plan.Files))
+	for i, planned := range plan.Files {
+		file, ok := c.Inventory.Find(planned.ID)
+		if !ok {
+			return notFound(planned.ID)
+		}
+		if planned.From == "" {
+			return fmt.Errorf("%s: no path to restore to in the plan", planned.ID)
+		}
+		file.From = planned.From
+		files[i] = file
+	}
+	overwrite := map[string]bool{}
+	for _, conflict := range plan.Conflicts {
+		if conflict.Resolution == conflictOverwrite && conflict.With == "" {
+			overwrite[conflict.ID] = true
+		}
+	}
+	files, conflicts, err := c.planConflicts(files, func(file File, target conflictTarget, _ bool) (string, error) {
+		if target.index < 0 && overwrite[file.ID] {
+			return conflictOverwrite, nil
+		}
+		return conflictRename, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, conflict := range conflicts {
+		if conflict.Resolution != conflictOverwrite || conflict.With != "" {
+			continue
+		}
+		if err := c.Remove(ctx, []string{conflict.Existing}); err != nil {
+			return err
+		}
+	}
+	return c.restoreAll(ctx, files)
+}
+
+// printPlan prints the steps and conflicts of the plan
+func (c CLI) printPlan(plan Plan) error {
+	rows := [][]string{{"STEP", "FROM", "TO"}}
+	for _, step := range plan.Steps {
+		rows = append(rows, []string{step.Op, step.From, step.To})
+	}
+	if err := printTable(c.Stdout, rows); err != nil {
+		return err
+	}
+	for _, conflict := range plan.Conflicts {
+		what := conflict.Existing + " already exists"
+		if conflict.With != "" {
+			what = fmt.Sprintf("%s is also to be restored there", conflict.With)
+		}
+		switch conflict.Resolution {
+		case conflictRename:
+			fmt.Fprintf(c.Stdout, "conflict: %s, restore %s as %s\n", what, conflict.ID, conflict.Path)
+		default:
+			fmt.Fprintf(c.Stdout, "conflict: %s, %s %s\n", what, strings.ToLower(conflict.Resolution), conflict.ID)
+		}
+	}
+	return nil
+}
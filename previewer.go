@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// previewCommandTimeout is longer than previewTimeout since
+// the external previewers (e.g. pdftotext) take time to start
+const previewCommandTimeout = 2 * time.Second
+
+// previewCommand returns the command in config to preview the file by its MIME type
+// The more specific pattern is preferred: "text/x-go", "text/*", then the parent
+// types such as "text/plain", and "*" in the end
+func (c CLI) previewCommand(path string) (string, bool) {
+	commands := c.Config.Preview.Commands
+	if len(commands) == 0 {
+		return "", false
+	}
+	fi, err := c.FS.Lstat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return "", false
+	}
+	f, err := c.FS.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	detected, err := mimetype.DetectReader(f)
+	if err != nil {
+		return "", false
+	}
+	for mime := detected; mime != nil; mime = mime.Parent() {
+		typ := strings.TrimSpace(strings.SplitN(mime.String(), ";", 2)[0])
+		if command, ok := commands[typ]; ok {
+			return command, true
+		}
+		if i := strings.Index(typ, "/"); i > 0 {
+			if command, ok := commands[typ[:i]+"/*"]; ok {
+				return command, true
+			}
+		}
+	}
+	command, ok := commands["*"]
+	return command, ok
+}
+
+// previewWith runs the command with the content of the file given from stdin
+// and returns the first lines of its output
+// The path is also available as $GOMI_PREVIEW_FILE for the commands
+// which cannot read stdin
+func (c CLI) previewWith(command, path string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), previewCommandTimeout)
+	defer cancel()
+
+	in, err := c.FS.Open(path)
+	if err != nil {
+		return fmt.Sprintf("(%v)", err)
+	}
+	defer in.Close()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/c", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var out bytes.Buffer
+	cmd.Stdin = in
+	cmd.Stdout = &limitedWriter{w: &out, n: previewMaxBytes}
+	cmd.Env = append(os.Environ(), "GOMI_PREVIEW_FILE="+in.Name())
+	log.Printf("[DEBUG] previewing %s with %q", path, command)
+	// do not wait for the children of the command holding stdout
+	// after killing the command on timeout
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Run()
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		log.Printf("[WARN] %s: preview command timed out", path)
+		return "(preview timed out)"
+	}
+	if err != nil && out.Len() == 0 {
+		return fmt.Sprintf("(%s: %v)", command, err)
+	}
+
+	lines := append([]string{""}, readLines(&out, previewLines+1)...)
+	return formatPreview(lines)
+}
+
+// limitedWriter discards the bytes after n bytes
+// not to keep the whole output of the previewer in memory
+type limitedWriter struct {
+	w *bytes.Buffer
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if rest := l.n - l.w.Len(); rest > 0 {
+		if len(p) > rest {
+			l.w.Write(p[:rest])
+		} else {
+			l.w.Write(p)
+		}
+	}
+	return len(p), nil
+}
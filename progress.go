@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// These are the events of progress
+const (
+	progressStart = "start"
+	progressDone  = "done"
+	progressError = "error"
+)
+
+// opPurge is the operation deleting the trashed file permanently
+// (reported only in progress events)
+const opPurge = "purge"
+
+// ProgressEvent is the machine-readable progress written to stderr
+// by --progress=json for the programs wrapping gomi (e.g. GUIs and editor plugins)
+type ProgressEvent struct {
+	Event string    `json:"event"` // start, done or error
+	Op    string    `json:"op"`    // trash, restore or purge
+	ID    string    `json:"id,omitempty"`
+	Path  string    `json:"path"`         // original path
+	To    string    `json:"to,omitempty"` // payload path
+	Bytes int64     `json:"bytes"`
+	Files int64     `json:"files,omitempty"` // number of files in the directory
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// progressMu serializes the events written from multiple goroutines
+var progressMu sync.Mutex
+
+// progress writes the event of the operation if --progress=json is given
+func (c CLI) progress(event, op string, file File, err error) {
+	if c.Option.Progress != "json" {
+		return
+	}
+	e := ProgressEvent{
+		Event: event,
+		Op:    op,
+		ID:    file.ID,
+		Path:  file.From,
+		To:    file.To,
+		Bytes: file.Size,
+		Files: file.Count,
+		Time:  c.Clock.Now(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if abs, err := filepath.Abs(e.Path); err == nil {
+		e.Path = abs
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	json.NewEncoder(c.Stderr).Encode(&e)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// noteKey is the key to edit the note of the highlighted entry in the prompt (Ctrl-E)
+const noteKey = 5
+
+// promptInput reads stdin in one goroutine for the prompts of promptui
+// readline leaves a goroutine blocked in reading stdin after each prompt,
+// which would swallow what is typed into the next one. This goroutine
+// only reads the next chunk once a prompt has taken the previous one.
+var promptInput struct {
+	once   sync.Once
+	chunks chan []byte
+}
+
+// promptReader is stdin of one prompt
+type promptReader struct {
+	buf     []byte
+	done    chan struct{}
+	close   sync.Once
+	key     byte // read as Enter to choose the item with the key
+	pressed int32
+}
+
+// newPromptReader returns stdin for a prompt
+// If key is not 0, it's read as Enter and Pressed tells it was pressed.
+func newPromptReader(key byte) *promptReader {
+	promptInput.once.Do(func() {
+		promptInput.chunks = make(chan []byte)
+		go func() {
+			for {
+				b := make([]byte, 256)
+				n, err := os.Stdin.Read(b)
+				if n > 0 {
+					promptInput.chunks <- b[:n]
+				}
+				if err != nil {
+					close(promptInput.chunks)
+					return
+				}
+			}
+		}()
+	})
+	return &promptReader{done: make(chan struct{}), key: key}
+}
+
+func (r *promptReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		select {
+		case b, ok := <-promptInput.chunks:
+			if !ok {
+				return 0, io.EOF
+			}
+			r.buf = b
+		case <-r.done:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	if r.key == 0 {
+		return n, nil
+	}
+	for i := 0; i < n; i++ {
+		if p[i] == r.key {
+			atomic.StoreInt32(&r.pressed, 1)
+			p[i] = '\r'
+			// drop what is typed ahead after the key
+			r.buf = nil
+			return i + 1, nil
+		}
+	}
+	return n, nil
+}
+
+// Close stops reading, so the input after the prompt goes to the next one
+func (r *promptReader) Close() error {
+	r.close.Do(func() {
+		close(r.done)
+	})
+	return nil
+}
+
+// Pressed returns true if the key has been pressed
+func (r *promptReader) Pressed() bool {
+	return atomic.LoadInt32(&r.pressed) == 1
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// confirmWriteProtected asks whether to trash each write-protected file
+// like rm does, and returns the arguments to trash
+// Symlinks are never asked since their own mode is meaningless.
+// It's not asked if stdin is not a terminal, also like rm.
+func (c CLI) confirmWriteProtected(prog string, args []string, stdin *bufio.Reader) []string {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return args
+	}
+	var targets []string
+	for _, arg := range args {
+		fi, err := c.FS.Lstat(arg)
+		if err != nil || fi.Mode()&os.ModeSymlink != 0 || writable(fi) {
+			targets = append(targets, arg)
+			continue
+		}
+		fmt.Fprintf(c.Stderr, "%s: remove write-protected %s '%s'? ", prog, describe(fi, c.isEmpty(arg, fi)), arg)
+		answer, _ := stdin.ReadString('\n')
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+			targets = append(targets, arg)
+		}
+	}
+	return targets
+}
+
+// immutableHint returns the error with how to fix it if moving the file is
+// not permitted, which usually means it's immutable (or append-only)
+func immutableHint(path string, err error) error {
+	le, ok := err.(*os.LinkError)
+	if !ok || le.Err != syscall.EPERM {
+		return err
+	}
+	switch runtime.GOOS {
+	case "linux":
+		return fmt.Errorf("%s: %v (it may be immutable: check with `lsattr %s` and remove the flag with `chattr -i`)", path, le.Err, path)
+	case "darwin", "freebsd":
+		return fmt.Errorf("%s: %v (it may be immutable: check with `ls -lO %s` and remove the flag with `chflags nouchg`)", path, le.Err, path)
+	default:
+		return err
+	}
+}
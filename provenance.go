@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// provenanceShown is the number of the latest operations shown in the chain
+const provenanceShown = 4
+
+// loopRestores is the times restored from which the file is highlighted as
+// stuck in a delete/restore loop
+const loopRestores = 3
+
+// Provenance represents the operations on the original path of the entry
+// up to trashing it, taken from the audit log
+type Provenance struct {
+	Restored int          // times the path has been restored
+	Chain    []AuditEntry // trash and restore in the order
+}
+
+// provenances returns the function to get the provenance of the entry
+// The audit log is read only once when the first one is asked, since it's
+// only shown for the entries looked at in the prompt.
+func (c CLI) provenances() func(File) Provenance {
+	var chains map[string][]AuditEntry
+	return func(file File) Provenance {
+		if chains == nil {
+			chains = map[string][]AuditEntry{}
+			entries, err := c.readAudit()
+			if err != nil {
+				log.Printf("[WARN] failed to read audit log: %v", err)
+			}
+			for _, entry := range entries {
+				if entry.Op == opTrash || entry.Op == opRestore {
+					chains[entry.From] = append(chains[entry.From], entry)
+				}
+			}
+		}
+		var p Provenance
+		for _, entry := range chains[file.From] {
+			p.Chain = append(p.Chain, entry)
+			if entry.Op == opRestore {
+				p.Restored++
+			}
+			if entry.ID == file.ID && entry.Op == opTrash {
+				// not the operations on the path after this one
+				break
+			}
+		}
+		return p
+	}
+}
+
+// history returns the chain of the provenance shortly for the details in
+// the prompt, e.g. "restored 2 time(s): trashed 5 days ago → restored ...",
+// or empty if it has never been restored
+func (c CLI) history(p Provenance) string {
+	if p.Restored == 0 {
+		return ""
+	}
+	chain := p.Chain
+	var ops []string
+	if len(chain) > provenanceShown {
+		chain = chain[len(chain)-provenanceShown:]
+		ops = append(ops, "…")
+	}
+	for _, entry := range chain {
+		op := "trashed"
+		if entry.Op == opRestore {
+			op = "restored"
+		}
+		ops = append(ops, fmt.Sprintf("%s %s", op, c.ago(entry.Time)))
+	}
+	return fmt.Sprintf("restored %d time(s): %s", p.Restored, strings.Join(ops, " → "))
+}
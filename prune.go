@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// PruneOption represents the options of prune command
+type PruneOption struct {
+	DryRun bool `short:"n" long:"dry-run" description:"Only show what would be pruned"`
+	AsOf   Time `long:"as-of" value-name:"TIME" description:"Pretend that now is this time (e.g. 2024-05-01, 30d)"`
+	Report bool `long:"report" description:"Show which entries each policy would prune without deleting anything"`
+
+	OlderThan Duration `long:"older-than" value-name:"DURATION" description:"Prune the files deleted more than this duration ago instead of retention.max_age and trash.quota (e.g. 30d)"`
+}
+
+// Prune deletes trashed files permanently based on the retention policy in config
+// The files older than max_age are deleted first, and then the oldest files are
+// evicted until the trash size gets under the quota
+func (c CLI) Prune(ctx context.Context) error {
+	if age := c.Option.Prune.OlderThan; age > 0 {
+		// only for this run, the other protections (e.g. retention.keep) still apply
+		c.Config.Retention.MaxAge = age
+		c.Config.Trash.Quota = 0
+	}
+	cfg := c.Config
+	if cfg.Retention.MaxAge == 0 && cfg.Trash.Quota == 0 && !c.hasExpiry() {
+		return errors.New("no retention policy configured (retention.max_age or trash.quota)")
+	}
+	now := c.Clock.Now()
+	if c.Option.Prune.Report {
+		return c.pruneReport(now)
+	}
+	expired, evicted := c.retain(now)
+	if err := c.purge(ctx, append(expired, evicted...), c.Option.Prune.DryRun); err != nil {
+		return err
+	}
+	if !c.Option.Prune.DryRun {
+		c.sweepEmptyDirs()
+	}
+	return nil
+}
+
+// pruneReport prints the entries which would be pruned grouped by the policy
+func (c CLI) pruneReport(now time.Time) error {
+	expired, evicted := c.retain(now)
+	var aged, overridden []File
+	for _, file := range expired {
+		if file.Expires != nil {
+			overridden = append(overridden, file)
+		} else {
+			aged = append(aged, file)
+		}
+	}
+	type rule struct {
+		name  string
+		files []File
+	}
+	var rules []rule
+	if c.hasExpiry() {
+		rules = append(rules, rule{"expire (per entry)", overridden})
+	}
+	if c.Config.Retention.MaxAge > 0 {
+		name := "retention.max_age"
+		if c.Option.Prune.OlderThan > 0 {
+			name = "--older-than"
+		}
+		rules = append(rules, rule{fmt.Sprintf("%s (%s)", name, c.Config.Retention.MaxAge), aged})
+	}
+	if c.Config.Trash.Quota > 0 {
+		rules = append(rules, rule{fmt.Sprintf("trash.quota (%s)", c.Config.Trash.Quota), evicted})
+	}
+
+	var total int64
+	var count int
+	for i, rule := range rules {
+		if i > 0 {
+			fmt.Fprintln(c.Stdout)
+		}
+		var size int64
+		for _, file := range rule.files {
+			size += file.Size
+		}
+		fmt.Fprintf(c.Stdout, "%s: %d file(s), %s\n", rule.name, len(rule.files), humanize.Bytes(uint64(size)))
+		if len(rule.files) > 0 {
+			rows := [][]string{{"ID", "DELETED", "SIZE", "PATH"}}
+			for _, file := range rule.files {
+				rows = append(rows, []string{
+					file.ID, c.ago(file.Timestamp), humanize.Bytes(uint64(file.Size)), file.From,
+				})
+			}
+			if err := printTable(c.Stdout, rows); err != nil {
+				return err
+			}
+		}
+		total += size
+		count += len(rule.files)
+	}
+	fmt.Fprintf(c.Stdout, "\ntotal: %d file(s), %s reclaimable\n", count, humanize.Bytes(uint64(total)))
+	if len(c.Config.Retention.Keep) > 0 {
+		var kept int
+		for _, file := range c.Inventory.Files {
+			if file.ID != "" && c.kept(file) {
+				kept++
+			}
+		}
+		fmt.Fprintf(c.Stdout, "kept by retention.keep: %d file(s)\n", kept)
+	}
+	return nil
+}
+
+// kept returns true if the original path of the file matches retention.keep
+// A pattern matches the path itself and the paths under it.
+func (c CLI) kept(file File) bool {
+	for _, pattern := range c.Config.Retention.Keep {
+		pattern = expandHome(pattern)
+		for path := file.From; ; path = filepath.Dir(path) {
+			if ok, _ := filepath.Match(pattern, path); ok {
+				log.Printf("[DEBUG] %s: kept by retention.keep %q", file.ID, pattern)
+				return true
+			}
+			if path == filepath.Dir(path) {
+				break
+			}
+		}
+	}
+	return false
+}
+
+// retain returns the inventory entries which should be deleted at the time
+// based on the retention policy: the ones expired by max_age and the ones
+// evicted to keep quota
+// The expiry set by expire command takes precedence over keep, keep_accessed,
+// max_age and quota, and only pin takes precedence over it.
+func (c CLI) retain(now time.Time) (expired, evicted []File) {
+	var files []File
+	for _, file := range c.Inventory.Files {
+		if file.ID != "" {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Timestamp.Before(files[j].Timestamp)
+	})
+
+	var size int64
+	var rest []File
+	maxAge := time.Duration(c.Config.Retention.MaxAge)
+	for _, file := range files {
+		if file.Pinned {
+			// pinned files are never deleted by the policy
+			// but they are still counted for quota
+			size += file.Size
+			continue
+		}
+		if file.NoExpire || file.Expires != nil && !now.After(*file.Expires) {
+			// held until the expiry like pinned files
+			size += file.Size
+			continue
+		}
+		if file.Expires != nil {
+			// expired explicitly even if it matches keep or keep_accessed
+			log.Printf("[DEBUG] %s: expired (expires at %s)", file.ID, file.Expires)
+			expired = append(expired, file)
+			continue
+		}
+		if c.kept(file) || accessedWithin(file, now, time.Duration(c.Config.Retention.KeepAccessed)) {
+			// kept from max_age and quota like pinned files
+			size += file.Size
+			continue
+		}
+		if maxAge > 0 && now.Sub(file.Timestamp) > maxAge {
+			log.Printf("[DEBUG] %s: expired (deleted at %s)", file.ID, file.Timestamp)
+			expired = append(expired, file)
+			continue
+		}
+		size += file.Size
+		rest = append(rest, file)
+	}
+
+	quota := int64(c.Config.Trash.Quota)
+	for _, file := range rest {
+		if quota == 0 || size <= quota {
+			break
+		}
+		// evict from the oldest one
+		log.Printf("[DEBUG] %s: evicted to keep quota", file.ID)
+		evicted = append(evicted, file)
+		size -= file.Size
+	}
+
+	return expired, evicted
+}
+
+// hasExpiry returns true if any file has the expiry set by expire command
+func (c CLI) hasExpiry() bool {
+	for _, file := range c.Inventory.Files {
+		if file.Expires != nil {
+			return true
+		}
+	}
+	return false
+}
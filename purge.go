@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/dustin/go-humanize"
+)
+
+// PurgeOption represents the options of purge command
+type PurgeOption struct {
+	QueryOption
+	DryRun bool `short:"n" long:"dry-run" description:"Only show what would be purged"`
+	AsOf   Time `long:"as-of" value-name:"TIME" description:"Pretend that now is this time (e.g. 2024-05-01, 30d)"`
+}
+
+// Purge deletes trashed files permanently which match the filters
+func (c CLI) Purge(ctx context.Context) error {
+	opt := c.Option.Purge
+	if opt.IsEmpty() {
+		return errors.New("at least one filter is required (see --help)")
+	}
+
+	var files []File
+	for _, file := range c.Query(opt.QueryOption, c.Clock.Now()) {
+		if file.Pinned {
+			log.Printf("[DEBUG] %s: skipped since it's pinned", file.ID)
+			continue
+		}
+		files = append(files, file)
+	}
+	return c.purge(ctx, files, opt.DryRun)
+}
+
+// purge deletes the given files from gomi dir and inventory
+func (c CLI) purge(ctx context.Context, files []File, dryRun bool) error {
+	verb := "purged"
+	if dryRun {
+		verb = "would purge"
+	}
+
+	var purged []File
+	var size int64
+	var err error
+	for _, file := range files {
+		if err = interrupted(ctx); err != nil {
+			// delete the ones purged so far from the inventory
+			break
+		}
+		if !dryRun {
+			log.Printf("[DEBUG] purging %q", file.To)
+			c.progress(progressStart, opPurge, file, nil)
+			if err := c.FS.RemoveAll(file.To); err != nil {
+				fmt.Fprintf(c.Stderr, "%s: %v\n", file.To, err)
+				c.progress(progressError, opPurge, file, err)
+				continue
+			}
+			c.progress(progressDone, opPurge, file, nil)
+			c.removeSidecar(file)
+			c.removeModes(file)
+			removeEmptyDirs(c.FS, c.Dir, filepath.Dir(file.To))
+		}
+		if dryRun || !c.quiet() {
+			path := file.From
+			if path == "" {
+				// the payload without entry (see orphanPayloads)
+				path = file.To
+			}
+			fmt.Fprintf(c.Stdout, "%s %s (%s, deleted %s)\n",
+				verb, path, humanize.Bytes(uint64(file.Size)), c.ago(file.Timestamp))
+		}
+		purged = append(purged, file)
+		size += file.Size
+	}
+
+	if dryRun {
+		fmt.Fprintf(c.Stdout, "%s %d file(s), %s reclaimed\n", verb, len(purged), humanize.Bytes(uint64(size)))
+	} else {
+		c.info("%s %d file(s), %s reclaimed", verb, len(purged), humanize.Bytes(uint64(size)))
+	}
+	if dryRun || len(purged) == 0 {
+		return err
+	}
+	if err := c.Inventory.Delete(purged...); err != nil {
+		return err
+	}
+	c.removeOpenCopies(purged...)
+	c.audit(opPurge, purged...)
+	return err
+}
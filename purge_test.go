@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPurgeAsOfRelative(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	ctx := context.Background()
+
+	e.WriteFile("/work/a.txt", "a")
+	if err := e.CLI.Remove(ctx, []string{"/work/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	e.Reload()
+
+	// 20 days before the clock (testNow), not before the wall clock
+	e.CLI.Command = "purge"
+	e.CLI.Option.Purge.OlderThan = Duration(10 * 24 * time.Hour)
+	if err := e.CLI.Option.Purge.AsOf.UnmarshalFlag("-20d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CLI.Run(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	e.Reload()
+	if len(e.CLI.Inventory.Files) != 1 {
+		t.Errorf("purged the file trashed after --as-of")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// QueryOption represents the filters to select inventory entries
+type QueryOption struct {
+	OlderThan Duration `long:"older-than" value-name:"DURATION" description:"Only files deleted before this duration (e.g. 90d, 12h)"`
+	Under     string   `long:"under" value-name:"DIR" description:"Only files which were originally under this directory"`
+	MinSize   Size     `long:"min-size" value-name:"SIZE" description:"Only files larger than this size (e.g. 100M)"`
+	Tags      []string `long:"tag" value-name:"TAG" description:"Only files which have this tag (can be given multiple times)"`
+	Note      string   `long:"note" value-name:"TEXT" description:"Only files whose note contains this text"`
+	Source    string   `long:"source" value-name:"GLOB" description:"Only files deleted by the tool given with --source (e.g. 'makefile:*')"`
+	Manual    bool     `long:"manual" description:"Only files deleted without --source"`
+}
+
+// IsEmpty returns true if no filters are given
+func (q QueryOption) IsEmpty() bool {
+	return q.OlderThan == 0 && q.Under == "" && q.MinSize == 0 &&
+		len(q.Tags) == 0 && q.Note == "" && q.Source == "" && !q.Manual
+}
+
+// Match returns true if the file matches all the given filters
+func (q QueryOption) Match(file File, now time.Time) bool {
+	if file.ID == "" {
+		// invalid log
+		return false
+	}
+	if q.OlderThan > 0 && now.Sub(file.Timestamp) < time.Duration(q.OlderThan) {
+		return false
+	}
+	if q.Under != "" && !isUnder(file.From, expandHome(q.Under)) {
+		return false
+	}
+	if q.MinSize > 0 && file.Size < int64(q.MinSize) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !file.HasTag(tag) {
+			return false
+		}
+	}
+	if q.Note != "" && !strings.Contains(strings.ToLower(file.Note), strings.ToLower(q.Note)) {
+		return false
+	}
+	if q.Source != "" {
+		if ok, _ := path.Match(q.Source, file.Source); !ok {
+			return false
+		}
+	}
+	if q.Manual && file.Source != "" {
+		return false
+	}
+	return true
+}
+
+// Query returns the inventory entries which match the filters
+func (c CLI) Query(q QueryOption, now time.Time) []File {
+	var files []File
+	for _, file := range c.Inventory.Files {
+		if q.Match(file, now) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// isUnder returns true if path is dir itself or under dir
+func isUnder(path, dir string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// expandHome expands "~" at the beginning of path to the home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return filepath.Join(os.Getenv("HOME"), path[1:])
+	}
+	return path
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/manifoldco/promptui"
+)
+
+// These are the profiles which change the behavior globally
+const (
+	profileDefault = "default"
+	profileQuiet   = "quiet" // no notices, notifications, progress and colors
+)
+
+// quiet returns true if the quiet profile is enabled
+// e.g. when gomi is used in scripts and Makefiles
+func (c CLI) quiet() bool {
+	return c.Config.Profile == profileQuiet
+}
+
+// notice prints the non-essential message to stderr
+func (c CLI) notice(format string, args ...interface{}) {
+	if c.quiet() {
+		return
+	}
+	fmt.Fprintf(c.Stderr, "gomi: "+format+"\n", args...)
+}
+
+// info prints the non-essential message such as a summary to stdout
+func (c CLI) info(format string, args ...interface{}) {
+	if c.quiet() {
+		return
+	}
+	fmt.Fprintf(c.Stdout, format+"\n", args...)
+}
+
+// disableColors makes the prompts plain
+func disableColors() {
+	for name := range promptui.FuncMap {
+		promptui.FuncMap[name] = func(v interface{}) string {
+			return fmt.Sprint(v)
+		}
+	}
+	promptui.IconInitial = "?"
+	promptui.IconGood = "✔"
+	promptui.IconWarn = "⚠"
+	promptui.IconBad = "✗"
+	promptui.IconSelect = "▸"
+}
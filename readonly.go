@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// modesSuffix is appended to the payload path of a directory to make the
+// path of the original modes of the files made read-only in it
+const modesSuffix = ".modes.json"
+
+// modeBits are the bits of the mode which chmod changes
+const modeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// protect makes the files in the payload read-only (trash.read_only) not to
+// modify them by accident when browsing gomi dir directly
+// The directories are left writable so that gomi can still move and purge
+// them, and the files with other hard links are left as they are. The
+// original modes of the files in a directory are written next to the
+// payload before changing them, and restored by unprotect.
+// Failing to protect it doesn't fail trashing the file.
+func (c CLI) protect(file File) {
+	if !c.Config.Trash.ReadOnly || file.IsNode() {
+		return
+	}
+	modes := map[string]os.FileMode{}
+	err := c.FS.Walk(file.To, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || fi.Mode()&0222 == 0 {
+			return nil
+		}
+		if _, _, nlink := inode(fi); nlink > 1 {
+			// the mode is shared with the other hard links outside gomi dir
+			return nil
+		}
+		rel, err := filepath.Rel(file.To, path)
+		if err != nil {
+			return err
+		}
+		modes[filepath.ToSlash(rel)] = fi.Mode() & modeBits
+		return nil
+	})
+	if err == nil && file.Type == typeDir && len(modes) > 0 {
+		var data []byte
+		if data, err = json.Marshal(modes); err == nil {
+			err = writeFile(c.FS, file.To+modesSuffix, data, c.Config.Trash.FileMode.Perm())
+		}
+	}
+	for rel, mode := range modes {
+		if err != nil {
+			break
+		}
+		err = c.FS.Chmod(filepath.Join(file.To, filepath.FromSlash(rel)), mode&^0222)
+	}
+	if err != nil {
+		log.Printf("[WARN] failed to make %s read-only: %v", file.To, err)
+	}
+}
+
+// unprotect gives the original modes back to the files made read-only by
+// protect, restored at path
+// A regular file gets the mode in the entry, which is the same as before
+// trashing it even if it was not protected.
+func (c CLI) unprotect(file File, path string) {
+	var err error
+	switch file.Type {
+	case typeFile:
+		err = c.FS.Chmod(path, file.Mode&modeBits)
+	case typeDir:
+		err = c.unprotectDir(file, path)
+	}
+	if err != nil {
+		log.Printf("[WARN] failed to restore the modes of %s: %v", path, err)
+	}
+}
+
+func (c CLI) unprotectDir(file File, path string) error {
+	f, err := c.FS.Open(file.To + modesSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	var modes map[string]os.FileMode
+	if err := json.Unmarshal(data, &modes); err != nil {
+		return err
+	}
+	for rel, mode := range modes {
+		err := c.FS.Chmod(filepath.Join(path, filepath.FromSlash(rel)), mode)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return c.removeModes(file)
+}
+
+// removeModes removes the modes written by protect
+func (c CLI) removeModes(file File) error {
+	err := c.FS.Remove(file.To + modesSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
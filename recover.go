@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// These are the ways to recover the interrupted operation
+const (
+	recoverForward = "Roll forward (complete the operation)"
+	recoverBack    = "Roll back (undo the operation)"
+	recoverLater   = "Ask me later"
+)
+
+// Recover detects the operations interrupted by crash using the journal
+// and asks the user whether to complete them or undo them
+// If it's not interactive, the operations are completed so that no files
+// are left unrecorded in gomi dir
+func (c CLI) Recover() error {
+	entries, err := c.Journal.Pending()
+	if err != nil {
+		return err
+	}
+	var pending []JournalEntry
+	for _, entry := range entries {
+		if !entry.Interrupted() {
+			log.Printf("[DEBUG] %s of %s is in progress by pid %d", entry.Op, entry.File.ID, entry.PID)
+			continue
+		}
+		if entry.Op == opTrash {
+			c.cleanStaging(entry)
+		}
+		pending = append(pending, entry)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	log.Printf("[INFO] found %d interrupted operation(s)", len(pending))
+	if err := c.Inventory.Load(); err != nil {
+		return err
+	}
+
+	var recovered []JournalEntry
+	for _, entry := range pending {
+		file := entry.File
+		from, to := file.From, file.To
+		if entry.Op == opRestore {
+			from, to = file.To, file.From
+		}
+		moved := c.exists(to) && !c.exists(from)
+		if file.IsNode() {
+			moved = entry.Op == opTrash && !c.exists(file.From) || entry.Op == opRestore && c.exists(file.From)
+		}
+		_, recorded := c.Inventory.Find(file.ID)
+
+		// nothing to do if the file has not been moved yet
+		// or the inventory is already up to date
+		if !moved || entry.Op == opTrash && recorded || entry.Op == opRestore && !recorded {
+			recovered = append(recovered, entry)
+			continue
+		}
+
+		action := recoverForward
+		if terminal.IsTerminal(int(os.Stdin.Fd())) {
+			label := fmt.Sprintf("gomi was interrupted while %sing %s (%s)",
+				entry.Op, file.From, c.ago(entry.Time))
+			action, err = c.choose(label, []string{recoverForward, recoverBack, recoverLater})
+			if err != nil {
+				return err
+			}
+		}
+
+		switch action {
+		case recoverForward:
+			if entry.Op == opTrash {
+				err = c.Inventory.Save([]File{file})
+			} else {
+				err = c.Inventory.Delete(file)
+			}
+		case recoverBack:
+			if file.IsNode() {
+				err = fmt.Errorf("%s: %s cannot be rolled back", file.From, file.Type)
+			} else {
+				err = move(context.Background(), c.FS, to, from)
+			}
+		case recoverLater:
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "%s: failed to recover: %v\n", file.From, err)
+			continue
+		}
+		if action == recoverForward {
+			c.audit(entry.Op, file)
+		}
+		if (action == recoverForward) == (entry.Op == opRestore) && !file.IsNode() {
+			// the payload made read-only is now at the original path
+			c.unprotect(file, file.From)
+		}
+		c.notice("recovered the interrupted %s of %s", entry.Op, file.From)
+		recovered = append(recovered, entry)
+	}
+
+	for _, entry := range recovered {
+		if err := c.Journal.Done(entry.Op, entry.File); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c CLI) exists(path string) bool {
+	_, err := c.FS.Lstat(path)
+	return err == nil
+}
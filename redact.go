@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	clilog "github.com/b4b4r07/go-cli-log"
+)
+
+// redactKeyFile is the key of the hashes made by redactPath in gomi dir
+const redactKeyFile = "redact.key"
+
+// redactKey is the random key of this install to hash the names with HMAC
+// so that the common names cannot be guessed from the hashes with a
+// dictionary. It's read (or created) on the first use.
+var redactKey struct {
+	once sync.Once
+	fs   FS
+	path string
+	key  []byte
+}
+
+// setRedactKey sets where the key of redactPath is kept
+// The failures are not injected into reading it not to log while redacting the log.
+func setRedactKey(fs FS, dir string) {
+	if f, ok := fs.(*faultFS); ok {
+		fs = f.FS
+	}
+	redactKey.fs, redactKey.path = fs, filepath.Join(dir, redactKeyFile)
+}
+
+// loadRedactKey reads the key of redactPath, creating it if it doesn't exist
+func loadRedactKey(fs FS, path string) ([]byte, error) {
+	key, err := readKey(fs, path)
+	if !os.IsNotExist(err) {
+		return key, err
+	}
+	if key, err = generateKey(); err != nil {
+		return nil, err
+	}
+	if err := fs.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		// created by another gomi just now
+		return readKey(fs, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintln(f, hex.EncodeToString(key)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return key, f.Close()
+}
+
+// redactHash returns the short hash of the name by the key of this install
+func redactHash(name string) string {
+	redactKey.once.Do(func() {
+		if redactKey.fs != nil {
+			redactKey.key, _ = loadRedactKey(redactKey.fs, redactKey.path)
+		}
+		if redactKey.key == nil {
+			// not stable across the runs, but still cannot be guessed
+			redactKey.key, _ = generateKey()
+		}
+	})
+	mac := hmac.New(sha256.New, redactKey.key)
+	mac.Write([]byte(name))
+	return hex.EncodeToString(mac.Sum(nil)[:4])
+}
+
+// redactPath replaces each component of the path with its short hash
+// so that the directory structure can be shared without the names
+// The same name is always replaced with the same hash (see redactKey), and the home dir,
+// gomi dir and the extension are kept to make the output still useful
+// for bug reports, e.g. "~/9f86d081/2c26b46b.pdf"
+func redactPath(path string) string {
+	var prefix string
+	home := os.Getenv("HOME")
+	switch {
+	case home != "" && (path == home || strings.HasPrefix(path, home+string(filepath.Separator))):
+		prefix, path = "~", strings.TrimPrefix(path, home)
+	case filepath.VolumeName(path) != "":
+		prefix = filepath.VolumeName(path)
+		path = strings.TrimPrefix(path, prefix)
+	}
+	parts := strings.Split(path, string(filepath.Separator))
+	for i, part := range parts {
+		if part == "" || part == gomiDir || part == "." || part == ".." {
+			continue
+		}
+		base, ext := splitExt(part)
+		parts[i] = redactHash(base) + ext
+	}
+	return prefix + strings.Join(parts, string(filepath.Separator))
+}
+
+// pathPattern matches the absolute paths in the log messages
+var pathPattern = regexp.MustCompile(`(^|[\s"'=(\[])(/[^\s"',;()\[\]]+|[A-Za-z]:\\[^\s"',;()\[\]]+)`)
+
+// namePattern matches the names in the inventory entries dumped as JSON
+var namePattern = regexp.MustCompile(`"(name|note|link)":"((?:[^"\\]|\\.)*)"`)
+
+// redacting is true if the paths in the debug log are redacted
+var redacting bool
+
+// redactWriter redacts the paths in the log messages before writing them
+type redactWriter struct {
+	w io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	redacted := pathPattern.ReplaceAllStringFunc(string(p), func(s string) string {
+		m := pathPattern.FindStringSubmatch(s)
+		return m[1] + redactPath(m[2])
+	})
+	redacted = namePattern.ReplaceAllStringFunc(redacted, func(s string) string {
+		m := namePattern.FindStringSubmatch(s)
+		return `"` + m[1] + `":"` + redactPath(m[2]) + `"`
+	})
+	if _, err := io.WriteString(r.w, redacted); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setLogOutput sets up the debug log like clilog.SetOutput
+// With GOMI_LOG_REDACT, the paths in the log are redacted by redactPath
+func setLogOutput() {
+	out, err := clilog.LogOutput()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if out == nil {
+		out = ioutil.Discard
+	}
+	if os.Getenv("GOMI_LOG_REDACT") != "" {
+		out = redactWriter{w: out}
+		redacting = true
+	}
+	log.SetOutput(out)
+}
+
+// redactArgs returns the arguments to log, which may be relative paths
+func redactArgs(args []string) []string {
+	if !redacting {
+		return args
+	}
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = arg
+		if !strings.HasPrefix(arg, "-") {
+			redacted[i] = redactPath(arg)
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRedactPath(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	// as a new gomi process
+	redactKey.once, redactKey.key = sync.Once{}, nil
+	setRedactKey(e.CLI.FS, e.CLI.Dir)
+
+	got := redactPath("/srv/secret/passwords.txt")
+	parts := strings.Split(got, "/")
+	if len(parts) != 4 || parts[0] != "" || !strings.HasSuffix(parts[3], ".txt") {
+		t.Fatalf("redactPath = %q, want /<hash>/<hash>/<hash>.txt", got)
+	}
+	if redactPath("/srv/secret/passwords.txt") != got {
+		t.Error("redactPath is not stable")
+	}
+	// not the plain hash which can be looked up with a dictionary
+	sum := sha256.Sum256([]byte("passwords"))
+	if strings.TrimSuffix(parts[3], ".txt") == hex.EncodeToString(sum[:4]) {
+		t.Error("redactPath hashes the name without the key")
+	}
+	if !e.Exists(filepath.Join(e.CLI.Dir, redactKeyFile)) {
+		t.Errorf("%s: key not created", redactKeyFile)
+	}
+}
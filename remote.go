@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+)
+
+// RemoteOption represents the options of remote command
+type RemoteOption struct {
+	Restore bool   `long:"restore" description:"Restore the remote file instead of trashing it"`
+	SSH     string `long:"ssh" value-name:"COMMAND" default:"ssh" description:"Command to connect to the host (e.g. \"ssh -p 2222\")"`
+	Gomi    string `long:"gomi" value-name:"PATH" default:"gomi" description:"gomi on the remote host"`
+}
+
+// Remote trashes the files on other hosts given as [user@]host:path into the
+// trash on each host, by running gomi serve there over SSH
+// With --restore, it runs the restore prompt on the host instead.
+// Relative paths are relative to the home directory on the host, like scp.
+func (c CLI) Remote(args []string) error {
+	opt := c.Option.Remote
+	if len(args) == 0 {
+		return errors.New("remote [user@]host:path...: no files given")
+	}
+	ssh := strings.Fields(opt.SSH)
+	if len(ssh) == 0 {
+		return fmt.Errorf("--ssh: %q is not a command", opt.SSH)
+	}
+
+	var hosts []string
+	paths := map[string][]string{}
+	for _, arg := range args {
+		i := strings.Index(arg, ":")
+		if i <= 0 || i == len(arg)-1 {
+			return fmt.Errorf("%s: should be [user@]host:path", arg)
+		}
+		host, path := arg[:i], arg[i+1:]
+		if _, ok := paths[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		paths[host] = append(paths[host], path)
+	}
+
+	var failed int
+	for _, host := range hosts {
+		var err error
+		if opt.Restore {
+			err = c.remoteRestore(ssh, host, paths[host])
+		} else {
+			err = c.remoteTrash(ssh, host, paths[host])
+		}
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "%s: %v\n", host, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed on %d of %d host(s)", failed, len(hosts))
+	}
+	return nil
+}
+
+// remoteTrash sends one trash request to gomi serve on the host
+func (c CLI) remoteTrash(ssh []string, host string, paths []string) error {
+	source := c.Option.Source
+	if source == "" {
+		source = "remote"
+	}
+	req, err := json.Marshal(serveRequest{
+		Op:     opTrash,
+		Paths:  paths,
+		Note:   c.Option.Message,
+		Tags:   c.Option.Tags,
+		Source: source,
+	})
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(ssh[0], append(ssh[1:], host, c.Option.Remote.Gomi, "serve")...)
+	cmd.Stdin = strings.NewReader(string(req) + "\n")
+	cmd.Stderr = c.Stderr
+	log.Printf("[DEBUG] running %v", cmd.Args)
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("gomi serve: %v", err)
+	}
+
+	var resp serveResponse
+	line := strings.SplitN(string(out), "\n", 2)[0]
+	if err := json.Unmarshal([]byte(line), &resp); err != nil {
+		return fmt.Errorf("gomi serve: unexpected response %q", strings.TrimSpace(line))
+	}
+	for _, result := range resp.Results {
+		if result.Error != "" {
+			fmt.Fprintf(c.Stderr, "%s:%s: %s\n", host, result.Path, result.Error)
+			continue
+		}
+		c.verbose("removed '%s:%s'", host, result.Path)
+	}
+	if !resp.OK {
+		if resp.Error != "" {
+			return errors.New(resp.Error)
+		}
+		return errors.New("some files could not be trashed")
+	}
+	return nil
+}
+
+// remoteRestore runs the restore prompt of gomi on the host for each path
+func (c CLI) remoteRestore(ssh []string, host string, paths []string) error {
+	for _, path := range paths {
+		// the remote path is not cleaned locally since the remote may not be the same OS
+		trimmed := strings.TrimRight(path, "/")
+		name := trimmed[strings.LastIndex(trimmed, "/")+1:]
+		if name == "" {
+			return fmt.Errorf("%s:%s: no file name to restore", host, path)
+		}
+		cmd := exec.Command(ssh[0], append(ssh[1:], "-t", host, c.Option.Remote.Gomi, "restore", shellQuote(name))...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = c.Stdin, c.Stdout, c.Stderr
+		log.Printf("[DEBUG] running %v", cmd.Args)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("gomi restore %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes the word for the remote shell which ssh runs the command with
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// ReportOption represents the options of report command
+type ReportOption struct {
+	Weekly bool `long:"weekly" description:"Summarize the last 7 days"`
+}
+
+// reportTop is the number of the largest deletions in the report
+const reportTop = 5
+
+// Report prints the digest of the trash activity in the period
+// (e.g. to be mailed from cron), based on the audit log and the stats cache
+func (c CLI) Report() error {
+	if !c.Option.Report.Weekly {
+		return errors.New("specify the period of the report (--weekly)")
+	}
+	now := c.Clock.Now()
+	since := now.AddDate(0, 0, -7)
+	entries, err := c.readAudit()
+	if err != nil {
+		return err
+	}
+	stats, err := c.Inventory.readStats()
+	if err != nil {
+		return err
+	}
+
+	type total struct {
+		count int
+		size  int64
+	}
+	totals := map[string]*total{opTrash: {}, opRestore: {}, opPurge: {}}
+	days := make([]int64, 7) // the change of the trash size on each day
+	var deleted []AuditEntry
+	for _, entry := range entries {
+		if entry.Time.Before(since) || entry.Time.After(now) {
+			continue
+		}
+		op := entry.Op
+		switch op {
+		case opImport:
+			op = opTrash
+		case opExport:
+			// gone from the trash like purged
+			op = opPurge
+		}
+		t, ok := totals[op]
+		if !ok {
+			continue
+		}
+		t.count++
+		t.size += entry.Size
+		delta := entry.Size
+		if op != opTrash {
+			delta = -delta
+		} else {
+			deleted = append(deleted, entry)
+		}
+		if day := int(entry.Time.Sub(since) / (24 * time.Hour)); day >= 0 && day < len(days) {
+			days[day] += delta
+		}
+	}
+	var change int64
+	for _, delta := range days {
+		change += delta
+	}
+
+	w := c.Stdout
+	fmt.Fprintf(w, "gomi weekly report: %s - %s\n\n", since.Local().Format("2006-01-02"), now.Local().Format("2006-01-02"))
+	fmt.Fprintf(w, "Deleted:   %d file(s), %s\n", totals[opTrash].count, humanize.Bytes(uint64(totals[opTrash].size)))
+	fmt.Fprintf(w, "Restored:  %d file(s), %s\n", totals[opRestore].count, humanize.Bytes(uint64(totals[opRestore].size)))
+	fmt.Fprintf(w, "Purged:    %d file(s), %s\n", totals[opPurge].count, humanize.Bytes(uint64(totals[opPurge].size)))
+	fmt.Fprintf(w, "Trash now: %d file(s), %s (%s this week)\n", stats.Count, humanize.Bytes(uint64(stats.Size)), signedBytes(change))
+
+	fmt.Fprintf(w, "\nSpace trend:\n")
+	size := stats.Size - change
+	rows := [][]string{{"DAY", "CHANGE", "SIZE"}}
+	for i, delta := range days {
+		size += delta
+		rows = append(rows, []string{
+			since.AddDate(0, 0, i+1).Local().Format("Mon 01/02"), signedBytes(delta), humanize.Bytes(uint64(size)),
+		})
+	}
+	if err := printTable(w, rows); err != nil {
+		return err
+	}
+
+	if len(deleted) > 0 {
+		sort.SliceStable(deleted, func(i, j int) bool {
+			return deleted[i].Size > deleted[j].Size
+		})
+		if len(deleted) > reportTop {
+			deleted = deleted[:reportTop]
+		}
+		fmt.Fprintf(w, "\nLargest deletions:\n")
+		rows := [][]string{{"SIZE", "DELETED", "PATH"}}
+		for _, entry := range deleted {
+			rows = append(rows, []string{
+				humanize.Bytes(uint64(entry.Size)), entry.Time.Local().Format("Mon 15:04"), entry.From,
+			})
+		}
+		return printTable(w, rows)
+	}
+	return nil
+}
+
+// signedBytes returns the size with the sign like "+1.2 GB"
+func signedBytes(n int64) string {
+	if n < 0 {
+		return "-" + humanize.Bytes(uint64(-n))
+	}
+	return "+" + humanize.Bytes(uint64(n))
+}
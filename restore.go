@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/manifoldco/promptui"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// RestoreOption represents the options of restore command
+type RestoreOption struct {
+	Group  string `long:"group" value-name:"ID" description:"Restore all the files deleted in one operation (see --print-id)"`
+	Date   Time   `long:"date" value-name:"DATE" description:"Restore all the files deleted on the day (e.g. 2024-03-01)"`
+	Under  string `long:"under" value-name:"DIR" description:"With --date, only files which were originally under this directory"`
+	List   bool   `long:"list" description:"With --date, only list the files to restore"`
+	To     string `long:"to" value-name:"DIR" description:"Restore the files into this directory instead of their original place"`
+	DryRun bool   `short:"n" long:"dry-run" description:"Only show what restoring would do (conflicts are renamed)"`
+
+	MetadataOnly bool `long:"metadata-only" description:"Only create empty placeholders with the names, modes and mtimes of the files of the given IDs (the contents stay in the trash)"`
+}
+
+// RestoreByName restores the file whose name contains the given word
+// If multiple files match, it asks which one with the list of only them.
+// Without the word, it's the same as --restore.
+func (c CLI) RestoreByName(ctx context.Context, args []string) error {
+	if c.Option.RestoreCmd.MetadataOnly {
+		return c.RestoreMetadataOnly(args)
+	}
+	if id := c.Option.RestoreCmd.Group; id != "" {
+		if len(args) > 0 {
+			return errors.New("restore --group: name cannot be given together")
+		}
+		return c.RestoreByGroupID(ctx, id)
+	}
+	if !c.Option.RestoreCmd.Date.IsZero() {
+		if len(args) > 0 {
+			return errors.New("restore --date: name cannot be given together")
+		}
+		return c.RestoreByDate(ctx)
+	}
+	switch len(args) {
+	case 0:
+		return c.Restore(ctx)
+	case 1:
+	default:
+		return errors.New("restore [name]: too many arguments")
+	}
+
+	word := strings.ToLower(args[0])
+	var files []File
+	all, stores := c.federated()
+	for _, file := range all {
+		if file.ID != "" && strings.Contains(strings.ToLower(file.Name), word) {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Timestamp.After(files[j].Timestamp)
+	})
+
+	var file File
+	switch len(files) {
+	case 0:
+		return notFound(args[0])
+	case 1:
+		file = files[0]
+	default:
+		var err error
+		file, err = c.disambiguate(args[0], files)
+		if err != nil {
+			return err
+		}
+	}
+	return c.restoreFederated(ctx, stores, []File{file})
+}
+
+// RestoreByPath restores the files given by their IDs or original paths
+// without the prompt (--restore <path-or-id>), e.g. from scripts
+// If the path has been trashed more than once, the latest one is restored.
+func (c CLI) RestoreByPath(ctx context.Context, args []string) error {
+	all, stores := c.federated()
+	var files []File
+	seen := map[string]bool{}
+	for _, arg := range args {
+		file, ok := findByPath(all, arg)
+		if !ok {
+			return notFound(arg)
+		}
+		if !seen[file.ID] {
+			seen[file.ID] = true
+			files = append(files, file)
+		}
+	}
+	return c.restoreFederated(ctx, stores, files)
+}
+
+// findByPath returns the entry whose ID is arg, or the latest one deleted
+// from the path
+func findByPath(files []File, arg string) (File, bool) {
+	path, err := filepath.Abs(expandHome(arg))
+	if err != nil {
+		path = arg
+	}
+	var found File
+	ok := false
+	for _, file := range files {
+		if file.ID == "" {
+			continue
+		}
+		if file.ID == arg {
+			return file, true
+		}
+		if file.From == path && (!ok || file.Timestamp.After(found.Timestamp)) {
+			found, ok = file, true
+		}
+	}
+	return found, ok
+}
+
+// disambiguate asks which file to restore from the matched ones
+// It shows one line for each file not to take the whole screen
+func (c CLI) disambiguate(word string, files []File) (File, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		rows := [][]string{{"ID", "DELETED", "PATH"}}
+		for _, file := range files {
+			rows = append(rows, []string{file.ID, c.ago(file.Timestamp), file.From})
+		}
+		printTable(c.Stderr, rows)
+		return File{}, fmt.Errorf("%s: %d files match, specify it more", word, len(files))
+	}
+
+	funcMap := promptui.FuncMap
+	funcMap["time"] = c.ago
+	templates := &promptui.SelectTemplates{
+		Label:    "{{ . }}",
+		Active:   promptui.IconSelect + " {{ .Name | cyan }}  {{ .From | faint }}  {{ .Timestamp | time | faint }}",
+		Inactive: "  {{ .Name }}  {{ .From | faint }}  {{ .Timestamp | time | faint }}",
+		Selected: promptui.IconGood + " {{ .Name }}",
+		FuncMap:  funcMap,
+	}
+	lines := make([]string, len(files))
+	for i, file := range files {
+		lines[i] = fmt.Sprintf("%s\t%s\t%s", file.Name, file.From, c.ago(file.Timestamp))
+	}
+	i, err := c.Selector.Select(Selection{
+		Label:     fmt.Sprintf("%d files match %q, which to restore?", len(files), word),
+		Lines:     lines,
+		Items:     files,
+		Templates: templates,
+		Size:      10,
+	})
+	if err != nil {
+		return File{}, err
+	}
+	return files[i], nil
+}
+
+// RestoreByDate restores all the files deleted on the day given with --date
+// in the local time zone
+func (c CLI) RestoreByDate(ctx context.Context) error {
+	opt := c.Option.RestoreCmd
+	y, m, d := opt.Date.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 1)
+
+	var files []File
+	all, stores := c.federated()
+	for _, file := range all {
+		if file.ID == "" || file.Timestamp.Before(start) || !file.Timestamp.Before(end) {
+			continue
+		}
+		if opt.Under != "" && !isUnder(file.From, expandHome(opt.Under)) {
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files deleted on %s", start.Format("2006-01-02"))
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Timestamp.Before(files[j].Timestamp)
+	})
+
+	if opt.List {
+		rows := [][]string{{"ID", "DELETED", "SIZE", "PATH"}}
+		for _, file := range files {
+			rows = append(rows, []string{file.ID, file.Timestamp.Format("15:04:05"), humanize.Bytes(uint64(file.Size)), file.From})
+		}
+		printTable(c.Stdout, rows)
+		return nil
+	}
+	return c.restoreFederated(ctx, stores, files)
+}
+
+// RestoreByGroupID restores all the files deleted in the group without prompt
+func (c CLI) RestoreByGroupID(ctx context.Context, id string) error {
+	var files []File
+	all, stores := c.federated()
+	for _, file := range all {
+		if file.ID != "" && file.GroupID == id {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("%s: no such group in inventory", id)
+	}
+	return c.restoreFederated(ctx, stores, files)
+}
+
+// restoreFiles resolves the conflicts and restores the files
+// With --dry-run, it prints the plan instead.
+func (c CLI) restoreFiles(ctx context.Context, files []File) error {
+	if c.Option.RestoreCmd.DryRun {
+		plan, err := c.PlanRestore(files, PlanOption{To: c.Option.RestoreCmd.To})
+		if err != nil {
+			return err
+		}
+		return c.printPlan(plan)
+	}
+	files, err := c.resolveConflicts(ctx, c.relocate(files))
+	if err != nil {
+		return err
+	}
+	return c.restoreAll(ctx, files)
+}
+
+// relocate changes where to restore the files into the directory given with --to
+// The files restored with it are put flat in the directory by their names.
+func (c CLI) relocate(files []File) []File {
+	return relocateTo(files, c.Option.RestoreCmd.To)
+}
+
+func relocateTo(files []File, dir string) []File {
+	if dir == "" {
+		return files
+	}
+	dir, _ = filepath.Abs(expandHome(dir))
+	result := make([]File, len(files))
+	for i, file := range files {
+		file.From = filepath.Join(dir, file.Name)
+		result[i] = file
+	}
+	return result
+}
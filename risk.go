@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// These are the problems which would get in the way of restoring an entry
+const (
+	riskMissing  = "payload missing"
+	riskConflict = "original path exists"
+	riskNoParent = "original directory gone"
+)
+
+// riskIcons are shown in list and the prompt for the problems
+var riskIcons = map[string]string{
+	riskMissing:  "✗",
+	riskConflict: "≠",
+	riskNoParent: "?",
+}
+
+// risks returns the problems of restoring the file now, so that they are
+// visible before trying to restore it
+// The archived entries are not flagged as missing since it's expected.
+func (c CLI) risks(file File) []string {
+	var risks []string
+	if !file.Archived && !file.IsNode() {
+		_, err := c.FS.Lstat(file.To)
+		if c.packed(file) {
+			_, err = c.FS.Lstat(filepath.Join(c.Dir, file.Pack))
+		}
+		if os.IsNotExist(err) {
+			risks = append(risks, riskMissing)
+		}
+	}
+	if file.From == "" {
+		// the original path is unknown (see rebuild-inventory --best-effort)
+		return risks
+	}
+	if _, err := c.FS.Lstat(file.From); err == nil {
+		risks = append(risks, riskConflict)
+	} else if _, err := c.FS.Lstat(filepath.Dir(file.From)); os.IsNotExist(err) {
+		// restore creates it, but it may have been moved
+		risks = append(risks, riskNoParent)
+	}
+	return risks
+}
+
+// riskFlags returns the icons of the problems of the file
+func (c CLI) riskFlags(file File) string {
+	var flags []string
+	for _, risk := range c.risks(file) {
+		flags = append(flags, riskIcons[risk])
+	}
+	return strings.Join(flags, "")
+}
+
+// riskLegend explains the icons, listing only the ones shown
+func riskLegend(shown string) string {
+	var legend []string
+	for _, risk := range []string{riskMissing, riskConflict, riskNoParent} {
+		if strings.Contains(shown, riskIcons[risk]) {
+			legend = append(legend, riskIcons[risk]+" "+risk)
+		}
+	}
+	return strings.Join(legend, ", ")
+}
+
+// colored returns true if the output of list should be colored
+func (c CLI) colored() bool {
+	return !c.quiet() && os.Getenv("NO_COLOR") == "" &&
+		terminal.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// ageColor colors the time deleted by the age: green for the ones deleted
+// within a day, plain within a month and faint for the older ones
+func (c CLI) ageColor(t time.Time, s string) string {
+	switch age := c.Clock.Now().Sub(t); {
+	case age < 24*time.Hour:
+		return promptui.Styler(promptui.FGGreen)(s)
+	case age < 30*24*time.Hour:
+		return s
+	default:
+		return promptui.Styler(promptui.FGFaint)(s)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// strictRmOption represents the options when gomi is invoked as rm
+type strictRmOption struct {
+	Interactive bool `short:"i" long:"interactive" description:"Prompt before every removal"`
+	Recursive   bool `short:"r" long:"recursive" description:"Remove directories and their contents recursively"`
+	Force       bool `short:"f" long:"force" description:"Ignore nonexistent files and never prompt"`
+	Directory   bool `short:"d" long:"dir" description:"Remove empty directories"`
+	Verbose     bool `short:"v" long:"verbose" description:"Explain what is being done"`
+}
+
+// rm behaves as rm command strictly when gomi is invoked as rm
+// (e.g. installed as /usr/local/bin/rm) except that the files are moved
+// to the trash. Unlike gomi, directories need -r and nonexistent files are
+// errors without -f, and all the errors are reported with rm prefix.
+func (c CLI) rm(ctx context.Context, args []string) error {
+	opt := c.Option.RmOption
+	if len(args) == 0 {
+		return errors.New("rm: missing operand")
+	}
+
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf("rm: "+format, args...))
+	}
+	stdin := bufio.NewReader(c.Stdin)
+	var targets []string
+	for _, arg := range args {
+		switch filepath.Base(filepath.Clean(arg)) {
+		case ".", "..":
+			fail("refusing to remove '.' or '..' directory: skipping '%s'", arg)
+			continue
+		}
+		if abs, err := filepath.Abs(arg); err == nil && abs == string(filepath.Separator) {
+			fail("it is dangerous to operate recursively on '%s'", arg)
+			continue
+		}
+		fi, err := c.FS.Lstat(arg)
+		if os.IsNotExist(err) {
+			if !opt.Force {
+				fail("cannot remove '%s': No such file or directory", arg)
+			}
+			continue
+		}
+		if err != nil {
+			fail("cannot remove '%s': %v", arg, err)
+			continue
+		}
+		empty := c.isEmpty(arg, fi)
+		if fi.IsDir() && !opt.Recursive && !(opt.Directory && empty) {
+			fail("cannot remove '%s': Is a directory", arg)
+			continue
+		}
+		switch {
+		case opt.Force:
+		case opt.Interactive:
+			fmt.Fprintf(c.Stderr, "rm: remove %s '%s'? ", describe(fi, empty), arg)
+			answer, _ := stdin.ReadString('\n')
+			if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+				continue
+			}
+		default:
+			if len(c.confirmWriteProtected("rm", []string{arg}, stdin)) == 0 {
+				continue
+			}
+		}
+		targets = append(targets, arg)
+	}
+
+	if len(targets) > 0 {
+		if !opt.Force {
+			if err := c.guard(targets); err != nil {
+				return fmt.Errorf("rm: %v", err)
+			}
+		}
+		// the errors while trashing should not be ignored even with -f
+		// since they are not about nonexistent files
+		c.Option.RmOption.Force = false
+		openFiles := c.Config.Guard.OpenFiles
+		c.Config.Guard = GuardConfig{}
+		if !opt.Force {
+			// the open files have not been checked yet
+			c.Config.Guard.OpenFiles = openFiles
+		}
+		if err := c.Remove(ctx, targets); err != nil {
+			fail("%v", err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// isEmpty returns true if the file is an empty file or directory
+func (c CLI) isEmpty(path string, fi os.FileInfo) bool {
+	if !fi.IsDir() {
+		return fi.Size() == 0
+	}
+	entries, err := c.FS.ReadDir(path)
+	return err == nil && len(entries) == 0
+}
+
+// describe returns the type of the file in the words of rm
+func describe(fi os.FileInfo, empty bool) string {
+	switch fileType(fi.Mode()) {
+	case typeFile:
+		if empty {
+			return "regular empty file"
+		}
+		return "regular file"
+	case typeDir:
+		return "directory"
+	case typeSymlink:
+		return "symbolic link"
+	case typeFIFO:
+		return "fifo"
+	case typeSocket:
+		return "socket"
+	case typeDevice:
+		return "block special file"
+	case typeCharDevice:
+		return "character special file"
+	default:
+		return "file"
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/dustin/go-humanize"
+)
+
+// statsFile is the cache of the inventory summary in gomi dir
+// It's updated whenever the inventory is written so that the commands
+// called frequently (e.g. prompt-segment) don't have to read the whole inventory
+const statsFile = "stats.json"
+
+// Stats is the summary of the inventory
+type Stats struct {
+	Count int   `json:"count"`
+	Size  int64 `json:"size"`
+}
+
+// PromptSegmentOption represents the options of prompt-segment command
+type PromptSegmentOption struct {
+	NoColor bool `long:"no-color" description:"Print without colors"`
+}
+
+// writeStats updates the cache of the summary of the inventory
+func (i *Inventory) writeStats() error {
+	var stats Stats
+	for _, file := range i.Files {
+		if file.ID != "" {
+			stats.Count++
+			stats.Size += file.Size
+		}
+	}
+	return i.saveStats(stats)
+}
+
+// saveStats writes the summary into the cache
+func (i *Inventory) saveStats(stats Stats) error {
+	b, err := json.Marshal(&stats)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(filepath.Dir(i.Path), statsFile)
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	f, err := i.FS.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, i.Mode)
+	if err != nil {
+		return err
+	}
+	defer i.FS.Remove(tmp)
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return i.FS.Rename(tmp, path)
+}
+
+// readStats returns the cached summary of the inventory
+// The cache is rebuilt if it doesn't exist or is older than the inventory
+func (i *Inventory) readStats() (Stats, error) {
+	if _, err := i.FS.Stat(i.Path); os.IsNotExist(err) {
+		return Stats{}, nil
+	}
+	if stats, ok := i.freshStats(); ok {
+		return stats, nil
+	}
+	var stats Stats
+	log.Printf("[DEBUG] rebuilding %s", statsFile)
+	if err := i.Open(); err != nil {
+		return stats, err
+	}
+	if err := i.writeStats(); err != nil {
+		log.Printf("[WARN] failed to write %s: %v", statsFile, err)
+	}
+	for _, file := range i.Files {
+		if file.ID != "" {
+			stats.Count++
+			stats.Size += file.Size
+		}
+	}
+	return stats, nil
+}
+
+// freshStats returns the cached summary if it's not older than the inventory
+func (i *Inventory) freshStats() (Stats, bool) {
+	var stats Stats
+	path := filepath.Join(filepath.Dir(i.Path), statsFile)
+	cache, err := i.FS.Stat(path)
+	if err != nil {
+		return stats, false
+	}
+	updated, err := i.modTime()
+	if err != nil || cache.ModTime().Before(updated) {
+		return stats, false
+	}
+	f, err := i.FS.Open(path)
+	if err != nil {
+		return stats, false
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&stats); err != nil {
+		return stats, false
+	}
+	return stats, true
+}
+
+// PromptSegment prints the short token of the trash size for shell prompts
+// (e.g. starship and powerlevel10k) quickly from the cache
+// Nothing is printed if the trash is empty. The token is colored yellow
+// when the size exceeds the watermark thresholds
+func (c CLI) PromptSegment() error {
+	stats, err := c.Inventory.readStats()
+	if err != nil {
+		return err
+	}
+	if stats.Count == 0 {
+		return nil
+	}
+	token := "🗑 " + compactBytes(stats.Size)
+	if c.Option.PromptSegment.NoColor || c.quiet() {
+		fmt.Fprintln(c.Stdout, token)
+		return nil
+	}
+	color := "32" // green
+	for _, t := range c.Config.Trash.Watermark.Thresholds {
+		if limit := t.Bytes(c.Config.Trash.Quota); limit > 0 && stats.Size >= limit {
+			color = "33" // yellow
+		}
+	}
+	if quota := int64(c.Config.Trash.Quota); quota > 0 && stats.Size >= quota {
+		color = "31" // red
+	}
+	fmt.Fprintf(c.Stdout, "\x1b[%sm%s\x1b[0m\n", color, token)
+	return nil
+}
+
+// compactBytes formats the size shortly like "1.2G"
+func compactBytes(size int64) string {
+	s := humanize.Bytes(uint64(size)) // e.g. "1.2 GB"
+	var value, unit string
+	fmt.Sscanf(s, "%s %s", &value, &unit)
+	if unit == "B" {
+		return value + "B"
+	}
+	return value + unit[:1]
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+)
+
+// These are the available selectors
+const (
+	selectorPromptui = "promptui"
+	selectorFzf      = "fzf"
+	selectorPlain    = "plain"
+)
+
+// errNotSelected is returned when the user cancels the selection
+var errNotSelected = errors.New("nothing selected")
+
+// errEditNote is returned with the index of the item when the user asks
+// to edit its note instead of choosing it (see Selection.Edit)
+var errEditNote = errors.New("edit note")
+
+// Selection represents what a selector asks the user to choose from
+type Selection struct {
+	Label string
+
+	// one line for each item, used by the selectors without templates
+	Lines []string
+
+	// used only by promptui to render the items richly
+	Items     interface{}
+	Templates *promptui.SelectTemplates
+	Searcher  func(input string, index int) bool
+	Search    bool // start in search mode
+	Size      int
+
+	Edit   bool // the note of the item can be edited (noteKey)
+	Cursor int  // the item highlighted first
+	Jump   bool // Searcher jumps to a date with jumpPrefix (see jumpSearcher)
+}
+
+// Selector asks the user to choose one of the items and returns its index
+type Selector interface {
+	Select(s Selection) (int, error)
+	// Input asks the user to enter a line, starting with the value
+	Input(label, value string) (string, error)
+}
+
+// newSelector returns the selector by name
+func newSelector(name string, cfg PromptConfig, stdin io.Reader, stderr io.Writer) Selector {
+	switch name {
+	case selectorFzf:
+		return fzfSelector{Command: cfg.FzfCommand, In: bufio.NewReader(stdin), Stderr: stderr}
+	case selectorPlain:
+		return plainSelector{In: bufio.NewReader(stdin), Out: stderr}
+	default:
+		return promptSelector{}
+	}
+}
+
+// choose asks the user to choose one of the choices and returns it
+func (c CLI) choose(label string, choices []string) (string, error) {
+	i, err := c.Selector.Select(Selection{Label: label, Lines: choices})
+	if err != nil {
+		return "", err
+	}
+	return choices[i], nil
+}
+
+// promptSelector is the interactive list of promptui
+type promptSelector struct{}
+
+func (promptSelector) Select(s Selection) (int, error) {
+	prompt := promptui.Select{
+		Label:             s.Label,
+		Items:             s.Items,
+		Templates:         s.Templates,
+		Searcher:          s.Searcher,
+		StartInSearchMode: s.Search && s.Searcher != nil,
+		HideSelected:      true,
+	}
+	if s.Items == nil {
+		prompt.Items = s.Lines
+	}
+	if s.Size > 0 {
+		prompt.Size = s.Size
+	}
+	size := prompt.Size
+	if size == 0 {
+		size = pageSize
+	}
+	var hints []string
+	var in *promptReader
+	if s.Edit {
+		hints = append(hints, "Ctrl-E to edit the note")
+		in = newPromptReader(noteKey)
+		defer in.Close()
+		prompt.Stdin = in
+	}
+	if s.Jump && len(s.Lines) > size {
+		hints = append(hints, ":2024-05-01 or :30d to jump")
+	}
+	if len(hints) > 0 {
+		prompt.Label = fmt.Sprintf("%s (%s)", s.Label, strings.Join(hints, ", "))
+	}
+	scroll := s.Cursor - size + 1
+	if scroll < 0 {
+		scroll = 0
+	}
+	i, _, err := prompt.RunCursorAt(s.Cursor, scroll)
+	if err == nil && in != nil && in.Pressed() {
+		return i, errEditNote
+	}
+	return i, err
+}
+
+func (promptSelector) Input(label, value string) (string, error) {
+	in := newPromptReader(0)
+	defer in.Close()
+	prompt := promptui.Prompt{
+		Label:     label,
+		Default:   value,
+		AllowEdit: true,
+		Stdin:     in,
+	}
+	return prompt.Run()
+}
+
+// fzfSelector runs fzf (or a compatible command) to choose the item
+// Each line is given with its index so that the same lines are told apart
+type fzfSelector struct {
+	Command string
+	In      *bufio.Reader
+	Stderr  io.Writer
+}
+
+func (f fzfSelector) Select(s Selection) (int, error) {
+	var in bytes.Buffer
+	for i, line := range s.Lines {
+		fmt.Fprintf(&in, "%d\t%s\n", i, strings.Replace(line, "\n", " ", -1))
+	}
+	command := f.Command
+	if command == "" {
+		command = "fzf"
+	}
+	args := ` --delimiter='\t' --with-nth=2.. --prompt="$GOMI_LABEL> "`
+	if s.Edit {
+		// the first line of the output is the key pressed
+		args += ` --expect=ctrl-e --header="ctrl-e: edit the note"`
+	}
+	cmd := exec.Command("sh", "-c", command+args)
+	cmd.Env = append(os.Environ(), "GOMI_LABEL="+s.Label)
+	cmd.Stdin = &in
+	cmd.Stderr = f.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if e, ok := err.(*exec.ExitError); ok && (e.ExitCode() == 1 || e.ExitCode() == 130) {
+			// no match or interrupted
+			return -1, errNotSelected
+		}
+		return -1, fmt.Errorf("%s: %v", command, err)
+	}
+	selected := string(out)
+	var key string
+	if s.Edit {
+		lines := strings.SplitN(selected, "\n", 2)
+		key = lines[0]
+		if len(lines) > 1 {
+			selected = lines[1]
+		}
+	}
+	index := strings.SplitN(strings.TrimSpace(selected), "\t", 2)[0]
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 || i >= len(s.Lines) {
+		return -1, fmt.Errorf("%s: unexpected output %q", command, out)
+	}
+	if key == "ctrl-e" {
+		return i, errEditNote
+	}
+	return i, nil
+}
+
+func (f fzfSelector) Input(label, value string) (string, error) {
+	return readInput(f.In, f.Stderr, label, value)
+}
+
+// plainSelector prints the numbered items and reads the number
+// It needs no terminal features, e.g. for dumb terminals and screen readers
+type plainSelector struct {
+	In  *bufio.Reader
+	Out io.Writer
+}
+
+func (p plainSelector) Select(s Selection) (int, error) {
+	for i, line := range s.Lines {
+		fmt.Fprintf(p.Out, "%4d %s\n", i, strings.Replace(line, "\t", "  ", -1))
+	}
+	hint := ""
+	if s.Edit {
+		hint = " (eN to edit the note of N)"
+	}
+	for {
+		fmt.Fprintf(p.Out, "%s%s [0..%d]: ", s.Label, hint, len(s.Lines)-1)
+		line, err := p.In.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(p.Out)
+			return -1, errNotSelected
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return -1, errNotSelected
+		}
+		edit := s.Edit && strings.HasPrefix(line, "e")
+		i, err := strconv.Atoi(strings.TrimPrefix(line, "e"))
+		if err == nil && i >= 0 && i < len(s.Lines) && (edit || line[0] != 'e') {
+			if edit {
+				return i, errEditNote
+			}
+			return i, nil
+		}
+		fmt.Fprintf(p.Out, "%q: should be a number from 0 to %d\n", line, len(s.Lines)-1)
+	}
+}
+
+func (p plainSelector) Input(label, value string) (string, error) {
+	return readInput(p.In, p.Out, label, value)
+}
+
+// readInput reads a line for Input of the selectors without line editing
+// An empty line keeps the value, and "-" clears it.
+func readInput(in *bufio.Reader, out io.Writer, label, value string) (string, error) {
+	if value != "" {
+		fmt.Fprintf(out, "%s [%s] (- to clear): ", label, value)
+	} else {
+		fmt.Fprintf(out, "%s: ", label)
+	}
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(out)
+		return "", errNotSelected
+	}
+	switch line = strings.TrimSpace(line); line {
+	case "":
+		return value, nil
+	case "-":
+		return "", nil
+	}
+	return line, nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ServeOption represents the options of serve command
+type ServeOption struct{}
+
+// serveRequest is one line read by serve
+//
+//	{"id": 1, "op": "trash", "paths": ["/tmp/build"], "source": "make:clean"}
+//	{"id": 2, "op": "restore", "ids": ["c1ab..."]}
+//	{"id": 3, "op": "plan", "ids": ["c1ab..."], "to": "/tmp/restored"}
+//	{"id": 4, "op": "apply", "plan": {...}}
+type serveRequest struct {
+	ID     interface{} `json:"id,omitempty"` // echoed back in the response
+	Op     string      `json:"op"`           // "trash", "restore", "plan", "apply" or "ping"
+	Paths  []string    `json:"paths,omitempty"`
+	IDs    []string    `json:"ids,omitempty"`
+	Cwd    string      `json:"cwd,omitempty"` // to resolve relative paths
+	Note   string      `json:"note,omitempty"`
+	Tags   []string    `json:"tags,omitempty"`
+	Source string      `json:"source,omitempty"`
+
+	// for plan and apply (see PlanRestore)
+	PlanOption
+	Plan *Plan `json:"plan,omitempty"`
+}
+
+// serveResponse is one line written by serve for each request
+type serveResponse struct {
+	ID      interface{}   `json:"id,omitempty"`
+	OK      bool          `json:"ok"`
+	Error   string        `json:"error,omitempty"`
+	Results []serveResult `json:"results,omitempty"`
+	Plan    *Plan         `json:"plan,omitempty"`
+}
+
+type serveResult struct {
+	Path  string `json:"path"`
+	ID    string `json:"id,omitempty"` // of the inventory entry
+	To    string `json:"to,omitempty"` // where the payload is
+	Error string `json:"error,omitempty"`
+	Kind  string `json:"kind,omitempty"` // not_found, conflict, cross_device or protected_path
+}
+
+// Serve reads the requests from stdin and writes the responses to stdout
+// one JSON per line, so that other programs can delegate their deletion to
+// gomi (and get the same retention and restore) by spawning `gomi serve`
+// once and keeping it running
+// Each request is committed as one transaction (one group).
+// The config is reloaded on SIGHUP or `gomi daemon reload` between requests.
+// On SIGTERM, the running request is cancelled (the files done so far are
+// committed) and it exits. Closing stdin only ends the requests since the
+// clients like gomi remote close it right after writing the request.
+func (c CLI) Serve(ctx context.Context) error {
+	enc := json.NewEncoder(c.Stdout)
+	enc.SetEscapeHTML(false)
+
+	lines := make(chan []byte)
+	done := make(chan error, 1)
+	// closed on return so that the reader doesn't block on lines forever
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		s := bufio.NewScanner(c.Stdin)
+		s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for s.Scan() {
+			select {
+			case lines <- append([]byte(nil), s.Bytes()...):
+			case <-quit:
+				return
+			}
+		}
+		done <- s.Err()
+	}()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	control := make(chan controlRequest)
+	if stop, err := listenControl(c.FS, c.Dir, control); err != nil {
+		log.Printf("[WARN] failed to create control socket: %v", err)
+	} else {
+		defer stop()
+	}
+
+	// the empty scheduled with --grace is done on time without other runs
+	due := time.NewTicker(time.Minute)
+	defer due.Stop()
+
+	for {
+		select {
+		case <-due.C:
+			if err := c.emptyDue(ctx); err != nil {
+				c.notice("failed to empty the trash: %v", err)
+			}
+		case <-hup:
+			cfg, err := c.reloadConfig()
+			if err != nil {
+				c.notice("failed to reload config: %v", err)
+			}
+			c.Config = cfg
+		case req := <-control:
+			var err error
+			switch req.command {
+			case "reload":
+				var cfg Config
+				cfg, err = c.reloadConfig()
+				c.Config = cfg
+			default:
+				err = fmt.Errorf("%q: unknown command", req.command)
+			}
+			req.reply <- err
+		case line := <-lines:
+			if len(line) == 0 {
+				continue
+			}
+			var req serveRequest
+			var resp serveResponse
+			if err := json.Unmarshal(line, &req); err != nil {
+				resp.Error = fmt.Sprintf("invalid request: %v", err)
+			} else {
+				resp = c.serve(ctx, req)
+			}
+			if err := enc.Encode(resp); err != nil {
+				return err
+			}
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			// stopped by the signal between the requests
+			return nil
+		}
+	}
+}
+
+func (c CLI) serve(ctx context.Context, req serveRequest) serveResponse {
+	resp := serveResponse{ID: req.ID}
+	log.Printf("[DEBUG] serve: %s %v %v", req.Op, req.Paths, req.IDs)
+
+	// other gomi may have changed it since the last request
+	if err := c.Inventory.Open(); err != nil && !os.IsNotExist(err) {
+		resp.Error = err.Error()
+		return resp
+	}
+	c.Option.Message, c.Option.Tags, c.Option.Source = req.Note, req.Tags, req.Source
+
+	tx := c.Begin()
+	switch req.Op {
+	case "ping":
+		resp.OK = true
+		return resp
+	case "plan":
+		var files []File
+		for _, id := range req.IDs {
+			file, ok := c.Inventory.Find(id)
+			if !ok {
+				resp.Error = notFound(id).Error()
+				return resp
+			}
+			files = append(files, file)
+		}
+		plan, err := c.PlanRestore(files, req.PlanOption)
+		if err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		resp.OK, resp.Plan = true, &plan
+		return resp
+	case "apply":
+		if req.Plan == nil {
+			resp.Error = "apply: no plan given"
+			return resp
+		}
+		if err := c.Apply(ctx, *req.Plan); err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		for _, file := range req.Plan.Files {
+			resp.Results = append(resp.Results, serveResult{Path: file.From, ID: file.ID})
+		}
+		resp.OK = true
+		return resp
+	case opTrash:
+		// measured by guardServe for the entries (see Remove)
+		defer forgetUsage()
+		var paths []string
+		for _, path := range req.Paths {
+			if !filepath.IsAbs(path) && req.Cwd != "" {
+				path = filepath.Join(req.Cwd, path)
+			}
+			paths = append(paths, path)
+		}
+		paths, resp.Results = c.guardServe(paths)
+		for _, path := range paths {
+			tx.Put(path)
+		}
+	case opRestore:
+		for _, id := range req.IDs {
+			file, ok := c.Inventory.Find(id)
+			if !ok {
+				resp.Results = append(resp.Results, serveResult{Path: id, Error: ErrNotFound.Error(), Kind: errorKinds[ErrNotFound]})
+				continue
+			}
+			tx.Restore(file)
+		}
+	default:
+		resp.Error = fmt.Sprintf("%q: unknown op (should be %q, %q, %q, %q or %q)", req.Op, opTrash, opRestore, "plan", "apply", "ping")
+		return resp
+	}
+
+	results, err := tx.Commit(ctx)
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	for _, r := range results {
+		result := serveResult{Path: r.Path, ID: r.File.ID, To: r.File.To}
+		if r.Err != nil {
+			result.Error = r.Err.Error()
+			result.Kind = errorKinds[errorKind(r.Err)]
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	resp.OK = err == nil
+	for _, result := range resp.Results {
+		if result.Error != "" {
+			resp.OK = false
+		}
+	}
+	return resp
+}
+
+// guardServe checks the paths to trash as guard and guardOpenFiles do
+// There's nobody to ask in serve, so the paths which would be confirmed
+// are refused as the runs without terminal do. It returns the paths to
+// trash and the results of the refused ones.
+func (c CLI) guardServe(paths []string) ([]string, []serveResult) {
+	var refused []serveResult
+	refuse := func(path, reason string) {
+		refused = append(refused, serveResult{Path: path, Error: reason, Kind: errorKinds[ErrProtectedPath]})
+	}
+	what, err := c.overLimits(paths)
+	if err != nil {
+		// e.g. not found, which is reported by trashing it
+		log.Printf("[DEBUG] serve: failed to measure the files: %v", err)
+	}
+	if what != "" {
+		for _, path := range paths {
+			refuse(path, fmt.Sprintf("refusing to trash %s at once (guard.max_files and guard.max_size)", what))
+		}
+		return nil, refused
+	}
+	action := c.Config.Guard.OpenFiles
+	if action == "" || action == openFilesOff {
+		return paths, nil
+	}
+	open := c.openBy(paths)
+	var targets []string
+	for _, path := range paths {
+		what, ok := open[path]
+		switch {
+		case !ok:
+			targets = append(targets, path)
+		case action == openFilesWarn:
+			c.notice("%s; moving it may break the program", what)
+			targets = append(targets, path)
+		default:
+			refuse(path, fmt.Sprintf("refusing to trash %s without confirmation", what))
+		}
+	}
+	return targets, refused
+}
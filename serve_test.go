@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestServeGuard(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.Close()
+	ctx := context.Background()
+	e.CLI.Config.Guard.MaxFiles = 2
+
+	e.WriteFile("/work/a.txt", "a")
+	e.WriteFile("/work/dir/b.txt", "b")
+	e.WriteFile("/work/dir/c.txt", "c")
+	resp := e.CLI.serve(ctx, serveRequest{Op: opTrash, Paths: []string{"a.txt", "dir"}, Cwd: "/work"})
+	if resp.OK {
+		t.Fatal("trashed more files than guard.max_files")
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(resp.Results))
+	}
+	for _, result := range resp.Results {
+		if result.Kind != errorKinds[ErrProtectedPath] {
+			t.Errorf("%s: kind = %q, want %q", result.Path, result.Kind, errorKinds[ErrProtectedPath])
+		}
+		if !e.Exists(result.Path) {
+			t.Errorf("%s: trashed though refused", result.Path)
+		}
+	}
+
+	resp = e.CLI.serve(ctx, serveRequest{Op: opTrash, Paths: []string{"/work/a.txt"}})
+	if !resp.OK {
+		t.Fatalf("failed to trash within the limits: %+v", resp)
+	}
+	if e.Exists("/work/a.txt") {
+		t.Error("/work/a.txt: not trashed")
+	}
+}
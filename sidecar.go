@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rs/xid"
+)
+
+// sidecarSuffix is appended to the payload path to make the path of its sidecar
+// e.g. 2020/01/16/zoapompji/file.go.asfasfafd.meta.json
+const sidecarSuffix = ".meta.json"
+
+// RebuildInventoryOption represents the options of rebuild-inventory command
+type RebuildInventoryOption struct {
+	DryRun     bool `short:"n" long:"dry-run" description:"Only show the entries which would be recovered"`
+	BestEffort bool `long:"best-effort" description:"Also recover the payloads without sidecars from their paths (the original paths are unknown)"`
+}
+
+// writeSidecar writes the metadata of the file next to its payload
+// (if trash.sidecar is enabled) so that it can be restored even if the
+// inventory is lost (see rebuild-inventory)
+// Failing to write it doesn't fail the operation since the inventory has it.
+func (c CLI) writeSidecar(file File) {
+	if !c.Config.Trash.Sidecar {
+		return
+	}
+	path := file.To + sidecarSuffix
+	out, err := json.MarshalIndent(&file, "", "  ")
+	if err == nil && c.Inventory.Encrypt {
+		// it has the original path and the note like the inventory
+		out, err = seal(c.Inventory.Key, out)
+	}
+	if err == nil {
+		err = c.FS.MkdirAll(filepath.Dir(path), c.Config.Trash.DirMode.Perm())
+	}
+	if err == nil {
+		err = writeFile(c.FS, path, out, c.Config.Trash.FileMode.Perm())
+	}
+	if err != nil {
+		c.notice("%s: failed to write metadata: %v", path, err)
+	}
+}
+
+// removeSidecar removes the metadata of the file written by writeSidecar
+// It's done regardless of trash.sidecar since it may be enabled before.
+func (c CLI) removeSidecar(file File) {
+	err := c.FS.Remove(file.To + sidecarSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("[WARN] failed to remove sidecar: %v", err)
+	}
+}
+
+// writeFile writes the data into a new file
+func writeFile(fs FS, path string, data []byte, mode os.FileMode) error {
+	f, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RebuildInventory adds the entries found in the sidecars in gomi dir
+// which are missing in the inventory
+// The inventory which cannot be read is kept as inventory.json.broken.
+func (c CLI) RebuildInventory() error {
+	opt := c.Option.RebuildInventory
+	err := c.Inventory.Open()
+	switch {
+	case err == nil, os.IsNotExist(err):
+	case opt.DryRun:
+		c.notice("%v (it would be replaced)", err)
+		c.Inventory.Files = nil
+	default:
+		broken := c.Inventory.Path + ".broken"
+		c.notice("%v (keeping it as %s)", err, broken)
+		if err := c.FS.Rename(c.Inventory.Path, broken); err != nil {
+			return err
+		}
+		c.Inventory.Files = nil
+	}
+
+	files, err := c.sidecars()
+	if err != nil {
+		return err
+	}
+	sidecars := len(files)
+	if opt.BestEffort {
+		known := map[string]bool{}
+		for _, file := range files {
+			known[file.ID] = true
+		}
+		orphans, err := c.orphanPayloads(known)
+		if err != nil {
+			return err
+		}
+		files = append(files, orphans...)
+	}
+	var recovered []File
+	for _, file := range files {
+		if _, ok := c.Inventory.Find(file.ID); ok {
+			continue
+		}
+		if file.IsNode() {
+			recovered = append(recovered, file)
+			continue
+		}
+		_, err := c.FS.Lstat(file.To)
+		if c.packed(file) {
+			_, err = c.FS.Lstat(filepath.Join(c.Dir, file.Pack))
+		}
+		if os.IsNotExist(err) {
+			// like restore-metadata
+			log.Printf("[DEBUG] %s: payload is missing, marking as archived", file.ID)
+			file.Archived = true
+		}
+		recovered = append(recovered, file)
+	}
+
+	verb := "recovered"
+	if opt.DryRun {
+		verb = "would recover"
+	}
+	for _, file := range recovered {
+		if opt.DryRun || !c.quiet() {
+			if file.Degraded {
+				fmt.Fprintf(c.Stdout, "%s %s (deleted %s, original path unknown)\n", verb, file.To, c.ago(file.Timestamp))
+				continue
+			}
+			fmt.Fprintf(c.Stdout, "%s %s (deleted %s)\n", verb, file.From, c.ago(file.Timestamp))
+		}
+	}
+	if !opt.DryRun && len(recovered) > 0 {
+		if err := c.FS.MkdirAll(c.Dir, c.Config.Trash.DirMode.Perm()); err != nil {
+			return err
+		}
+		if err := c.Inventory.Save(recovered); err != nil {
+			return err
+		}
+	}
+	if opt.BestEffort {
+		var degraded int
+		for _, file := range recovered {
+			if file.Degraded {
+				degraded++
+			}
+		}
+		c.info("%s %d file(s) from %d sidecar(s), %d without original path", verb, len(recovered), sidecars, degraded)
+		return nil
+	}
+	c.info("%s %d file(s) from %d sidecar(s)", verb, len(recovered), sidecars)
+	return nil
+}
+
+// sidecars returns the entries recorded in the sidecars in gomi dir
+// The payload paths are based on where the sidecars are now, so they're
+// correct even if gomi dir has been moved.
+func (c CLI) sidecars() ([]File, error) {
+	var files []File
+	err := c.FS.Walk(c.Dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.Dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if fi.IsDir() && path != c.Dir && (fi.Name() == packDir || fi.Name() == stagingDir) {
+			return filepath.SkipDir
+		}
+		if !fi.Mode().IsRegular() || !strings.HasSuffix(path, sidecarSuffix) {
+			return nil
+		}
+		f, err := c.FS.Open(path)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(data, []byte(encryptedHeader)) {
+			if data, err = unseal(c.Inventory.Key, data); err != nil {
+				c.notice("%s: invalid metadata: %v", path, err)
+				return nil
+			}
+		}
+		var file File
+		if err := json.Unmarshal(data, &file); err != nil {
+			c.notice("%s: invalid metadata: %v", path, err)
+			return nil
+		}
+		if file.ID == "" {
+			c.notice("%s: invalid metadata: no id", path)
+			return nil
+		}
+		file.To = strings.TrimSuffix(path, sidecarSuffix)
+		files = append(files, file)
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Timestamp.Before(files[j].Timestamp)
+	})
+	return files, err
+}
+
+// orphanPayloads returns the entries made from the paths of the payloads
+// in gomi dir which have neither sidecars nor entries in the inventory
+// The payloads are found by matching their paths with path_template and the
+// presets of granularity (path_template should contain {{.ID}}), or by their
+// names ending with ".<id>" for the other layouts used before, and the time
+// deleted is taken from the id.
+func (c CLI) orphanPayloads(known map[string]bool) ([]File, error) {
+	var patterns []*regexp.Regexp
+	seen := map[string]bool{}
+	templates := []PathTemplate{c.Config.Trash.PathTemplate}
+	for _, name := range []string{"daily", "monthly", "flat"} {
+		t, _ := newPathTemplate(granularities[name])
+		templates = append(templates, t)
+	}
+	for _, t := range templates {
+		re, err := t.pattern()
+		if err != nil {
+			return nil, err
+		}
+		if !seen[re.String()] {
+			seen[re.String()] = true
+			patterns = append(patterns, re)
+		}
+	}
+
+	var files []File
+	err := c.FS.Walk(c.Dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.Dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if path == c.Dir || strings.HasSuffix(path, sidecarSuffix) || strings.HasSuffix(path, modesSuffix) {
+			return nil
+		}
+		if fi.IsDir() && (fi.Name() == packDir || fi.Name() == stagingDir) && filepath.Dir(path) == c.Dir {
+			return filepath.SkipDir
+		}
+		file, ok := c.payloadFile(patterns, path)
+		if !ok {
+			// date or group directory
+			return nil
+		}
+		if _, ok := c.Inventory.Find(file.ID); !ok && !known[file.ID] {
+			log.Printf("[DEBUG] %s: found payload without entry", path)
+			file.Type = fileType(fi.Mode())
+			file.Mode = fi.Mode()
+			file.Size = fi.Size()
+			file.Degraded = true
+			if fi.Mode()&os.ModeSymlink != 0 {
+				file.Link, _ = c.FS.Readlink(path)
+			}
+			if fi.IsDir() {
+				file.Size = dirSize(c.FS, path)
+			}
+			files = append(files, file)
+		}
+		if fi.IsDir() {
+			// not to look into the payload
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return files, err
+}
+
+// payloadFile returns the entry made from the path if it's of a payload
+// (see orphanPayloads)
+func (c CLI) payloadFile(patterns []*regexp.Regexp, path string) (File, bool) {
+	rel, err := filepath.Rel(c.Dir, path)
+	if err != nil {
+		return File{}, false
+	}
+	rel = filepath.ToSlash(rel)
+	var name, id, group string
+	for _, re := range patterns {
+		m := re.FindStringSubmatch(rel)
+		if m == nil {
+			continue
+		}
+		for i, sub := range re.SubexpNames() {
+			switch sub {
+			case "name":
+				name = m[i]
+			case "id":
+				id = m[i]
+			case "group":
+				group = m[i]
+			}
+		}
+		break
+	}
+	if id == "" {
+		base := filepath.Base(path)
+		i := strings.LastIndex(base, ".")
+		if i <= 0 {
+			return File{}, false
+		}
+		name, id = base[:i], base[i+1:]
+		group = filepath.Base(filepath.Dir(path))
+	}
+	xi, err := xid.FromString(id)
+	if err != nil {
+		return File{}, false
+	}
+	file := File{Name: name, ID: xi.String(), To: path, Timestamp: xi.Time(), GroupID: xi.String()}
+	if name == "" {
+		file.Name = filepath.Base(path)
+	}
+	if g, err := xid.FromString(group); err == nil {
+		file.GroupID = g.String()
+	}
+	return file, true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// SlimOption represents the options of slim command
+type SlimOption struct {
+	Target Size   `long:"target" value-name:"SIZE" required:"true" description:"Size to get the trash under (e.g. 1G)"`
+	By     string `long:"by" value-name:"ORDER" default:"oldest" choice:"oldest" choice:"largest" description:"Which files to purge first"`
+	Auto   bool   `long:"auto" description:"Purge the proposed files without asking"`
+	DryRun bool   `short:"n" long:"dry-run" description:"Only show the proposed files"`
+}
+
+// Slim proposes the files to purge to get the trash under the target size,
+// and purges them on confirmation
+// Pinned files and the ones kept by retention.keep are never proposed.
+func (c CLI) Slim(ctx context.Context) error {
+	opt := c.Option.Slim
+	var size int64
+	var candidates []File
+	for _, file := range c.Inventory.Files {
+		if file.ID == "" {
+			continue
+		}
+		size += file.Size
+		if file.Pinned || c.kept(file) {
+			continue
+		}
+		candidates = append(candidates, file)
+	}
+	target := int64(opt.Target)
+	if size <= target {
+		c.info("the trash is already under %s (%s)", opt.Target, humanize.Bytes(uint64(size)))
+		return nil
+	}
+
+	stdin := bufio.NewReader(c.Stdin)
+	by := opt.By
+	for {
+		plan, rest := slimPlan(candidates, by, size, target)
+		if len(plan) == 0 {
+			return fmt.Errorf("cannot get the trash under %s: all the files are pinned or kept", opt.Target)
+		}
+		var reclaimed int64
+		rows := [][]string{{"ID", "DELETED", "SIZE", "PATH"}}
+		for _, file := range plan {
+			reclaimed += file.Size
+			rows = append(rows, []string{
+				file.ID, c.ago(file.Timestamp), humanize.Bytes(uint64(file.Size)), file.From,
+			})
+		}
+		if err := printTable(c.Stdout, rows); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.Stdout, "\n%s first: %d file(s), %s reclaimed, %s -> %s\n",
+			by, len(plan), humanize.Bytes(uint64(reclaimed)), humanize.Bytes(uint64(size)), humanize.Bytes(uint64(rest)))
+		if rest > target {
+			c.notice("still over %s since the rest are pinned or kept", opt.Target)
+		}
+
+		switch {
+		case opt.DryRun:
+			return nil
+		case opt.Auto:
+			return c.purge(ctx, plan, false)
+		case !terminal.IsTerminal(int(os.Stdin.Fd())):
+			return errors.New("refusing to purge without confirmation (use --auto)")
+		}
+		other := "largest"
+		if by == "largest" {
+			other = "oldest"
+		}
+		fmt.Fprintf(c.Stderr, "gomi: purge these files permanently? [y/N/s (%s first)] ", other)
+		answer, _ := stdin.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return c.purge(ctx, plan, false)
+		case "s":
+			by = other
+		default:
+			return errors.New("aborted")
+		}
+	}
+}
+
+// slimPlan returns the candidates to purge in the order until the total
+// size gets under the target, and the total size after purging them
+func slimPlan(candidates []File, by string, size, target int64) ([]File, int64) {
+	files := make([]File, len(candidates))
+	copy(files, candidates)
+	sort.SliceStable(files, func(i, j int) bool {
+		if by == "largest" {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Timestamp.Before(files[j].Timestamp)
+	})
+	var plan []File
+	for _, file := range files {
+		if size <= target {
+			break
+		}
+		plan = append(plan, file)
+		size -= file.Size
+	}
+	return plan, size
+}
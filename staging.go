@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+)
+
+// stagingDir is the directory in gomi dir where the payloads copied from
+// other filesystems are put until the copy completes
+// Each operation copies into .staging/<group id>, so an interrupted copy is
+// never left next to the complete payloads.
+const stagingDir = ".staging"
+
+// stagingPath returns the path to copy the payload into before renaming it
+// to file.To, which is on the same filesystem as gomi dir
+func (c CLI) stagingPath(file File) string {
+	return filepath.Join(c.Dir, stagingDir, file.GroupID, filepath.Base(file.To))
+}
+
+// cleanStaging removes the copy left by the operation killed halfway
+// Its source is still in place since it's removed only after the copy has
+// been renamed to the payload path.
+func (c CLI) cleanStaging(entry JournalEntry) {
+	dir := filepath.Join(c.Dir, stagingDir, entry.File.GroupID)
+	if _, err := c.FS.Lstat(dir); err != nil {
+		return
+	}
+	log.Printf("[DEBUG] removing the incomplete copy in %q", dir)
+	if err := c.FS.RemoveAll(dir); err != nil {
+		log.Printf("[WARN] failed to remove %s: %v", dir, err)
+		return
+	}
+	removeEmptyDirs(c.FS, c.Dir, filepath.Dir(dir))
+	removeEmptyDirs(c.FS, c.Dir, filepath.Dir(entry.File.To))
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// StatsOption represents the options of stats command
+type StatsOption struct {
+	JSON  bool `long:"json" description:"Print the statistics as JSON"`
+	Usage bool `long:"usage" description:"Show how many times each command has run and failed (metrics.enabled)"`
+
+	Forecast bool `long:"forecast" description:"Show when the trash will reach the quota or fill the disk at the rates in the audit log"`
+}
+
+// StatsReport represents all the statistics of the trash
+type StatsReport struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Count       int           `json:"count"`
+	Size        int64         `json:"size"`
+	Quota       int64         `json:"quota,omitempty"`
+	Pinned      int           `json:"pinned"`
+	Archived    int           `json:"archived"`
+	Unaccessed  StatsBucket   `json:"unaccessed"` // never previewed or opened
+	Oldest      *time.Time    `json:"oldest,omitempty"`
+	Newest      *time.Time    `json:"newest,omitempty"`
+	Types       []StatsBucket `json:"types"`
+	Ages        []StatsBucket `json:"ages"`
+	Extensions  []StatsBucket `json:"extensions"`
+}
+
+// StatsBucket represents the number and size of the files in a group
+type StatsBucket struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+// ageBuckets are the upper bounds of the age histogram
+var ageBuckets = []struct {
+	name string
+	max  time.Duration
+}{
+	{"<1d", 24 * time.Hour},
+	{"1d-7d", 7 * 24 * time.Hour},
+	{"7d-30d", 30 * 24 * time.Hour},
+	{"30d-90d", 90 * 24 * time.Hour},
+	{"90d-1y", 365 * 24 * time.Hour},
+	{">1y", 1<<63 - 1},
+}
+
+// noExtension is the name of the group of files without extension
+const noExtension = "(none)"
+
+// Stats prints the statistics of the trash
+func (c CLI) Stats() error {
+	if c.Option.Stats.Usage {
+		return c.printUsage()
+	}
+	if c.Option.Stats.Forecast {
+		return c.printForecast()
+	}
+	report := c.stats(c.Clock.Now())
+	if c.Option.Stats.JSON {
+		enc := json.NewEncoder(c.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(report)
+	}
+
+	usage := ""
+	if report.Quota > 0 {
+		usage = fmt.Sprintf(" (%.1f%% of quota %s)", float64(report.Size)/float64(report.Quota)*100, Size(report.Quota))
+	}
+	fmt.Fprintf(c.Stdout, "Trash: %d file(s), %s%s\n", report.Count, humanize.Bytes(uint64(report.Size)), usage)
+	fmt.Fprintf(c.Stdout, "Pinned: %d, Archived: %d\n", report.Pinned, report.Archived)
+	fmt.Fprintf(c.Stdout, "Never looked at: %d file(s), %s\n", report.Unaccessed.Count, humanize.Bytes(uint64(report.Unaccessed.Size)))
+	if report.Oldest != nil {
+		fmt.Fprintf(c.Stdout, "Oldest: %s, Newest: %s\n", c.ago(*report.Oldest), c.ago(*report.Newest))
+	}
+	for _, group := range []struct {
+		name    string
+		buckets []StatsBucket
+	}{
+		{"TYPE", report.Types},
+		{"AGE", report.Ages},
+		{"EXTENSION", report.Extensions},
+	} {
+		if len(group.buckets) == 0 {
+			continue
+		}
+		fmt.Fprintln(c.Stdout)
+		rows := [][]string{{group.name, "FILES", "SIZE"}}
+		for _, bucket := range group.buckets {
+			rows = append(rows, []string{
+				bucket.Name, fmt.Sprint(bucket.Count), humanize.Bytes(uint64(bucket.Size)),
+			})
+		}
+		if err := printTable(c.Stdout, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stats summarizes the inventory at the time
+func (c CLI) stats(now time.Time) StatsReport {
+	report := StatsReport{
+		GeneratedAt: now,
+		Quota:       int64(c.Config.Trash.Quota),
+		Types:       []StatsBucket{},
+		Ages:        make([]StatsBucket, len(ageBuckets)),
+		Extensions:  []StatsBucket{},
+		Unaccessed:  StatsBucket{Name: "unaccessed"},
+	}
+	for i, bucket := range ageBuckets {
+		report.Ages[i].Name = bucket.name
+	}
+	types := map[string]*StatsBucket{}
+	exts := map[string]*StatsBucket{}
+	add := func(m map[string]*StatsBucket, name string, file File) {
+		b, ok := m[name]
+		if !ok {
+			b = &StatsBucket{Name: name}
+			m[name] = b
+		}
+		b.Count++
+		b.Size += file.Size
+	}
+
+	for _, file := range c.Inventory.Files {
+		if file.ID == "" {
+			continue
+		}
+		report.Count++
+		report.Size += file.Size
+		if file.Pinned {
+			report.Pinned++
+		}
+		if file.Archived {
+			report.Archived++
+		}
+		if file.Accessed == nil {
+			report.Unaccessed.Count++
+			report.Unaccessed.Size += file.Size
+		}
+		timestamp := file.Timestamp
+		if report.Oldest == nil || timestamp.Before(*report.Oldest) {
+			report.Oldest = &timestamp
+		}
+		if report.Newest == nil || timestamp.After(*report.Newest) {
+			report.Newest = &timestamp
+		}
+
+		kind := file.Type
+		if kind == "" {
+			kind = typeFile
+		}
+		add(types, kind, file)
+		if kind == typeFile {
+			add(exts, extension(file.Name), file)
+		}
+		age := now.Sub(file.Timestamp)
+		for i, bucket := range ageBuckets {
+			if age < bucket.max {
+				report.Ages[i].Count++
+				report.Ages[i].Size += file.Size
+				break
+			}
+		}
+	}
+
+	report.Types = sortBuckets(types)
+	report.Extensions = sortBuckets(exts)
+	return report
+}
+
+// extension returns the lowercased extension of the file name
+func extension(name string) string {
+	_, ext := splitExt(name)
+	ext = strings.ToLower(ext)
+	if ext == "" {
+		return noExtension
+	}
+	return ext
+}
+
+// sortBuckets returns the buckets sorted by size in descending order
+func sortBuckets(m map[string]*StatsBucket) []StatsBucket {
+	buckets := []StatsBucket{}
+	for _, b := range m {
+		buckets = append(buckets, *b)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Size != buckets[j].Size {
+			return buckets[i].Size > buckets[j].Size
+		}
+		return buckets[i].Name < buckets[j].Name
+	})
+	return buckets
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/xid"
+)
+
+// RemoveStdin saves the content given from stdin into gomi dir as a new entry
+// named the given name, as if the file had existed in the current directory
+// and been deleted, so that it can be restored later like other files
+func (c CLI) RemoveStdin(name string) error {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) || name == "." || name == ".." {
+		return errors.New("--stdin-name should be a filename")
+	}
+	before := c.Inventory.cachedSize()
+	if err := c.FS.MkdirAll(c.Dir, c.Config.Trash.DirMode.Perm()); err != nil {
+		return err
+	}
+
+	file := File{
+		Name:      name,
+		ID:        xid.New().String(),
+		GroupID:   xid.New().String(),
+		Timestamp: c.Clock.Now(),
+		Type:      typeFile,
+		Mode:      0644,
+		Tags:      c.Option.Tags,
+		Note:      c.Option.Message,
+		Source:    c.Option.Source,
+	}
+	from, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	file.From = from
+	path, err := c.Config.Trash.PathTemplate.Path(file)
+	if err != nil {
+		return err
+	}
+	file.To = filepath.Join(c.Dir, path)
+
+	if err := c.FS.MkdirAll(filepath.Dir(file.To), c.Config.Trash.DirMode.Perm()); err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] writing stdin to %q", file.To)
+	f, err := c.FS.OpenFile(file.To, os.O_WRONLY|os.O_CREATE|os.O_EXCL, file.Mode)
+	if err != nil {
+		return err
+	}
+	file.Size, err = io.Copy(f, c.Stdin)
+	if err == nil && c.Config.Fsync.Payloads {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		c.FS.Remove(file.To)
+		return err
+	}
+	if c.Config.Trash.Checksum {
+		if file.Checksum, err = checksum(c.FS, file.To); err != nil {
+			return err
+		}
+	}
+
+	c.protect(file)
+	c.writeSidecar(file)
+
+	defer c.Watermark(before, c.Inventory.cachedSize())
+	if err := c.Inventory.Save([]File{file}); err != nil {
+		return err
+	}
+	c.audit(opTrash, file)
+	if c.Option.PrintID {
+		fmt.Fprintln(c.Stdout, file.GroupID)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// store is another gomi dir given in trash.stores, e.g. the one used with
+// GOMI_HOME in a project or on a removable drive
+type store struct {
+	Dir string
+	CLI CLI // with the inventory and the journal in the store
+}
+
+// stores returns the other gomi dirs whose entries are listed and restored
+// together with the ones in the current gomi dir
+// The stores which cannot be read are skipped with a warning.
+func (c CLI) stores() []store {
+	var stores []store
+	seen := map[string]bool{c.Dir: true}
+	for _, dir := range c.Config.Trash.Stores {
+		dir = expandHome(dir)
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		s := c
+		s.Dir = dir
+		lock := &Lock{Dir: dir, Strategy: c.Config.Lock.Strategy, Mode: c.Config.Trash.FileMode.Perm(), FS: c.FS}
+		s.Inventory = &Inventory{
+			Path: filepath.Join(dir, inventoryFile),
+			Mode: c.Inventory.Mode,
+			Sync: c.Inventory.Sync,
+			Lock: lock,
+			FS:   c.FS,
+
+			Encrypt: c.Inventory.Encrypt,
+			Key:     c.Inventory.Key,
+		}
+		s.Journal = &Journal{Path: filepath.Join(dir, journalFile), Mode: c.Journal.Mode, Lock: lock, FS: c.FS, Encrypt: c.Journal.Encrypt, Key: c.Journal.Key}
+		if err := s.Inventory.Open(); err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("[WARN] %s: cannot read the inventory: %v", dir, err)
+			}
+			continue
+		}
+		stores = append(stores, store{Dir: dir, CLI: s})
+	}
+	return stores
+}
+
+// federated returns the entries in the current gomi dir and the stores,
+// and the stores opened to read them (see restoreFederated)
+func (c CLI) federated() ([]File, []store) {
+	files := c.Inventory.Files
+	if len(c.Config.Trash.Stores) == 0 {
+		return files, nil
+	}
+	// not to change the entries of the current inventory by appending
+	files = append([]File{}, files...)
+	stores := c.stores()
+	for _, s := range stores {
+		files = append(files, s.CLI.Inventory.Files...)
+	}
+	return files, stores
+}
+
+// storeName returns the gomi dir where the payload of the file is kept,
+// shortened with "~" for STORE column of list
+func (c CLI) storeName(file File) string {
+	dir := c.Dir
+	for _, d := range c.Config.Trash.Stores {
+		d = expandHome(d)
+		if abs, err := filepath.Abs(d); err == nil {
+			d = abs
+		}
+		if isUnder(file.To, d) {
+			dir = d
+		}
+	}
+	if home := os.Getenv("HOME"); home != "" && isUnder(dir, home) {
+		dir = "~" + strings.TrimPrefix(dir, home)
+	}
+	return dir
+}
+
+// restoreFederated restores the files by restoreFiles in the store each of
+// them is in, one store after another
+// The stores are the ones returned by federated with the files.
+func (c CLI) restoreFederated(ctx context.Context, stores []store, files []File) error {
+	if len(stores) == 0 {
+		return c.restoreFiles(ctx, files)
+	}
+	var here []File
+	in := map[string][]File{}
+	for _, file := range files {
+		found := false
+		for _, s := range stores {
+			if _, ok := s.CLI.Inventory.Find(file.ID); ok {
+				in[s.Dir] = append(in[s.Dir], file)
+				found = true
+				break
+			}
+		}
+		if !found {
+			here = append(here, file)
+		}
+	}
+	if len(here) > 0 {
+		if err := c.restoreFiles(ctx, here); err != nil {
+			return err
+		}
+	}
+	for _, s := range stores {
+		if len(in[s.Dir]) == 0 {
+			continue
+		}
+		log.Printf("[DEBUG] restoring %d file(s) from %s", len(in[s.Dir]), s.Dir)
+		if err := s.CLI.restoreFiles(ctx, in[s.Dir]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// summarize prints how each argument ended up when some of them failed to trash
+// instead of only the first error, and returns the error for the exit code
+// The files failed or skipped (e.g. ignored by .gomiignore) are empty
+func (c CLI) summarize(args []string, files []File, errs []error) error {
+	var trashed, skipped, failed int
+	rows := [][]string{{"FAILED", "REASON"}}
+	for i, arg := range args {
+		switch {
+		case errs[i] != nil:
+			failed++
+			reason := strings.TrimPrefix(errs[i].Error(), arg+": ")
+			if e, ok := errs[i].(*Error); ok {
+				reason = e.Reason()
+			}
+			rows = append(rows, []string{arg, reason})
+		case files[i].ID == "":
+			skipped++
+		default:
+			trashed++
+		}
+	}
+	fmt.Fprintf(c.Stderr, "gomi: trashed %d, skipped %d, failed %d\n", trashed, skipped, failed)
+	if err := printTable(c.Stderr, rows); err != nil {
+		return err
+	}
+	return fmt.Errorf("failed to trash %d of %d file(s)", failed, len(args))
+}
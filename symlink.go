@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinks is the limit of symlinks to follow (same as Linux's MAXSYMLINKS)
+const maxSymlinks = 40
+
+// symlinkedDir checks the argument to trash which refers to a directory via
+// a symlink (e.g. "link/" with trailing slash). Trashing it would move the
+// directory the link points to rather than the link itself, so it's refused
+// unless --follow-symlinked-dirs is given, and then the target is returned.
+func (c CLI) symlinkedDir(arg string) (string, error) {
+	link := strings.TrimRight(arg, string(filepath.Separator))
+	if link == arg || link == "" {
+		return arg, nil
+	}
+	fi, err := c.FS.Lstat(link)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		return arg, nil
+	}
+	target, err := c.resolveSymlink(link)
+	if err != nil {
+		return "", err
+	}
+	if fi, err := c.FS.Lstat(target); err != nil || !fi.IsDir() {
+		return arg, nil
+	}
+	if !c.Option.FollowSymlinkedDirs {
+		return "", fmt.Errorf("%s: is a symlink to directory %s (remove the trailing slash to trash the link, or give --follow-symlinked-dirs to trash the directory)", arg, target)
+	}
+	log.Printf("[DEBUG] %s: following symlink to %s", arg, target)
+	return target, nil
+}
+
+// resolveSymlink returns the path which the symlink finally points to
+func (c CLI) resolveSymlink(path string) (string, error) {
+	for i := 0; i < maxSymlinks; i++ {
+		fi, err := c.FS.Lstat(path)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			return path, nil
+		}
+		link, err := c.FS.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(path), link)
+		}
+		path = link
+	}
+	return "", fmt.Errorf("%s: too many levels of symbolic links", path)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// ansiEscape matches the escape sequences coloring the text
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// displayWidth returns the width of the string on the terminal
+func displayWidth(s string) int {
+	return runewidth.StringWidth(ansiEscape.ReplaceAllString(s, ""))
+}
+
+// printTable prints rows aligned by columns
+// Unlike text/tabwriter, the width of each cell is calculated
+// in the display width so that CJK, emoji and colors don't break the alignment
+func printTable(w io.Writer, rows [][]string) error {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := displayWidth(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if i == len(row)-1 {
+				// no padding for the last column
+				cells[i] = cell
+				continue
+			}
+			cells[i] = cell + strings.Repeat(" ", widths[i]-displayWidth(cell))
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(cells, "  ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate cuts the string to fit in the display width
+func truncate(s string, width int) string {
+	if runewidth.StringWidth(s) <= width {
+		return s
+	}
+	return runewidth.Truncate(s, width, "...")
+}
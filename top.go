@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// TopOption represents the options of top command
+type TopOption struct {
+	Delay      Duration `short:"d" long:"delay" value-name:"DURATION" default:"2s" description:"Interval to refresh"`
+	Iterations int      `short:"n" long:"iterations" value-name:"N" description:"Exit after refreshing N times"`
+}
+
+// Top shows the trash activity refreshing continuously like top(1)
+func (c CLI) Top() error {
+	opt := c.Option.Top
+	for i := 0; opt.Iterations == 0 || i < opt.Iterations; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(opt.Delay))
+		}
+		// reload since other gomi processes may update them
+		c.Inventory.Files = nil
+		if err := c.Inventory.Open(); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		pending, err := c.Journal.Pending()
+		if err != nil {
+			return err
+		}
+		// clear screen
+		fmt.Fprint(c.Stdout, "\033[H\033[2J")
+		if err := c.top(c.Stdout, pending); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c CLI) top(w io.Writer, pending []JournalEntry) error {
+	now := c.Clock.Now()
+	height := 24
+	if _, h, err := terminal.GetSize(int(os.Stdout.Fd())); err == nil && h > 0 {
+		height = h
+	}
+
+	var files []File
+	for _, file := range c.Inventory.Files {
+		if file.ID != "" {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Timestamp.After(files[j].Timestamp)
+	})
+
+	fmt.Fprintf(w, "gomi top - %s (every %s, Ctrl-C to quit)\n",
+		now.Format("15:04:05"), c.Option.Top.Delay)
+	size := c.Inventory.Size()
+	usage := ""
+	if quota := c.Config.Trash.Quota; quota > 0 {
+		usage = fmt.Sprintf(" (%.1f%% of quota %s)", float64(size)/float64(quota)*100, quota)
+	}
+	fmt.Fprintf(w, "Trash: %d file(s), %s%s\n", len(files), humanize.Bytes(uint64(size)), usage)
+	periods := []struct {
+		label    string
+		duration time.Duration
+	}{
+		{"Last hour", time.Hour},
+		{"Last 24 hours", 24 * time.Hour},
+	}
+	for _, p := range periods {
+		var n int
+		var bytes int64
+		for _, file := range files {
+			if now.Sub(file.Timestamp) > p.duration {
+				break
+			}
+			n++
+			bytes += file.Size
+		}
+		fmt.Fprintf(w, "%s: %d file(s), %s\n", p.label, n, humanize.Bytes(uint64(bytes)))
+	}
+	lines := 4
+
+	if len(pending) > 0 {
+		fmt.Fprintf(w, "\nIn progress:\n")
+		lines += 2
+		for _, entry := range pending {
+			fmt.Fprintf(w, "  %sing %s (%s)\n", entry.Op, entry.File.From, c.ago(entry.Time))
+			lines++
+		}
+	}
+
+	fmt.Fprintf(w, "\nRecent deletions:\n")
+	lines += 3
+	rows := [][]string{{"DELETED", "SIZE", "PATH"}}
+	for _, file := range files {
+		if lines+len(rows) >= height {
+			break
+		}
+		rows = append(rows, []string{c.ago(file.Timestamp), humanize.Bytes(uint64(file.Size)), file.From})
+	}
+	return printTable(w, rows)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/rs/xid"
+)
+
+// Transaction batches trash and restore operations so that the inventory
+// is rewritten only once when committed
+// gomi has no importable packages, so this is not an API for other Go
+// programs: they get it through gomi serve, which runs all the paths (or
+// IDs) of one request in a transaction.
+// Each operation is still journaled, so a crash before Commit finishes
+// can be recovered like the ordinary operations.
+type Transaction struct {
+	cli     CLI
+	groupID string
+	ops     []txOp
+	done    bool
+}
+
+type txOp struct {
+	op   string
+	path string // for opTrash
+	file File   // for opRestore
+}
+
+// TxResult represents the result of each operation in a transaction
+type TxResult struct {
+	Op   string
+	Path string
+	File File // the trashed or restored entry
+	Err  error
+}
+
+// Begin starts a transaction
+// The files put in the same transaction belong to the same group.
+func (c CLI) Begin() *Transaction {
+	return &Transaction{cli: c, groupID: xid.New().String()}
+}
+
+// Put adds the file to trash when committed
+func (t *Transaction) Put(path string) {
+	t.ops = append(t.ops, txOp{op: opTrash, path: path})
+}
+
+// Restore adds the trashed file to restore when committed
+func (t *Transaction) Restore(file File) {
+	t.ops = append(t.ops, txOp{op: opRestore, file: file})
+}
+
+// Commit runs all the operations in order and updates the inventory once
+// The operations failed don't stop the rest; see the result of each one.
+// If ctx is cancelled, the rest fail as interrupted and the ones done so
+// far are committed.
+// The error is returned only if the inventory could not be updated.
+func (t *Transaction) Commit(ctx context.Context) ([]TxResult, error) {
+	c := t.cli
+	if t.done {
+		return nil, nil
+	}
+	t.done = true
+	if err := c.FS.MkdirAll(c.Dir, c.Config.Trash.DirMode.Perm()); err != nil {
+		return nil, err
+	}
+
+	results := make([]TxResult, len(t.ops))
+	var trashed, restored []File
+	for n, op := range t.ops {
+		result := TxResult{Op: op.op, Path: op.path}
+		switch op.op {
+		case opTrash:
+			result.File, result.Err = c.trash(ctx, t.groupID, op.path)
+			if result.Err == nil && result.File.ID != "" {
+				trashed = append(trashed, result.File)
+			}
+		case opRestore:
+			result.Path, result.File = op.file.From, op.file
+			if result.Err = interrupted(ctx); result.Err == nil {
+				result.Err = c.restore(ctx, op.file)
+			}
+			if result.Err == nil {
+				restored = append(restored, op.file)
+			}
+		}
+		results[n] = result
+	}
+
+	log.Printf("[DEBUG] committing %d trashed and %d restored", len(trashed), len(restored))
+	ids := map[string]bool{}
+	for _, file := range restored {
+		ids[file.ID] = true
+	}
+	err := c.Inventory.modify(func(current []File) []File {
+		var files []File
+		for _, file := range current {
+			if !ids[file.ID] {
+				files = append(files, file)
+			}
+		}
+		return append(files, trashed...)
+	})
+	if err != nil {
+		// keep the journal so that it can be recovered next time
+		return results, err
+	}
+	c.audit(opTrash, trashed...)
+	c.audit(opRestore, restored...)
+	c.Journal.Done(opTrash, trashed...)
+	c.Journal.Done(opRestore, restored...)
+	return results, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dustin/go-humanize"
+)
+
+// TreeOption represents the options of tree command
+type TreeOption struct {
+	Depth int `short:"L" long:"depth" value-name:"N" default:"3" description:"Show the directories only down to this depth (0 for all)"`
+}
+
+// treeNode is a file in the payload with the total size under it
+type treeNode struct {
+	name     string
+	fi       os.FileInfo
+	link     string
+	size     int64
+	dirs     int64 // number of directories under the directory
+	files    int64 // number of the other files under the directory
+	children []*treeNode
+}
+
+// Tree prints the structure of the trashed directory like tree command
+// so that it can be checked before restoring a large hierarchy
+// The directories deeper than --depth are shown with their totals only.
+func (c CLI) Tree(ids []string) error {
+	if len(ids) != 1 {
+		return errors.New("tree <id>: exactly one id is required")
+	}
+	file, ok := c.Inventory.Find(ids[0])
+	if !ok {
+		return notFound(ids[0])
+	}
+	if file = c.legacyType(file); file.Type != typeDir && file.Type != "" {
+		return fmt.Errorf("%s: not a directory", file.From)
+	}
+	if file.Archived {
+		return fmt.Errorf("%s: payload is archived (not in %s)", file.From, c.Dir)
+	}
+	path, cleanup, err := c.payload(file)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	fi, err := c.FS.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	root := c.treeNode(path, fi, 0, c.Option.Tree.Depth)
+	root.name = file.Name
+	var dirs, files int
+	c.printTree(c.Stdout, root, "", "", &dirs, &files)
+	fmt.Fprintf(c.Stdout, "\n%d directories, %d files", dirs, files)
+	if hidden := root.dirs + root.files - int64(dirs+files); hidden > 0 {
+		fmt.Fprintf(c.Stdout, " (%d more below depth %d)", hidden, c.Option.Tree.Depth)
+	}
+	fmt.Fprintln(c.Stdout)
+	c.touch(file.ID)
+	return nil
+}
+
+// treeNode reads the file and the directories under it at once, keeping
+// the children only down to the depth (0 for all)
+func (c CLI) treeNode(path string, fi os.FileInfo, depth, maxDepth int) *treeNode {
+	node := &treeNode{name: fi.Name(), fi: fi, size: fi.Size()}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		node.link, _ = c.FS.Readlink(path)
+	}
+	if !fi.IsDir() {
+		return node
+	}
+	entries, err := c.FS.ReadDir(path)
+	if err != nil {
+		return node
+	}
+	for _, entry := range entries {
+		child := c.treeNode(filepath.Join(path, entry.Name()), entry, depth+1, maxDepth)
+		node.size += child.size
+		node.dirs += child.dirs
+		node.files += child.files
+		if entry.IsDir() {
+			node.dirs++
+		} else {
+			node.files++
+		}
+		if maxDepth == 0 || depth < maxDepth {
+			node.children = append(node.children, child)
+		}
+	}
+	return node
+}
+
+func (c CLI) printTree(w io.Writer, node *treeNode, indent, branch string, dirs, files *int) {
+	label := node.name
+	switch {
+	case node.fi.IsDir():
+		label += fmt.Sprintf("/ (%d file(s), %s)", node.files, humanize.Bytes(uint64(node.size)))
+	case node.link != "":
+		label += " -> " + node.link
+	default:
+		label += fmt.Sprintf(" (%s)", humanize.Bytes(uint64(node.size)))
+	}
+	fmt.Fprintln(w, indent+branch+label)
+
+	switch branch {
+	case "├── ":
+		indent += "│   "
+	case "└── ":
+		indent += "    "
+	}
+	for i, child := range node.children {
+		if child.fi.IsDir() {
+			*dirs++
+		} else {
+			*files++
+		}
+		branch := "├── "
+		if i == len(node.children)-1 {
+			branch = "└── "
+		}
+		c.printTree(w, child, indent, branch, dirs, files)
+	}
+}
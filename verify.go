@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// VerifyOption represents the options of verify command
+type VerifyOption struct {
+	QueryOption
+}
+
+// These are the results of verification of each entry
+const (
+	verifyOK               = "ok"
+	verifyArchived         = "archived"
+	verifyPacked           = "packed"
+	verifyMissing          = "missing"
+	verifySizeMismatch     = "size_mismatch"
+	verifyChecksumMismatch = "checksum_mismatch"
+	verifyError            = "error"
+)
+
+// VerifyResult represents the verification result of an inventory entry
+type VerifyResult struct {
+	ID         string `json:"id"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Status     string `json:"status"`
+	Size       int64  `json:"size"`
+	ActualSize int64  `json:"actual_size,omitempty"`
+	Checksum   string `json:"checksum,omitempty"`
+	ActualSum  string `json:"actual_checksum,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	// not a problem of the payload but restoring it may move across filesystems
+	OriginChanged bool `json:"origin_filesystem_changed,omitempty"`
+}
+
+// VerifyReport represents the output of verify command
+type VerifyReport struct {
+	Total    int            `json:"total"`
+	OK       int            `json:"ok"`
+	Problems int            `json:"problems"`
+	Entries  []VerifyResult `json:"entries"`
+}
+
+// Verify checks all payloads exist in gomi dir and match the inventory
+// It prints the report as JSON and fails if any problem is found
+func (c CLI) Verify() error {
+	files := c.Query(c.Option.Verify.QueryOption, c.Clock.Now())
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Timestamp.Before(files[j].Timestamp)
+	})
+
+	report := VerifyReport{Entries: []VerifyResult{}}
+	for _, file := range files {
+		result := c.verify(file)
+		report.Total++
+		if result.Status == verifyOK || result.Status == verifyArchived || result.Status == verifyPacked {
+			report.OK++
+		} else {
+			report.Problems++
+		}
+		report.Entries = append(report.Entries, result)
+	}
+
+	enc := json.NewEncoder(c.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	if report.Problems > 0 {
+		return fmt.Errorf("%d problem(s) found", report.Problems)
+	}
+	return nil
+}
+
+func (c CLI) verify(file File) VerifyResult {
+	result := VerifyResult{
+		ID:       file.ID,
+		From:     file.From,
+		To:       file.To,
+		Size:     file.Size,
+		Checksum: file.Checksum,
+		Status:   verifyOK,
+
+		OriginChanged: c.originChanged(file),
+	}
+	if file.IsNode() {
+		// special files have no payload
+		return result
+	}
+	if c.packed(file) {
+		// not extracted to check the size and checksum since it's slow
+		if ok, err := c.packHas(file); err != nil {
+			result.Status = verifyError
+			result.Error = err.Error()
+		} else if ok {
+			result.Status = verifyPacked
+		} else {
+			result.Status = verifyMissing
+		}
+		return result
+	}
+	fi, err := c.FS.Lstat(file.To)
+	if os.IsNotExist(err) {
+		result.Status = verifyMissing
+		if file.Archived {
+			// not a corruption (see restore-metadata)
+			result.Status = verifyArchived
+		}
+		return result
+	}
+	if err != nil {
+		result.Status = verifyError
+		result.Error = err.Error()
+		return result
+	}
+	size := fi.Size()
+	if fi.IsDir() {
+		size = dirSize(c.FS, file.To)
+	}
+	if size != file.Size {
+		result.Status = verifySizeMismatch
+		result.ActualSize = size
+		return result
+	}
+	if file.Checksum == "" {
+		return result
+	}
+	sum, err := checksum(c.FS, file.To)
+	if err != nil {
+		result.Status = verifyError
+		result.Error = err.Error()
+		return result
+	}
+	if sum != file.Checksum {
+		result.Status = verifyChecksumMismatch
+		result.ActualSum = sum
+	}
+	return result
+}
+
+// checksum returns sha256 of the file
+// In case of directory, it's calculated from the relative paths
+// and the contents of all files under the directory
+func checksum(fs FS, path string) (string, error) {
+	h := sha256.New()
+	err := fs.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := fs.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00%s\x00", filepath.ToSlash(rel), link)
+		case fi.Mode().IsRegular():
+			f, err := fs.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			fmt.Fprintf(h, "%s\x00", filepath.ToSlash(rel))
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		case fi.IsDir():
+			fmt.Fprintf(h, "%s/\x00", filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+)
+
+// VersionOption represents the options of version command
+type VersionOption struct {
+	JSON bool `long:"json" description:"Print the version and the build metadata as JSON"`
+}
+
+// BuildInfo represents what gomi version --json prints for packagers and
+// bug reports to capture exactly how the binary was built
+type BuildInfo struct {
+	Version   string        `json:"version"`
+	Revision  string        `json:"revision"`
+	BuildDate string        `json:"build_date"`
+	GoVersion string        `json:"go_version"`
+	Platform  string        `json:"platform"`
+	Features  BuildFeatures `json:"features"`
+}
+
+// BuildFeatures represents the optional features built into the binary
+// FUSE and SQLite are not supported by any build yet, but reported so that
+// the tools reading this don't have to guess from the version.
+type BuildFeatures struct {
+	Encryption bool   `json:"encryption"` // encryption.inventory
+	Keychain   string `json:"keychain"`   // backend of encryption.key_source = "keychain"
+	FUSE       bool   `json:"fuse"`
+	SQLite     bool   `json:"sqlite"`
+}
+
+func buildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   Version,
+		Revision:  Revision,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Features: BuildFeatures{
+			Encryption: true,
+			Keychain:   keychainBackend,
+		},
+	}
+}
+
+// PrintVersion prints the version like --version, or with the build
+// metadata as JSON with --json
+func (c CLI) PrintVersion() error {
+	if !c.Option.VersionCmd.JSON {
+		fmt.Fprintf(c.Stdout, "%s (%s)\n", Version, Revision)
+		return nil
+	}
+	enc := json.NewEncoder(c.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(buildInfo())
+}
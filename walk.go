@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// walkWorkers is how many directories are read at once to measure them
+var walkWorkers = 4 * runtime.NumCPU()
+
+// usage is the total size and the number of files measured
+type usage struct {
+	Size  int64
+	Count int64 // including the directory itself
+}
+
+// measured caches the usage of the paths measured until they are trashed
+// (e.g. for the confirmation and then for the inventory entry)
+// The entry is taken out when it's used, and all are forgotten after each
+// Remove, since the directory can change before it's trashed again (e.g. in
+// gomi serve or after declining the confirmation).
+var measured = struct {
+	sync.Mutex
+	paths map[string]usage
+}{paths: map[string]usage{}}
+
+// measure returns the total size and the number of files under the path
+// Directories are read concurrently by at most walkWorkers goroutines.
+// When all of them are busy, the directory is read in the current one
+// instead of being queued, so the memory doesn't grow with the tree.
+// It stops early when ctx is cancelled (returning its error) or when stop
+// returns true for the usage so far (e.g. over the limits of guard).
+// The errors to read the files are ignored like dirSize used to.
+func measure(ctx context.Context, fs FS, path string, stop func(usage) bool) (usage, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var size, count int64
+	var stopped int32
+	sem := make(chan struct{}, walkWorkers)
+	var wg sync.WaitGroup
+
+	var visit func(path string, fi os.FileInfo)
+	visit = func(path string, fi os.FileInfo) {
+		if ctx.Err() != nil {
+			return
+		}
+		u := usage{
+			Size:  atomic.AddInt64(&size, fi.Size()),
+			Count: atomic.AddInt64(&count, 1),
+		}
+		if stop != nil && stop(u) {
+			atomic.StoreInt32(&stopped, 1)
+			cancel()
+			return
+		}
+		if !fi.IsDir() {
+			return
+		}
+		entries, err := fs.ReadDir(path)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			child, entry := filepath.Join(path, entry.Name()), entry
+			if !entry.IsDir() {
+				visit(child, entry)
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-sem }()
+					visit(child, entry)
+				}()
+			default:
+				visit(child, entry)
+			}
+		}
+	}
+
+	if fi, err := fs.Lstat(path); err == nil {
+		visit(path, fi)
+	}
+	wg.Wait()
+	u := usage{Size: atomic.LoadInt64(&size), Count: atomic.LoadInt64(&count)}
+	if atomic.LoadInt32(&stopped) == 0 && ctx.Err() != nil {
+		return u, ctx.Err()
+	}
+	return u, nil
+}
+
+// measureCached is measure without stop which takes the result measured
+// before for the path out of the cache if any
+func measureCached(ctx context.Context, fs FS, path string) (usage, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return usage{}, err
+	}
+	measured.Lock()
+	u, ok := measured.paths[abs]
+	delete(measured.paths, abs)
+	measured.Unlock()
+	if ok {
+		return u, nil
+	}
+	return measure(ctx, fs, path, nil)
+}
+
+// cacheUsage remembers the usage of the path measured completely
+func cacheUsage(abs string, u usage) {
+	measured.Lock()
+	defer measured.Unlock()
+	measured.paths[abs] = u
+}
+
+// forgetUsage forgets all the usage cached by cacheUsage
+func forgetUsage() {
+	measured.Lock()
+	defer measured.Unlock()
+	measured.paths = map[string]usage{}
+}
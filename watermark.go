@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Watermark prints a notice when the trash size is over the thresholds in config
+// Desktop notification is sent only when the size crosses the threshold
+// in this operation so as not to be noisy
+func (c CLI) Watermark(before, after int64) {
+	cfg := c.Config.Trash
+	var crossed Threshold
+	var limit int64
+	for _, t := range cfg.Watermark.Thresholds {
+		bytes := t.Bytes(cfg.Quota)
+		if bytes <= 0 || after < bytes || bytes < limit {
+			continue
+		}
+		crossed, limit = t, bytes
+	}
+	if limit == 0 {
+		return
+	}
+	log.Printf("[DEBUG] trash size %d is over the threshold %s (%d)", after, crossed, limit)
+	msg := fmt.Sprintf("the trash size (%s) exceeds %s", humanize.Bytes(uint64(after)), crossed)
+	if crossed.Percent > 0 {
+		msg += fmt.Sprintf(" (%s)", cfg.Quota)
+	}
+	c.notice("%s, consider cleaning up the trash", msg)
+	if cfg.Watermark.Notify && before < limit && !c.quiet() {
+		if err := notify("gomi", msg); err != nil {
+			log.Printf("[ERROR] failed to send notification: %v", err)
+		}
+	}
+}
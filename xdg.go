@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// xdgTrashInfoSuffix is the extension of the metadata in the XDG trash
+const xdgTrashInfoSuffix = ".trashinfo"
+
+// xdgTrashDir returns the home trash of the FreeDesktop.org trash spec
+// ($XDG_DATA_HOME/Trash), which the file managers of the desktop use
+func xdgTrashDir() string {
+	return filepath.Join(xdgDataHome(), "Trash")
+}
+
+// exportXDG moves the entries into the XDG trash with their .trashinfo,
+// handing them over to the trash of the desktop (emptied by the file
+// manager or the desktop's own policy). They are removed from the inventory.
+func (c CLI) exportXDG(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return errors.New("export --to-xdg <id>...: too few arguments")
+	}
+	var files []File
+	for _, id := range ids {
+		file, ok := c.Inventory.Find(id)
+		if !ok {
+			return notFound(id)
+		}
+		switch {
+		case file.IsNode():
+			return fmt.Errorf("%s: %s cannot be kept in the XDG trash", file.From, file.Type)
+		case file.Archived:
+			return fmt.Errorf("%s: payload is archived (not in %s)", file.From, c.Dir)
+		case file.From == "":
+			return fmt.Errorf("%s: original path is unknown (fix it with fix-path first)", file.ID)
+		}
+		files = append(files, file)
+	}
+
+	trash := xdgTrashDir()
+	for _, dir := range []string{"files", "info"} {
+		if err := c.FS.MkdirAll(filepath.Join(trash, dir), 0700); err != nil {
+			return err
+		}
+	}
+	var exported []File
+	defer func() {
+		if len(exported) == 0 {
+			return
+		}
+		if err := c.Inventory.Delete(exported...); err != nil {
+			log.Printf("[ERROR] failed to update inventory: %v", err)
+			return
+		}
+		c.audit(opExport, exported...)
+	}()
+	for _, file := range files {
+		if err := interrupted(ctx); err != nil {
+			return err
+		}
+		to, err := c.moveToXDG(ctx, trash, file)
+		if err != nil {
+			return err
+		}
+		c.info("exported %s to %s", file.From, to)
+		c.removeSidecar(file)
+		removeEmptyDirs(c.FS, c.Dir, filepath.Dir(file.To))
+		file.To = to
+		exported = append(exported, file)
+	}
+	return nil
+}
+
+// moveToXDG moves the payload into files/ of the trash under a name not
+// used yet and writes its .trashinfo into info/ as the spec says
+func (c CLI) moveToXDG(ctx context.Context, trash string, file File) (string, error) {
+	if c.packed(file) {
+		if _, err := c.unpack(file, filepath.Dir(file.To)); err != nil {
+			return "", err
+		}
+	}
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: file.From}).EscapedPath(),
+		file.Timestamp.Local().Format("2006-01-02T15:04:05"))
+
+	ext := filepath.Ext(file.Name)
+	base := strings.TrimSuffix(file.Name, ext)
+	for n := 1; ; n++ {
+		name := file.Name
+		if n > 1 {
+			name = fmt.Sprintf("%s.%d%s", base, n, ext)
+		}
+		// the info file is created first to reserve the name
+		infoPath := filepath.Join(trash, "info", name+xdgTrashInfoSuffix)
+		f, err := c.FS.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.WriteString(info)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		to := filepath.Join(trash, "files", name)
+		if _, serr := c.FS.Lstat(to); err == nil && serr == nil {
+			// left by others without the info file
+			c.FS.Remove(infoPath)
+			continue
+		}
+		if err == nil {
+			log.Printf("[DEBUG] moving %q -> %q", file.To, to)
+			err = move(ctx, c.FS, file.To, to)
+		}
+		if err != nil {
+			c.FS.Remove(infoPath)
+			return "", err
+		}
+		c.unprotect(file, to)
+		return to, nil
+	}
+}